@@ -1,6 +1,9 @@
 package crossplane
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // bit masks for different directive argument styles
 const (
@@ -18,9 +21,16 @@ const (
 	ngxConf1More  = 0x00000800 // >=1 args
 	ngxConf2More  = 0x00001000 // >=2 args
 
+	// for partial definitions of module directives whose arguments aren't
+	// known. Unlike ngxConfAny, which means that nginx takes any number of
+	// arguments, nothing about the arguments is checked: not their number,
+	// not "if" conditions, and not the formats that ValidateArgumentFormats
+	// checks. Only the directive's contexts and terminator are checked.
+	ngxConfUnchecked = 0x00002000
+
 	// some helpful argument style aliases
 	ngxConfTake12   = (ngxConfTake1 | ngxConfTake2)
-	//ngxConfTake13   = (ngxConfTake1 | ngxConfTake3) (currently unused)
+	ngxConfTake13   = (ngxConfTake1 | ngxConfTake3)
 	ngxConfTake23   = (ngxConfTake2 | ngxConfTake3)
 	ngxConfTake34   = (ngxConfTake3 | ngxConfTake4)
 	ngxConfTake123  = (ngxConfTake12 | ngxConfTake3)
@@ -42,6 +52,9 @@ const (
 	ngxHttpSifConf    = 0x20000000 // http > server > if
 	ngxHttpLifConf    = 0x40000000 // http > location > if
 	ngxHttpLmtConf    = 0x80000000 // http > location > limit_except
+
+	// bit masks for the contexts of blocks from dynamic modules
+	ngxHttpOtelConf = 0x100000000 // http > otel_exporter
 )
 
 // helpful directive location alias describing "any" context
@@ -66,6 +79,45 @@ var contexts = map[string]int{
 	blockCtx{"http", "server", "if"}.key():             ngxHttpSifConf,
 	blockCtx{"http", "location", "if"}.key():           ngxHttpLifConf,
 	blockCtx{"http", "location", "limit_except"}.key(): ngxHttpLmtConf,
+	blockCtx{"http", "otel_exporter"}.key():            ngxHttpOtelConf,
+}
+
+// map for finding blocks whose contents are key/value entries rather than
+// directives, keyed by the top-level context that they're allowed in
+var containerBlocks = map[string][]string{
+	"http":   []string{"charset_map", "geo", "geoip2", "map", "match", "split_clients", "types"},
+	"stream": []string{"geo", "geoip2", "map", "match", "split_clients"},
+}
+
+// lookupDirective returns the bit masks of a directive in a context, or false
+// if the directive isn't known there.
+func lookupDirective(name string, ctx blockCtx) ([]int, bool) {
+	if masks, ok := blockDirectives[ctx.key()][name]; ok {
+		return masks, true
+	}
+	masks, ok := directives[name]
+	return masks, ok
+}
+
+// argsUnchecked returns true if a directive is partially defined in a
+// context, so that its arguments shouldn't be checked there.
+func argsUnchecked(masks []int, ctx blockCtx) bool {
+	currCtx, ok := contexts[ctx.key()]
+	if !ok {
+		return false
+	}
+	for _, mask := range masks {
+		if (mask&currCtx) != 0 && (mask&ngxConfUnchecked) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isContainerCtx returns true if the context is the inside of a block whose
+// contents are key/value entries, like "map" or "geo".
+func isContainerCtx(ctx blockCtx) bool {
+	return len(ctx) > 1 && contains(containerBlocks[ctx[0]], ctx[len(ctx)-1])
 }
 
 func enterBlockCtx(stmt Directive, ctx blockCtx) blockCtx {
@@ -73,18 +125,104 @@ func enterBlockCtx(stmt Directive, ctx blockCtx) blockCtx {
 	if len(ctx) > 0 && ctx[0] == "http" && stmt.Directive == "location" {
 		return blockCtx{"http", "location"}
 	}
-	// no other block contexts can be nested like location so just append it
-	return append(ctx, stmt.Directive)
+	// no other block contexts can be nested like location so just append it,
+	// copying first so that sibling blocks don't share the same backing array
+	inner := make(blockCtx, len(ctx), len(ctx)+1)
+	copy(inner, ctx)
+	return append(inner, stmt.Directive)
+}
+
+// suggestDirective finds the known directive that's closest to an unknown
+// directive's name, as long as it's close enough to likely be a typo.
+func suggestDirective(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if _, ok := directives[lower]; ok {
+		return lower, true
+	}
+
+	// allow roughly one typo for every four characters, but at most two
+	maxDist := len(lower) / 4
+	if maxDist > 2 {
+		maxDist = 2
+	}
+
+	best, bestDist := "", maxDist+1
+	for known := range directives {
+		dist := levenshtein(lower, known)
+		if dist < bestDist || (dist == bestDist && known < best) {
+			best, bestDist = known, dist
+		}
+	}
+	return best, best != ""
+}
+
+// the entries of map and geo blocks that are parameters of the block rather
+// than keys, and that don't take a value
+var containerParams = map[string][]string{
+	"geo": []string{"proxy_recursive", "ranges"},
+	"map": []string{"hostnames", "volatile"},
+}
+
+// checkContainerEntry describes what's wrong with an entry in a map or geo
+// block, or returns "" if nothing is. Every entry needs exactly one value,
+// like "default 0;" or "include file;", except for the block's parameters,
+// which can't be used in the other kind of block.
+func checkContainerEntry(stmt Directive, term string, block string) string {
+	params, ok := containerParams[block]
+	if !ok || term != ";" {
+		return ""
+	}
+	if len(stmt.Args) == 0 {
+		if contains(params, stmt.Directive) {
+			return ""
+		}
+		for other, otherParams := range containerParams {
+			if contains(otherParams, stmt.Directive) {
+				return fmt.Sprintf(`"%s" is only allowed in "%s" blocks`, stmt.Directive, other)
+			}
+		}
+	}
+	if len(stmt.Args) != 1 {
+		return fmt.Sprintf("invalid number of the %s parameters", block)
+	}
+	return ""
 }
 
 func analyze(fname string, stmt Directive, term string, ctx blockCtx, options *ParseOptions) error {
-	masks, knownDirective := directives[stmt.Directive]
+	// entries in container blocks like "map" aren't directives, except for
+	// include, which nginx follows inside of them too
+	if isContainerCtx(ctx) {
+		what := ""
+		if stmt.Directive != "include" {
+			what = checkContainerEntry(stmt, term, ctx[len(ctx)-1])
+		} else if term != ";" {
+			what = `directive "include" is not terminated by ";"`
+		} else if len(stmt.Args) != 1 {
+			what = `invalid number of arguments in "include" directive`
+		}
+		if what == "" {
+			return nil
+		}
+		return ParseError{
+			what: what,
+			file: &fname,
+			line: &stmt.Line,
+		}
+	}
+
+	masks, knownDirective := lookupDirective(stmt.Directive, ctx)
 	currCtx, knownContext := contexts[ctx.key()]
 
 	// if strict and directive isn't recognized then throw error
 	if options.ErrorOnUnknownDirectives && !knownDirective {
+		what := fmt.Sprintf(`unknown directive "%s"`, stmt.Directive)
+		if options.SuggestDirectives {
+			if suggestion, ok := suggestDirective(stmt.Directive); ok {
+				what += fmt.Sprintf(` (did you mean "%s"?)`, suggestion)
+			}
+		}
 		return ParseError{
-			what: fmt.Sprintf(`unknown directive "%s"`, stmt.Directive),
+			what: what,
 			file: &fname,
 			line: &stmt.Line,
 		}
@@ -96,6 +234,12 @@ func analyze(fname string, stmt Directive, term string, ctx blockCtx, options *P
 		return nil
 	}
 
+	return checkMasks(fname, stmt, term, currCtx, masks, options)
+}
+
+// checkMasks checks a known directive in a known context against the bit
+// masks that say where it's allowed and what arguments it takes.
+func checkMasks(fname string, stmt Directive, term string, currCtx int, masks []int, options *ParseOptions) error {
 	// if this directive can't be used in this context then throw an error
 	var ctxMasks []int
 	if options.SkipDirectiveContextCheck {
@@ -137,12 +281,26 @@ func analyze(fname string, stmt Directive, term string, ctx blockCtx, options *P
 			continue
 		}
 
+		// the arguments of partially defined directives can't be checked
+		if (mask & ngxConfUnchecked) != 0 {
+			return nil
+		}
+
 		// use mask to check the directive's arguments
 		if ((mask>>len(stmt.Args)&1) != 0 && len(stmt.Args) <= 7) || // NOARGS to TAKE7
 			((mask&ngxConfFlag) != 0 && len(stmt.Args) == 1 && validFlag(stmt.Args[0])) ||
 			((mask&ngxConfAny) != 0 && len(stmt.Args) >= 0) ||
 			((mask&ngxConf1More) != 0 && len(stmt.Args) >= 1) ||
 			((mask&ngxConf2More) != 0 && len(stmt.Args) >= 2) {
+			if stmt.Directive == "if" && options.ValidateIfConditions {
+				if err := ValidateIfCondition(stmt.Args); err != nil {
+					return ParseError{
+						what: err.Error(),
+						file: &fname,
+						line: &stmt.Line,
+					}
+				}
+			}
 			return nil
 		} else if (mask&ngxConfFlag) != 0 && len(stmt.Args) == 1 && !validFlag(stmt.Args[0]) {
 			what = fmt.Sprintf(`invalid value "%s" in "%s" directive, it must be "on" or "off"`, stmt.Args[0], stmt.Directive)
@@ -232,13 +390,13 @@ var directives = map[string][]int{
 	"auth_http": []int{
 		ngxMailMainConf | ngxMailSrvConf | ngxConfTake1,
 	},
-	"auth_Httpheader": []int{
+	"auth_http_header": []int{
 		ngxMailMainConf | ngxMailSrvConf | ngxConfTake2,
 	},
-	"auth_Httppass_client_cert": []int{
+	"auth_http_pass_client_cert": []int{
 		ngxMailMainConf | ngxMailSrvConf | ngxConfFlag,
 	},
-	"auth_Httptimeout": []int{
+	"auth_http_timeout": []int{
 		ngxMailMainConf | ngxMailSrvConf | ngxConfTake1,
 	},
 	"auth_request": []int{
@@ -452,10 +610,10 @@ var directives = map[string][]int{
 	"fastcgi_next_upstream": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"fastcgi_next_upStreamtimeout": []int{
+	"fastcgi_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"fastcgi_next_upStreamtries": []int{
+	"fastcgi_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"fastcgi_no_cache": []int{
@@ -555,10 +713,10 @@ var directives = map[string][]int{
 	"grpc_next_upstream": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"grpc_next_upStreamtimeout": []int{
+	"grpc_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"grpc_next_upStreamtries": []int{
+	"grpc_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"grpc_pass": []int{
@@ -633,7 +791,7 @@ var directives = map[string][]int{
 	"gzip_disable": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"gzip_Httpversion": []int{
+	"gzip_http_version": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"gzip_min_length": []int{
@@ -878,10 +1036,10 @@ var directives = map[string][]int{
 	"memcached_next_upstream": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"memcached_next_upStreamtimeout": []int{
+	"memcached_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"memcached_next_upStreamtries": []int{
+	"memcached_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"memcached_pass": []int{
@@ -1083,7 +1241,7 @@ var directives = map[string][]int{
 	"proxy_hide_header": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"proxy_Httpversion": []int{
+	"proxy_http_version": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"proxy_ignore_client_abort": []int{
@@ -1108,11 +1266,11 @@ var directives = map[string][]int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfFlag,
 	},
-	"proxy_next_upStreamtimeout": []int{
+	"proxy_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
 	},
-	"proxy_next_upStreamtries": []int{
+	"proxy_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
 	},
@@ -1383,10 +1541,10 @@ var directives = map[string][]int{
 	"scgi_next_upstream": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"scgi_next_upStreamtimeout": []int{
+	"scgi_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"scgi_next_upStreamtries": []int{
+	"scgi_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"scgi_no_cache": []int{
@@ -1826,10 +1984,10 @@ var directives = map[string][]int{
 	"uwsgi_next_upstream": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
 	},
-	"uwsgi_next_upStreamtimeout": []int{
+	"uwsgi_next_upstream_timeout": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
-	"uwsgi_next_upStreamtries": []int{
+	"uwsgi_next_upstream_tries": []int{
 		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
 	},
 	"uwsgi_no_cache": []int{
@@ -2039,19 +2197,32 @@ var directives = map[string][]int{
 	"js_filter": []int{
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
 	},
+	"js_import": []int{
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake13,
+	},
 	"js_include": []int{
 		ngxHttpMainConf | ngxConfTake1,
 		ngxStreamMainConf | ngxConfTake1,
 	},
 	"js_path": []int{
 		ngxHttpMainConf | ngxConfTake1,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
+	},
+	"js_preload_object": []int{
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake13,
 	},
 	"js_preread": []int{
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
 	},
 	"js_set": []int{
 		ngxHttpMainConf | ngxConfTake2,
-		ngxStreamMainConf | ngxConfTake2,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake23,
+	},
+	"js_shared_dict_zone": []int{
+		ngxStreamMainConf | ngxConf1More,
+	},
+	"js_var": []int{
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake12,
 	},
 	"keyval": []int{
 		ngxHttpMainConf | ngxConfTake3,
@@ -2124,7 +2295,7 @@ var directives = map[string][]int{
 	"sticky_cookie_insert": []int{
 		ngxHttpUpsConf | ngxConfTake1234,
 	},
-	"upStreamconf": []int{
+	"upstream_conf": []int{
 		ngxHttpLocConf | ngxConfNoArgs,
 	},
 	"uwsgi_cache_purge": []int{
@@ -2190,4 +2361,157 @@ var directives = map[string][]int{
 	"zone_sync_timeout": []int{
 		ngxStreamMainConf | ngxStreamSrvConf | ngxConfTake1,
 	},
+
+	// third-party and dynamic module directives [definitions taken from module source]
+	"access_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"balancer_by_lua_block": []int{
+		ngxHttpUpsConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamUpsConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"body_filter_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"content_by_lua_block": []int{
+		ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"dav_ext_methods": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConf1More,
+	},
+	"exit_worker_by_lua_block": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"geoip2": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfTake1,
+		ngxStreamMainConf | ngxConfBlock | ngxConfTake1,
+	},
+	"geoip2_proxy": []int{
+		ngxHttpMainConf | ngxConfTake1,
+	},
+	"geoip2_proxy_recursive": []int{
+		ngxHttpMainConf | ngxConfFlag,
+	},
+	"header_filter_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"init_by_lua_block": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"init_worker_by_lua_block": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"log_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"modsecurity": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfFlag,
+	},
+	"modsecurity_rules": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"modsecurity_rules_file": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"modsecurity_rules_remote": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake2,
+	},
+	"modsecurity_transaction_id": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"otel_exporter": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"otel_resource_attr": []int{
+		ngxHttpMainConf | ngxConfTake2,
+	},
+	"otel_service_name": []int{
+		ngxHttpMainConf | ngxConfTake1,
+	},
+	"otel_span_attr": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake2,
+	},
+	"otel_span_name": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"otel_trace": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"otel_trace_context": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxConfTake1,
+	},
+	"preread_by_lua_block": []int{
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"rewrite_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"server_rewrite_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"set_by_lua_block": []int{
+		ngxHttpSrvConf | ngxHttpSifConf | ngxHttpLocConf | ngxHttpLifConf | ngxConfBlock | ngxConfTake1,
+	},
+	"ssl_certificate_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"ssl_client_hello_by_lua_block": []int{
+		ngxHttpMainConf | ngxHttpSrvConf | ngxConfBlock | ngxConfNoArgs,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"ssl_session_fetch_by_lua_block": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"ssl_session_store_by_lua_block": []int{
+		ngxHttpMainConf | ngxConfBlock | ngxConfNoArgs,
+	},
+}
+
+// This dict holds the directives that are only known inside of a module's
+// block, keyed by the context of the block, so that their generic names
+// aren't known anywhere else. A directive that isn't in the block's table
+// is looked up in the table above.
+var blockDirectives = map[string]map[string][]int{
+	blockCtx{"http", "otel_exporter"}.key(): map[string][]int{
+		"batch_count": []int{
+			ngxHttpOtelConf | ngxConfTake1,
+		},
+		"batch_size": []int{
+			ngxHttpOtelConf | ngxConfTake1,
+		},
+		"endpoint": []int{
+			ngxHttpOtelConf | ngxConfTake1,
+		},
+		"header": []int{
+			ngxHttpOtelConf | ngxConfTake2,
+		},
+		"interval": []int{
+			ngxHttpOtelConf | ngxConfTake1,
+		},
+		"trusted_certificate": []int{
+			ngxHttpOtelConf | ngxConfTake1,
+		},
+	},
+}
+
+// This dict maps deprecated and obsolete directives to advice on what to use
+// instead. The directives are still in the directives table because older
+// versions of nginx accept them.
+var deprecatedDirectives = map[string]string{
+	"http2_idle_timeout":          `use the "keepalive_timeout" directive instead`,
+	"http2_max_concurrent_pushes": `HTTP/2 server push is no longer supported`,
+	"http2_max_field_size":        `use the "large_client_header_buffers" directive instead`,
+	"http2_max_header_size":       `use the "large_client_header_buffers" directive instead`,
+	"http2_max_requests":          `use the "keepalive_requests" directive instead`,
+	"http2_push":                  `HTTP/2 server push is no longer supported`,
+	"http2_push_preload":          `HTTP/2 server push is no longer supported`,
+	"http2_recv_timeout":          `use the "client_header_timeout" directive instead`,
+	"spdy_chunk_size":             `use the "http2_chunk_size" directive instead`,
+	"spdy_headers_comp":           `SPDY was replaced by HTTP/2, which has no equivalent`,
+	"ssl":                         `use the "listen ... ssl" directive instead`,
 }
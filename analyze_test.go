@@ -75,4 +75,342 @@ func TestAnalyze(t *testing.T) {
 			}
 		}
 	})
+	// Check which unknown directives get a suggestion.
+	t.Run("suggest-directive", func(t *testing.T) {
+		suggestions := map[string]string{
+			"proxy_passs":        "proxy_pass",
+			"PROXY_PASS":         "proxy_pass",
+			"worker_conections":  "worker_connections",
+			"server_nmae":        "server_name",
+			"completely_unknown": "",
+			"foo":                "",
+		}
+		for name, expected := range suggestions {
+			got, ok := suggestDirective(name)
+			if got != expected || ok != (expected != "") {
+				t.Fatalf("expected suggestion for %q to be %q but got %q", name, expected, got)
+			}
+		}
+	})
+	// Check that limit_except takes methods and that its contents are
+	// analyzed in the limit_except context.
+	t.Run("limit-except", func(t *testing.T) {
+		locCtx := blockCtx{"http", "location"}
+		lmtCtx := enterBlockCtx(Directive{Directive: "limit_except"}, locCtx)
+		if got := contexts[lmtCtx.key()]; got != ngxHttpLmtConf {
+			t.Fatalf("expected limit_except context but got %v", lmtCtx)
+		}
+
+		goodStmts := []struct {
+			stmt Directive
+			term string
+			ctx  blockCtx
+		}{
+			{Directive{Directive: "limit_except", Args: []string{"GET"}}, "{", locCtx},
+			{Directive{Directive: "limit_except", Args: []string{"GET", "POST"}}, "{", locCtx},
+			{Directive{Directive: "deny", Args: []string{"all"}}, ";", lmtCtx},
+			{Directive{Directive: "proxy_pass", Args: []string{"http://backend"}}, ";", lmtCtx},
+		}
+		for _, good := range goodStmts {
+			if err := analyze(fname, good.stmt, good.term, good.ctx, &ParseOptions{}); err != nil {
+				t.Fatalf("expected err to be nil: %v", err)
+			}
+		}
+
+		badStmts := []struct {
+			stmt Directive
+			term string
+			ctx  blockCtx
+			what string
+		}{
+			{Directive{Directive: "limit_except", Args: []string{}}, "{", locCtx, `invalid number of arguments in "limit_except" directive`},
+			{Directive{Directive: "limit_except", Args: []string{"GET"}}, "{", blockCtx{"http", "server"}, `"limit_except" directive is not allowed here`},
+			{Directive{Directive: "root", Args: []string{"/srv"}}, ";", lmtCtx, `"root" directive is not allowed here`},
+		}
+		for _, bad := range badStmts {
+			if err := analyze(fname, bad.stmt, bad.term, bad.ctx, &ParseOptions{}); err == nil {
+				t.Fatalf("expected error to not be nil: %v", err)
+			} else if e, ok := err.(ParseError); !ok {
+				t.Fatalf("error was not a ParseError: %v", err)
+			} else if e.what != bad.what {
+				t.Fatalf("unexpected error message: %q", e.what)
+			}
+		}
+	})
+	// Check that every block directive, in every context that it's allowed
+	// in, opens a context that's either known or a key/value container, or
+	// holds Lua code.
+	t.Run("block-contexts", func(t *testing.T) {
+		for name, masks := range directives {
+			for _, mask := range masks {
+				if mask&ngxConfBlock == 0 || isLuaBlock(name) {
+					continue
+				}
+				for key, ctxMask := range contexts {
+					if mask&ctxMask == 0 {
+						continue
+					}
+					ctx := blockCtx{}
+					if key != "" {
+						ctx = strings.Split(key, ">")
+					}
+					inner := enterBlockCtx(Directive{Directive: name}, ctx)
+					if _, ok := contexts[inner.key()]; !ok && !isContainerCtx(inner) {
+						t.Errorf("%q block in %q opens unknown context %q", name, key, inner.key())
+					}
+				}
+			}
+		}
+	})
+
+	// Check that entering a block doesn't clobber a sibling's context.
+	t.Run("block-context-aliasing", func(t *testing.T) {
+		srvCtx := make(blockCtx, 2, 8)
+		copy(srvCtx, blockCtx{"http", "server"})
+		ifCtx := enterBlockCtx(Directive{Directive: "if"}, srvCtx)
+		enterBlockCtx(Directive{Directive: "types"}, srvCtx)
+		if got := ifCtx.key(); got != "http>server>if" {
+			t.Fatalf("expected if context to be unchanged but got %q", got)
+		}
+	})
+	// Check that partially defined directives have their contexts and
+	// terminators checked but not their arguments, unlike directives that
+	// take any number of arguments.
+	t.Run("unchecked-args", func(t *testing.T) {
+		blockMasks := []int{ngxHttpLocConf | ngxConfBlock | ngxConfUnchecked}
+		stmtMasks := []int{ngxHttpLocConf | ngxConfUnchecked}
+		locCtx := blockCtx{"http", "location"}
+		locMask := contexts[locCtx.key()]
+		checkIfs := &ParseOptions{ValidateIfConditions: true}
+
+		goodStmts := []struct {
+			stmt  Directive
+			term  string
+			masks []int
+		}{
+			{Directive{Directive: "partial_block", Args: []string{}}, "{", blockMasks},
+			{Directive{Directive: "partial_block", Args: []string{"a", "b", "c", "d", "e", "f", "g", "h"}}, "{", blockMasks},
+			{Directive{Directive: "partial_stmt", Args: []string{}}, ";", stmtMasks},
+			{Directive{Directive: "partial_stmt", Args: []string{"a", "b", "c", "d", "e", "f", "g", "h"}}, ";", stmtMasks},
+			{Directive{Directive: "if", Args: []string{"$a", "~~", "b"}}, "{", blockMasks},
+		}
+		for _, good := range goodStmts {
+			if err := checkMasks(fname, good.stmt, good.term, locMask, good.masks, checkIfs); err != nil {
+				t.Fatalf("expected err to be nil: %v", err)
+			}
+		}
+
+		badStmts := []struct {
+			stmt    Directive
+			term    string
+			ctxMask int
+			masks   []int
+			what    string
+		}{
+			{Directive{Directive: "partial_block", Args: []string{"a"}}, ";", locMask, blockMasks, `directive "partial_block" has no opening "{"`},
+			{Directive{Directive: "partial_stmt", Args: []string{"a"}}, "{", locMask, stmtMasks, `directive "partial_stmt" is not terminated by ";"`},
+			{Directive{Directive: "partial_stmt", Args: []string{"a"}}, ";", contexts["http"], stmtMasks, `"partial_stmt" directive is not allowed here`},
+			{Directive{Directive: "if", Args: []string{"$a", "~~", "b"}}, "{", locMask, []int{ngxHttpLocConf | ngxConfBlock | ngxConfAny}, `unexpected "~~" in "if" condition`},
+		}
+		for _, bad := range badStmts {
+			if err := checkMasks(fname, bad.stmt, bad.term, bad.ctxMask, bad.masks, checkIfs); err == nil {
+				t.Fatalf("expected error to not be nil: %v", err)
+			} else if e, ok := err.(ParseError); !ok {
+				t.Fatalf("error was not a ParseError: %v", err)
+			} else if e.what != bad.what {
+				t.Fatalf("unexpected error message: %q", e.what)
+			}
+		}
+
+		// the ValidateArgumentFormats validators are skipped too
+		if !argsUnchecked(stmtMasks, locCtx) {
+			t.Fatal("expected partial_stmt's arguments to be unchecked in a location")
+		}
+		if argsUnchecked(stmtMasks, blockCtx{"http"}) {
+			t.Fatal("expected partial_stmt's arguments to be checked outside of a location")
+		}
+		if argsUnchecked([]int{ngxHttpLocConf | ngxConfAny}, locCtx) {
+			t.Fatal("expected the arguments of a directive that takes any number to be checked")
+		}
+	})
+	// Check that directives whose names used to be misspelled in the table
+	// are known, and that no other names have the same kind of typo.
+	t.Run("directive-names", func(t *testing.T) {
+		httpCtx := blockCtx{"http"}
+		mailCtx := blockCtx{"mail"}
+		goodStmts := []struct {
+			stmt Directive
+			ctx  blockCtx
+		}{
+			{Directive{Directive: "auth_http_header", Args: []string{"X-Auth-Key", "secret"}}, mailCtx},
+			{Directive{Directive: "auth_http_pass_client_cert", Args: []string{"on"}}, mailCtx},
+			{Directive{Directive: "auth_http_timeout", Args: []string{"5s"}}, mailCtx},
+			{Directive{Directive: "fastcgi_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "fastcgi_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+			{Directive{Directive: "grpc_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "grpc_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+			{Directive{Directive: "gzip_http_version", Args: []string{"1.1"}}, httpCtx},
+			{Directive{Directive: "memcached_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "memcached_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+			{Directive{Directive: "proxy_http_version", Args: []string{"1.1"}}, httpCtx},
+			{Directive{Directive: "proxy_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "proxy_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+			{Directive{Directive: "scgi_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "scgi_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+			{Directive{Directive: "upstream_conf", Args: []string{}}, blockCtx{"http", "location"}},
+			{Directive{Directive: "uwsgi_next_upstream_timeout", Args: []string{"10s"}}, httpCtx},
+			{Directive{Directive: "uwsgi_next_upstream_tries", Args: []string{"2"}}, httpCtx},
+		}
+		for _, good := range goodStmts {
+			if err := analyze(fname, good.stmt, ";", good.ctx, &ParseOptions{ErrorOnUnknownDirectives: true}); err != nil {
+				t.Fatalf("expected err to be nil: %v", err)
+			}
+		}
+
+		for name := range directives {
+			if name != strings.ToLower(name) {
+				t.Errorf("directive name %q isn't lowercase", name)
+			}
+		}
+	})
+
+	// Check that the directives that are only known inside of a module's
+	// block, like "header" in otel_exporter, aren't known outside of it.
+	t.Run("block-directives", func(t *testing.T) {
+		for key := range blockDirectives {
+			if _, ok := contexts[key]; !ok {
+				t.Errorf("block directives are keyed by unknown context %q", key)
+			}
+		}
+
+		otelCtx := blockCtx{"http", "otel_exporter"}
+		locCtx := blockCtx{"http", "server", "location"}
+		strict := &ParseOptions{ErrorOnUnknownDirectives: true, SuggestDirectives: true}
+		header := Directive{Directive: "header", Args: []string{"X-Api-Key", "secret"}}
+		if err := analyze(fname, header, ";", otelCtx, strict); err != nil {
+			t.Fatalf("expected err to be nil: %v", err)
+		}
+		if err := analyze(fname, header, ";", locCtx, &ParseOptions{}); err != nil {
+			t.Fatalf("expected err to be nil: %v", err)
+		}
+		if err := analyze(fname, header, ";", locCtx, strict); err == nil {
+			t.Fatal("expected error to not be nil")
+		} else if e, ok := err.(ParseError); !ok {
+			t.Fatalf("error was not a ParseError: %v", err)
+		} else if e.what != `unknown directive "header"` {
+			t.Fatalf("unexpected error message: %q", e.what)
+		}
+		if err := analyze(fname, Directive{Directive: "gzip", Args: []string{"on"}}, ";", otelCtx, strict); err == nil {
+			t.Fatal("expected gzip to not be allowed in otel_exporter")
+		}
+	})
+
+	t.Run("if-conditions", func(t *testing.T) {
+		valid := [][]string{
+			{"$slow"},
+			{"$request_method", "=", "POST"},
+			{"$request_method", "!=", ""},
+			{"$http_user_agent", "~*", "MSIE"},
+			{"$uri", "!~", "^/api/"},
+			{"-f", "$request_filename"},
+			{"!-d", "$request_filename"},
+		}
+		for _, args := range valid {
+			if err := ValidateIfCondition(args); err != nil {
+				t.Errorf("expected %q to be valid but got %v", args, err)
+			}
+		}
+
+		invalid := []struct {
+			args     []string
+			expected string
+		}{
+			{[]string{}, `missing "if" condition`},
+			{[]string{"$host", "==", "example.com"}, `unexpected "==" in "if" condition`},
+			{[]string{"$host", "="}, `invalid "if" condition "$host ="`},
+			{[]string{"-f"}, `invalid "if" condition "-f"`},
+			{[]string{"!-x", "$a", "$b"}, `invalid "if" condition "!-x $a $b"`},
+			{[]string{"$"}, `invalid "if" condition "$", it must start with a variable or a file test`},
+		}
+		for _, bad := range invalid {
+			if err := ValidateIfCondition(bad.args); err == nil || err.Error() != bad.expected {
+				t.Errorf("expected error %q for %q but got %v", bad.expected, bad.args, err)
+			}
+		}
+	})
+
+	t.Run("mail-server-context", func(t *testing.T) {
+		ctx := enterBlockCtx(Directive{Directive: "server"}, blockCtx{"mail"})
+		if ctx.key() != "mail>server" || contexts[ctx.key()] != ngxMailSrvConf {
+			t.Fatalf("expected mail server context but got %v", ctx)
+		}
+
+		stmt := Directive{Directive: "protocol", Args: []string{"smtp"}, Line: 1}
+		if err := analyze(fname, stmt, ";", ctx, &ParseOptions{}); err != nil {
+			t.Fatalf("expected err to be nil: %v", err)
+		}
+		err := analyze(fname, stmt, ";", blockCtx{"mail"}, &ParseOptions{})
+		if err == nil || !strings.Contains(err.Error(), `"protocol" directive is not allowed here`) {
+			t.Fatalf("expected protocol to not be allowed in mail context but got %v", err)
+		}
+	})
+
+	t.Run("container-params", func(t *testing.T) {
+		tests := []struct {
+			ctx  blockCtx
+			stmt Directive
+			what string
+		}{
+			{blockCtx{"http", "map"}, Directive{Directive: "hostnames", Args: []string{}}, ""},
+			{blockCtx{"stream", "map"}, Directive{Directive: "volatile", Args: []string{}}, ""},
+			{blockCtx{"http", "geo"}, Directive{Directive: "ranges", Args: []string{}}, ""},
+			{blockCtx{"http", "geo"}, Directive{Directive: "default", Args: []string{"0"}}, ""},
+			{blockCtx{"http", "geo"}, Directive{Directive: "hostnames", Args: []string{}}, `"hostnames" is only allowed in "map" blocks`},
+			{blockCtx{"http", "map"}, Directive{Directive: "ranges", Args: []string{}}, `"ranges" is only allowed in "geo" blocks`},
+			{blockCtx{"http", "map"}, Directive{Directive: "default", Args: []string{}}, "invalid number of the map parameters"},
+			{blockCtx{"stream", "geo"}, Directive{Directive: "10.0.0.0/8", Args: []string{"a", "b"}}, "invalid number of the geo parameters"},
+			{blockCtx{"http", "split_clients"}, Directive{Directive: "50%", Args: []string{"a", "b"}}, ""},
+		}
+		for _, test := range tests {
+			err := analyze(fname, test.stmt, ";", test.ctx, &ParseOptions{})
+			if test.what == "" && err != nil {
+				t.Fatalf("expected %s in %v to be valid but got: %v", test.stmt.Directive, test.ctx, err)
+			}
+			if test.what != "" {
+				if e, ok := err.(ParseError); !ok || e.what != test.what {
+					t.Fatalf("expected %q for %s in %v but got: %v", test.what, test.stmt.Directive, test.ctx, err)
+				}
+			}
+		}
+	})
+}
+
+func TestDirectiveValidate(t *testing.T) {
+	tests := []struct {
+		directive Directive
+		ctx       []string
+		options   *ParseOptions
+		err       string
+	}{
+		{Directive{Directive: "listen", Args: []string{"80"}}, []string{"http", "server"}, nil, ""},
+		{Directive{Directive: "listen", Args: []string{"80"}}, []string{"http"}, nil, `"listen" directive is not allowed here`},
+		{Directive{Directive: "return", Args: []string{"200"}}, []string{"http", "server", "location", "location"}, nil, ""},
+		{Directive{Directive: "gzip", Args: []string{"yes"}, Line: 3}, []string{"http"}, nil, `invalid value "yes" in "gzip" directive, it must be "on" or "off" on line 3`},
+		{Directive{Directive: "server", Args: []string{}}, []string{"http"}, nil, `directive "server" has no opening "{"`},
+		{Directive{Directive: "server", Args: []string{}, Block: &[]Directive{}}, []string{"http"}, nil, ""},
+		{Directive{Directive: "events", Args: []string{"x"}, Block: &[]Directive{}}, []string{}, nil, `invalid number of arguments in "events" directive`},
+		{Directive{Directive: "foo", Args: []string{}}, []string{"http"}, nil, ""},
+		{Directive{Directive: "foo", Args: []string{}}, []string{"http"}, &ParseOptions{ErrorOnUnknownDirectives: true}, `unknown directive "foo"`},
+		{Directive{Directive: "listen", Args: []string{"80"}}, []string{"http"}, &ParseOptions{SkipDirectiveContextCheck: true}, ""},
+		{Directive{Directive: "#", Args: []string{}}, []string{"http"}, nil, ""},
+	}
+	for _, test := range tests {
+		err := test.directive.Validate(test.ctx, test.options)
+		if test.err == "" && err != nil {
+			t.Fatalf("expected %s in %v to be valid but got: %v", test.directive.Directive, test.ctx, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Fatalf("expected error %q for %s in %v but got: %v", test.err, test.directive.Directive, test.ctx, err)
+		}
+	}
 }
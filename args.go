@@ -0,0 +1,222 @@
+package crossplane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nginx's time units in the order that they have to appear in a value
+var timeUnits = []struct {
+	suffix string
+	scale  time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"M", 30 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// nginx's size units, which are case-insensitive
+var sizeUnits = map[byte]int64{
+	'k': 1 << 10,
+	'm': 1 << 20,
+	'g': 1 << 30,
+}
+
+// directives whose arguments are all sizes or all times, which NormalizeValue
+// can rewrite without changing what they mean
+var valueKinds = map[string]string{
+	"client_body_buffer_size":       "size",
+	"client_body_timeout":           "time",
+	"client_header_buffer_size":     "size",
+	"client_header_timeout":         "time",
+	"client_max_body_size":          "size",
+	"fastcgi_buffer_size":           "size",
+	"fastcgi_busy_buffers_size":     "size",
+	"fastcgi_connect_timeout":       "time",
+	"fastcgi_max_temp_file_size":    "size",
+	"fastcgi_read_timeout":          "time",
+	"fastcgi_send_timeout":          "time",
+	"grpc_buffer_size":              "size",
+	"grpc_connect_timeout":          "time",
+	"grpc_read_timeout":             "time",
+	"grpc_send_timeout":             "time",
+	"gzip_min_length":               "size",
+	"keepalive_time":                "time",
+	"keepalive_timeout":             "time",
+	"limit_rate_after":              "size",
+	"lingering_time":                "time",
+	"lingering_timeout":             "time",
+	"postpone_output":               "size",
+	"proxy_buffer_size":             "size",
+	"proxy_busy_buffers_size":       "size",
+	"proxy_connect_timeout":         "time",
+	"proxy_max_temp_file_size":      "size",
+	"proxy_read_timeout":            "time",
+	"proxy_send_timeout":            "time",
+	"proxy_temp_file_write_size":    "size",
+	"proxy_timeout":                 "time",
+	"resolver_timeout":              "time",
+	"scgi_buffer_size":              "size",
+	"send_timeout":                  "time",
+	"sendfile_max_chunk":            "size",
+	"ssl_buffer_size":               "size",
+	"ssl_session_timeout":           "time",
+	"subrequest_output_buffer_size": "size",
+	"uwsgi_buffer_size":             "size",
+	"uwsgi_connect_timeout":         "time",
+	"uwsgi_read_timeout":            "time",
+	"uwsgi_send_timeout":            "time",
+}
+
+// Arg returns the directive's i'th argument, or "" if it doesn't have one.
+func (d Directive) Arg(i int) string {
+	if i < 0 || i >= len(d.Args) {
+		return ""
+	}
+	return d.Args[i]
+}
+
+// ArgsString returns the directive's arguments joined by spaces.
+func (d Directive) ArgsString() string {
+	return strings.Join(d.Args, " ")
+}
+
+// DurationArg interprets the directive's i'th argument as an nginx time,
+// like "30s", "1h 30m", or "500ms". A number without a unit is in seconds.
+func (d Directive) DurationArg(i int) (time.Duration, error) {
+	if i < 0 || i >= len(d.Args) {
+		return 0, fmt.Errorf("%q directive has no argument %d", d.Directive, i)
+	}
+	return parseDuration(d.Args[i])
+}
+
+// SizeArg interprets the directive's i'th argument as an nginx size in
+// bytes, like "512", "8k", or "1m". Units are case-insensitive.
+func (d Directive) SizeArg(i int) (int64, error) {
+	if i < 0 || i >= len(d.Args) {
+		return 0, fmt.Errorf("%q directive has no argument %d", d.Directive, i)
+	}
+	return parseSize(d.Args[i])
+}
+
+// parseDuration parses a time the way nginx's ngx_parse_time does, where
+// each unit can be used once and units go from largest to smallest.
+func parseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := strings.TrimSpace(s)
+	next := 0 // index of the largest unit that can still be used
+	if rest == "" {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	for rest != "" {
+		n := 0
+		for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		value, err := strconv.ParseInt(rest[:n], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		rest = rest[n:]
+
+		// a number on its own is in seconds
+		scale := time.Second
+		unit := len(timeUnits) - 2 // the index of "s"
+		if rest != "" && !isSpace(rest[:1]) {
+			unit = -1
+			for j := next; j < len(timeUnits); j++ {
+				suffix := timeUnits[j].suffix
+				if strings.HasPrefix(rest, suffix) && !strings.HasPrefix(rest, suffix+"s") {
+					unit = j
+					break
+				}
+			}
+			if unit < 0 {
+				return 0, fmt.Errorf("invalid time %q", s)
+			}
+			scale = timeUnits[unit].scale
+			rest = rest[len(timeUnits[unit].suffix):]
+		} else if unit < next {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		next = unit + 1
+
+		total += time.Duration(value) * scale
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return total, nil
+}
+
+// parseSize parses a size the way nginx's ngx_parse_size does.
+func parseSize(s string) (int64, error) {
+	scale := int64(1)
+	num := s
+	if len(s) > 0 {
+		if unit, ok := sizeUnits[strings.ToLower(s[len(s)-1:])[0]]; ok {
+			scale = unit
+			num = s[:len(s)-1]
+		}
+	}
+	value, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || value < 0 || value > (1<<63-1)/scale {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return value * scale, nil
+}
+
+// NormalizeValue returns an argument of a directive in a canonical form if
+// it's a size or a time, so that values that mean the same thing compare
+// equal. Sizes are written in the largest unit that they're a whole number
+// of, like "10m" for "10240k", and times are too, using the units from "d"
+// down to "ms", like "90s" for "1m 30s" and "1h" for "60m". A bare number of
+// seconds gets an "s". Normalization is only applied to the directives that
+// are known to take nothing but sizes or nothing but times, like
+// client_max_body_size or proxy_read_timeout. Other directives' arguments,
+// and arguments that aren't valid values, like variables, are returned as
+// they are.
+func NormalizeValue(directive, arg string) string {
+	switch valueKinds[directive] {
+	case "size":
+		if n, err := parseSize(arg); err == nil {
+			return formatSize(n)
+		}
+	case "time":
+		if d, err := parseDuration(arg); err == nil {
+			return formatDuration(d)
+		}
+	}
+	return arg
+}
+
+func formatSize(n int64) string {
+	for _, unit := range []byte{'g', 'm', 'k'} {
+		if scale := sizeUnits[unit]; n != 0 && n%scale == 0 {
+			return strconv.FormatInt(n/scale, 10) + string(unit)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	// months and years are left out since they aren't really 30 and 365
+	// days, which leaves milliseconds as the smallest unit that nginx has
+	for _, unit := range timeUnits[3:] {
+		if d%unit.scale == 0 {
+			return strconv.FormatInt(int64(d/unit.scale), 10) + unit.suffix
+		}
+	}
+	return d.String()
+}
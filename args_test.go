@@ -0,0 +1,106 @@
+package crossplane
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDirectiveArgs(t *testing.T) {
+	d := Directive{Directive: "proxy_read_timeout", Args: []string{"90s", "8k", "1h 30m"}}
+
+	t.Run("arg", func(t *testing.T) {
+		if d.Arg(0) != "90s" || d.Arg(2) != "1h 30m" || d.Arg(3) != "" || d.Arg(-1) != "" {
+			t.Fatalf("unexpected args: %q %q %q %q", d.Arg(0), d.Arg(2), d.Arg(3), d.Arg(-1))
+		}
+		if s := d.ArgsString(); s != "90s 8k 1h 30m" {
+			t.Fatalf("unexpected args string: %q", s)
+		}
+	})
+
+	t.Run("out-of-range", func(t *testing.T) {
+		if _, err := d.DurationArg(3); err == nil {
+			t.Fatal("expected an error for a missing argument")
+		}
+		if _, err := d.SizeArg(-1); err == nil {
+			t.Fatal("expected an error for a missing argument")
+		}
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"30":        30 * time.Second,
+		"30s":       30 * time.Second,
+		"500ms":     500 * time.Millisecond,
+		"5m":        5 * time.Minute,
+		"1h30m":     90 * time.Minute,
+		"1h 30m":    90 * time.Minute,
+		"1d 12h":    36 * time.Hour,
+		"2w":        14 * 24 * time.Hour,
+		"1M":        30 * 24 * time.Hour,
+		"1y":        365 * 24 * time.Hour,
+		"1m 1s 1ms": time.Minute + time.Second + time.Millisecond,
+	}
+	for s, expected := range valid {
+		if d, err := parseDuration(s); err != nil || d != expected {
+			t.Errorf("parseDuration(%q): expected %v but got %v, %v", s, expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "s", "10x", "1s 1h", "1m 1m", "-5s", "5 s", "1.5h"} {
+		if d, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q): expected an error but got %v", s, d)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	valid := map[string]int64{
+		"0":    0,
+		"512":  512,
+		"8k":   8 << 10,
+		"8K":   8 << 10,
+		"1m":   1 << 20,
+		"100M": 100 << 20,
+		"2g":   2 << 30,
+	}
+	for s, expected := range valid {
+		if n, err := parseSize(s); err != nil || n != expected {
+			t.Errorf("parseSize(%q): expected %d but got %d, %v", s, expected, n, err)
+		}
+	}
+	for _, s := range []string{"", "k", "1.5m", "-1", "10b", "1kk", "9999999999999g"} {
+		if n, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q): expected an error but got %d", s, n)
+		}
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		directive, arg, normalized string
+	}{
+		{"client_max_body_size", "10240k", "10m"},
+		{"client_max_body_size", "10M", "10m"},
+		{"client_max_body_size", "1024m", "1g"},
+		{"client_max_body_size", "1536k", "1536k"},
+		{"client_max_body_size", "1000", "1000"},
+		{"client_max_body_size", "0", "0"},
+		{"proxy_buffer_size", "4096", "4k"},
+		{"proxy_read_timeout", "1m 30s", "90s"},
+		{"proxy_read_timeout", "60m", "1h"},
+		{"proxy_read_timeout", "90", "90s"},
+		{"proxy_read_timeout", "1500ms", "1500ms"},
+		{"proxy_read_timeout", "2000ms", "2s"},
+		{"ssl_session_timeout", "1w", "7d"},
+		{"keepalive_timeout", "0", "0s"},
+		{"proxy_read_timeout", "$timeout", "$timeout"},
+		{"client_max_body_size", "lots", "lots"},
+		{"limit_conn", "1024", "1024"},
+		{"expires", "60m", "60m"},
+	}
+	for _, test := range tests {
+		if normalized := NormalizeValue(test.directive, test.arg); normalized != test.normalized {
+			t.Fatalf("%s %s: expected %q but got %q", test.directive, test.arg, test.normalized, normalized)
+		}
+	}
+}
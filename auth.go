@@ -0,0 +1,131 @@
+package crossplane
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AuthRequestIssue is an auth_request directive whose target isn't handled
+// by an internal location, which either makes every request fail or lets
+// clients call the auth endpoint directly.
+type AuthRequestIssue struct {
+	File    string
+	Line    int
+	Target  string
+	Problem string
+
+	// The location that handles the target, or nil if there isn't one.
+	Location *Directive
+}
+
+// AuthRequestTargets checks that the URI of each auth_request directive is
+// handled by a location that's marked internal. For an auth_request inside
+// a server block, the locations of that server are used to find the one that
+// handles the URI, picking between exact, prefix, and regex locations the
+// way nginx does. For an auth_request outside of any server, like one in an
+// http block, the locations of every server are used. Nested locations are
+// treated as if they weren't nested, and regexes that Go can't compile are
+// skipped, so the results are a best-effort approximation. The Location
+// fields point into the payload's configs.
+func (p Payload) AuthRequestTargets() []AuthRequestIssue {
+	all := []*Directive{}
+	for _, server := range p.Servers() {
+		all = append(all, server.Directive)
+	}
+
+	issues := []AuthRequestIssue{}
+	for _, config := range p.Config {
+		checkAuthRequests(config.File, config.Parsed, all, &issues)
+	}
+	return issues
+}
+
+func checkAuthRequests(file string, block []Directive, servers []*Directive, issues *[]AuthRequestIssue) {
+	for i := range block {
+		d := &block[i]
+		if d.Directive == "auth_request" && len(d.Args) == 1 && d.Args[0] != "off" {
+			target := d.Args[0]
+			uri := strings.SplitN(target, "?", 2)[0]
+			issue := AuthRequestIssue{File: file, Line: d.Line, Target: target}
+			if loc := matchLocation(servers, uri); loc == nil {
+				issue.Problem = fmt.Sprintf(`no location handles auth_request target "%s"`, target)
+				*issues = append(*issues, issue)
+			} else if !hasDirective(*loc.Block, "internal") {
+				issue.Problem = fmt.Sprintf(`location "%s" for auth_request target "%s" is not internal`, strings.Join(loc.Args, " "), target)
+				issue.Location = loc
+				*issues = append(*issues, issue)
+			}
+		}
+		if d.Block != nil {
+			inner := servers
+			if d.Directive == "server" {
+				inner = []*Directive{d}
+			}
+			checkAuthRequests(file, *d.Block, inner, issues)
+		}
+	}
+}
+
+// matchLocation returns the location in the servers that nginx would use
+// for a request URI, or nil if none of them match.
+func matchLocation(servers []*Directive, uri string) *Directive {
+	var locations []*Directive
+	for _, server := range servers {
+		walkBlock(*server.Block, []string{}, func(ctx []string, d *Directive) bool {
+			if d.Directive == "location" && d.Block != nil && len(d.Args) > 0 {
+				locations = append(locations, d)
+			}
+			return true
+		})
+	}
+
+	// exact matches win, and otherwise the longest prefix is remembered
+	var prefix *Directive
+	var prefixLen int
+	var prefixStops bool
+	for _, loc := range locations {
+		modifier, path := "", loc.Args[0]
+		if len(loc.Args) > 1 {
+			modifier, path = loc.Args[0], loc.Args[1]
+		}
+		switch modifier {
+		case "=":
+			if path == uri {
+				return loc
+			}
+		case "", "^~":
+			if strings.HasPrefix(uri, path) && len(path) > prefixLen {
+				prefix, prefixLen, prefixStops = loc, len(path), modifier == "^~"
+			}
+		}
+	}
+	if prefixStops {
+		return prefix
+	}
+
+	// then regexes are checked in the order they appear
+	for _, loc := range locations {
+		if len(loc.Args) < 2 || (loc.Args[0] != "~" && loc.Args[0] != "~*") {
+			continue
+		}
+		expr := loc.Args[1]
+		if loc.Args[0] == "~*" {
+			expr = "(?i)" + expr
+		}
+		if re, err := regexp.Compile(expr); err == nil && re.MatchString(uri) {
+			return loc
+		}
+	}
+	return prefix
+}
+
+// hasDirective returns true if the block directly contains the directive.
+func hasDirective(block []Directive, name string) bool {
+	for _, d := range block {
+		if d.Directive == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuthRequestTargets(t *testing.T) {
+	path := filepath.Join("testdata", "auth-request", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := payload.AuthRequestTargets()
+
+	// check the locations separately, since they point into the payload
+	locationLines := []int{}
+	for i := range issues {
+		if issues[i].Location == nil {
+			locationLines = append(locationLines, 0)
+		} else {
+			locationLines = append(locationLines, issues[i].Location.Line)
+		}
+		issues[i].Location = nil
+	}
+
+	expected := []AuthRequestIssue{
+		AuthRequestIssue{
+			File:    path,
+			Line:    12,
+			Target:  "/nowhere",
+			Problem: `no location handles auth_request target "/nowhere"`,
+		},
+		AuthRequestIssue{
+			File:    path,
+			Line:    21,
+			Target:  "/validate?scope=admin",
+			Problem: `location "/validate" for auth_request target "/validate?scope=admin" is not internal`,
+		},
+		AuthRequestIssue{
+			File:    path,
+			Line:    23,
+			Target:  "/missing",
+			Problem: `location "/" for auth_request target "/missing" is not internal`,
+		},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, issues)
+	}
+	if expectedLines := []int{0, 25, 22}; !reflect.DeepEqual(locationLines, expectedLines) {
+		t.Fatalf("expected locations on lines %v but got %v", expectedLines, locationLines)
+	}
+}
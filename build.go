@@ -1,18 +1,75 @@
 package crossplane
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type BuildOptions struct {
 	Indent int
 	Tabs   bool
 	Header bool
+
+	// If set, determines whether the built config ends with a newline. If
+	// nil, Build doesn't add one and BuildFiles ends each file with exactly
+	// one newline.
+	FinalNewline *bool
+
+	// If true, a blank line is written before each top-level block directive,
+	// like http or stream, and before each server block, unless it's the
+	// first directive in its block or it comes right after a comment.
+	BlankLineBetweenBlocks bool
+
+	// If set, this is called to render each of a directive's arguments. It
+	// returns the rendered argument and true, or false to fall back to the
+	// default quoting.
+	QuoteFunc func(arg string) (string, bool)
+
+	// If set, this is called with each directive, other than comments, and
+	// the line that would be written for it, including its indentation and
+	// its ";" or " {". The line that it returns is written instead. The
+	// directives in a block and the block's closing "}" are written after
+	// it as usual.
+	DirectiveFormatter func(depth int, d Directive, defaultRendered string) string
+
+	// If positive, building fails with an error if a block directive is
+	// nested inside of more than MaxDepth-1 other blocks, so MaxDepth of 3
+	// allows http, server, and location blocks but not a location in a
+	// location. Depths are counted from the directives being built.
+	MaxDepth int
+
+	// If positive, the "#" of each comment that's written on the same line
+	// as a directive is moved to this column, counting from 1, by padding
+	// the line with spaces. If the line is already too long for that, the
+	// comment comes after a single space like it does by default. Columns
+	// are counted in characters, so each tab of an indentation counts as
+	// one column.
+	AlignInlineComments int
+
+	// The quoting dialect to build args with, for nginx versions whose
+	// lexers are stricter than crossplane's about unquoted args. It's ""
+	// by default, which only quotes args that nginx couldn't read back
+	// otherwise. "conservative" also quotes any arg with a "{", "}", ";", or
+	// "#" in it, wherever the character is, like "${host}" or "a#b".
+	// QuoteFunc is still called first. Building fails with an error for
+	// other values.
+	NginxQuoteCompat string
+}
+
+// the dialects that BuildOptions.NginxQuoteCompat can be set to
+var quoteCompats = []string{"", "conservative"}
+
+// DefaultBuildOptions returns the options that Build uses when none are set,
+// which indent each block with four spaces.
+func DefaultBuildOptions() *BuildOptions {
+	return &BuildOptions{Indent: 4}
 }
 
 // BuildFiles builds all of the config files in a crossplane.Payload and
@@ -50,7 +107,10 @@ func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 		}
 		defer f.Close()
 
-		output := append(bytes.TrimRightFunc(buf.Bytes(), unicode.IsSpace), '\n')
+		output := bytes.TrimRightFunc(buf.Bytes(), unicode.IsSpace)
+		if options.FinalNewline == nil || *options.FinalNewline {
+			output = append(output, '\n')
+		}
 		if _, err := f.Write(output); err != nil {
 			return err
 		}
@@ -59,66 +119,207 @@ func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 	return nil
 }
 
-// Build creates an NGINX config from a crossplane.Config.
+// Build creates an NGINX config from a crossplane.Config. The config is
+// written to w as it's built, so that the whole thing is never in memory.
+// Building fails with an error if an argument can't be written in a way that
+// nginx would read back, like one that ends in a backslash or that has a
+// carriage return in it.
 func Build(w io.Writer, config Config, options *BuildOptions) error {
-	if options.Indent == 0 {
-		options.Indent = 4
+	b := newBuilder(w, options)
+
+	if b.options.Header {
+		b.w.WriteString("# This config was built from JSON using NGINX crossplane.\n")
+		b.w.WriteString("# If you encounter any bugs please report them here:\n")
+		b.w.WriteString("# https://github.com/nginxinc/crossplane/issues\n")
+		b.w.WriteString("\n")
+	}
+
+	return b.build(config.Parsed, 0)
+}
+
+// BuildDirectives writes a list of directives the way that Build would if
+// they were nested startDepth blocks deep in a config, which is useful for
+// showing part of a config, like a single server or location block. The
+// Header option is ignored, since the result isn't a whole file.
+func BuildDirectives(w io.Writer, directives []Directive, startDepth int, options *BuildOptions) error {
+	if startDepth < 0 {
+		return fmt.Errorf("invalid depth %d", startDepth)
+	}
+	return newBuilder(w, options).build(directives, startDepth)
+}
+
+// RoundTripStable parses the config read from src, builds it, and then parses
+// the result again. It returns true if both parses produced equal configs,
+// along with the built config so that any differences can be inspected. If
+// src is a file, like an *os.File, its includes are found relative to the
+// file's directory, and otherwise relative to the working directory. Nil
+// options are the same as the default options.
+func RoundTripStable(src io.Reader, parseOpts *ParseOptions, buildOpts *BuildOptions) (bool, string, error) {
+	if parseOpts == nil {
+		parseOpts = DefaultParseOptions()
+	}
+	if buildOpts == nil {
+		buildOpts = DefaultBuildOptions()
+	}
+	filename := "nginx.conf"
+	if f, ok := src.(interface{ Name() string }); ok {
+		filename = f.Name()
+	}
+
+	parsed, err := parseReader(src, filename, parseOpts)
+	if err != nil {
+		return false, "", err
+	}
+
+	var buf bytes.Buffer
+	if err := Build(&buf, parsed.Config[0], buildOpts); err != nil {
+		return false, "", err
 	}
+	built := buf.String()
 
-	head := ""
-	if options.Header {
-		head += "# This config was built from JSON using NGINX crossplane.\n"
-		head += "# If you encounter any bugs please report them here:\n"
-		head += "# https://github.com/nginxinc/crossplane/issues\n"
-		head += "\n"
+	reparsed, err := parseReader(strings.NewReader(built), filename, parseOpts)
+	if err != nil {
+		return false, built, err
 	}
 
-	body := ""
-	body = buildBlock(body, config.Parsed, 0, 0, options)
-	_, err := w.Write([]byte(head + body))
-	return err
+	return parsed.Config[0].Equal(reparsed.Config[0]), built, nil
 }
 
-func buildBlock(output string, block []Directive, depth int, lastLine int, options *BuildOptions) string {
-	for _, stmt := range block {
-		var built string
+// builder writes a config to a buffered writer as it's being built.
+type builder struct {
+	w       *bufio.Writer
+	options *BuildOptions
+	started bool // true once the first directive has been written
+	width   int  // the number of characters on the line being written
+}
+
+func newBuilder(w io.Writer, options *BuildOptions) *builder {
+	// use a copy so that the caller's options are never changed
+	opts := *options
+	if opts.Indent == 0 {
+		opts.Indent = DefaultBuildOptions().Indent
+	}
+	return &builder{w: bufio.NewWriter(w), options: &opts}
+}
+
+func (b *builder) build(block []Directive, depth int) error {
+	if !contains(quoteCompats, b.options.NginxQuoteCompat) {
+		return fmt.Errorf(`unknown quote compat "%s"`, b.options.NginxQuoteCompat)
+	}
+	if b.options.MaxDepth > 0 {
+		if err := checkDepth(block, 1, b.options.MaxDepth); err != nil {
+			return err
+		}
+	}
+
+	if err := b.buildBlock(block, depth, 0); err != nil {
+		return err
+	}
+	if b.options.FinalNewline != nil && *b.options.FinalNewline {
+		b.w.WriteString("\n")
+	}
 
+	// bufio.Writer holds on to the first write error, so Flush returns it
+	return b.w.Flush()
+}
+
+func (b *builder) buildBlock(block []Directive, depth int, lastLine int) error {
+	for i, stmt := range block {
 		if stmt.IsComment() && stmt.Line == lastLine {
-			output += " #" + *stmt.Comment
+			pad := " "
+			if col := b.options.AlignInlineComments; col-1 > b.width {
+				pad = strings.Repeat(" ", col-1-b.width)
+			}
+			b.write(pad + "#" + *stmt.Comment)
 			continue
-		} else if stmt.IsComment() {
-			built = "#" + *stmt.Comment
+		}
+
+		if b.started {
+			b.write("\n")
+			if b.options.BlankLineBetweenBlocks && i > 0 && !block[i-1].IsComment() &&
+				stmt.Block != nil && (depth == 0 || stmt.Directive == "server") {
+				b.write("\n")
+			}
+		}
+		b.started = true
+
+		if stmt.IsComment() {
+			b.write(margin(b.options, depth) + "#" + *stmt.Comment)
 		} else {
-			directive := enquote(stmt.Directive)
-			args := []string{}
-			for _, arg := range stmt.Args {
-				args = append(args, enquote(arg))
+			directive, ok := quote(stmt.Directive)
+			if !ok {
+				return fmt.Errorf("directive %q on line %d can't be built in a way that nginx would read back", stmt.Directive, stmt.Line)
+			}
+			// the last arg of a Lua directive without a block is its Lua code
+			args, plain := []string{}, stmt.Args
+			if stmt.Block == nil && isLuaBlock(stmt.Directive) && len(plain) > 0 {
+				plain = plain[:len(plain)-1]
+			}
+			for _, arg := range plain {
+				quoted, ok := quoteArg(arg, b.options)
+				if !ok {
+					return fmt.Errorf(`"%s" directive on line %d has an argument that can't be built in a way that nginx would read back: %q`, stmt.Directive, stmt.Line, arg)
+				}
+				args = append(args, quoted)
 			}
 
+			line := margin(b.options, depth)
 			if directive == "if" {
-				built = "if (" + strings.Join(args, " ") + ")"
+				line += "if (" + strings.Join(args, " ") + ")"
 			} else if len(args) > 0 {
-				built = directive + " " + strings.Join(args, " ")
+				line += directive + " " + strings.Join(args, " ")
 			} else {
-				built = directive
+				line += directive
 			}
-
-			if stmt.Block == nil {
-				built += ";"
+			if len(plain) < len(stmt.Args) {
+				line += " {" + stmt.Args[len(plain)] + "}"
+			} else if stmt.Block == nil {
+				line += ";"
 			} else {
-				built += " {"
-				built = buildBlock(built, *stmt.Block, depth+1, stmt.Line, options)
-				built += "\n" + margin(options, depth) + "}"
+				line += " {"
+			}
+
+			if b.options.DirectiveFormatter != nil {
+				line = b.options.DirectiveFormatter(depth, stmt, line)
+			}
+			b.write(line)
+
+			if stmt.Block != nil {
+				if err := b.buildBlock(*stmt.Block, depth+1, stmt.Line); err != nil {
+					return err
+				}
+				b.write("\n" + margin(b.options, depth) + "}")
 			}
 		}
-		if len(output) > 0 {
-			output += "\n"
-		}
-		output += margin(options, depth) + built
 		lastLine = stmt.Line
 	}
+	return nil
+}
 
-	return output
+// write writes a string and keeps track of how wide the current line is.
+func (b *builder) write(s string) {
+	b.w.WriteString(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		b.width, s = 0, s[i+1:]
+	}
+	b.width += utf8.RuneCountInString(s)
+}
+
+// checkDepth returns an error if a block directive in the block is nested
+// deeper than the max, which stops it from recursing any deeper than that.
+func checkDepth(block []Directive, depth int, max int) error {
+	for _, stmt := range block {
+		if stmt.Block == nil {
+			continue
+		}
+		if depth > max {
+			return fmt.Errorf(`"%s" directive on line %d is nested more than %d blocks deep`, stmt.Directive, stmt.Line, max)
+		}
+		if err := checkDepth(*stmt.Block, depth+1, max); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func margin(options *BuildOptions, depth int) string {
@@ -128,12 +329,93 @@ func margin(options *BuildOptions, depth int) string {
 	return strings.Repeat(" ", options.Indent*depth)
 }
 
+// quoteArg returns an argument the way that the options say to write it, or
+// false if there's no way to write it that the lexer could read back.
+func quoteArg(arg string, options *BuildOptions) (string, bool) {
+	if options.QuoteFunc != nil {
+		if quoted, ok := options.QuoteFunc(arg); ok {
+			return quoted, true
+		}
+	}
+	if options.NginxQuoteCompat == "conservative" && strings.ContainsAny(arg, "{};#") {
+		if quoted, ok := quoteAny(arg); ok {
+			return quoted, true
+		}
+	}
+	return quote(arg)
+}
+
+// enquote returns an argument the way that Build would write it, for showing
+// args to people. Build fails for args that the lexer can't read back no
+// matter how they're written, but enquote shows those as Go-style strings.
 func enquote(arg string) string {
+	if quoted, ok := quote(arg); ok {
+		return quoted
+	}
+	// the lexer has no way to read this argument back, so do our best
+	return strings.ReplaceAll(repr(arg), `\\`, `\`)
+}
+
+// quote returns an argument the way that it should be written in a config
+// file, or false if the lexer couldn't read the argument back no matter how
+// it was written.
+func quote(arg string) (string, bool) {
+	// the lexer drops carriage returns wherever they are
+	if strings.ContainsRune(arg, '\r') {
+		return "", false
+	}
 	if !needsQuotes(arg) {
-		return arg
+		return arg, true
+	}
+	return quoteAny(arg)
+}
+
+// quoteAny wraps an argument in quotes, or returns false if the lexer
+// couldn't read it back that way.
+func quoteAny(arg string) (string, bool) {
+	// prefer single quotes when there are double quotes to avoid escaping
+	quotes := []rune{'"', '\''}
+	if strings.ContainsRune(arg, '"') {
+		quotes = []rune{'\'', '"'}
+	}
+	for _, q := range quotes {
+		if quoted, ok := quoteWith(arg, q); ok {
+			return quoted, true
+		}
+	}
+	return "", false
+}
+
+// quoteWith wraps an argument in the given quote character, escaping it
+// where it appears in the argument. Inside of quotes the lexer keeps every
+// character as it is, except that it reads an escaped quote as just the
+// quote and drops carriage returns, so arguments with carriage returns or
+// with a backslash before a quote or at the end can't be quoted this way.
+func quoteWith(arg string, q rune) (string, bool) {
+	var b strings.Builder
+	b.WriteRune(q)
+	runes := []rune(arg)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\r':
+			return "", false
+		case '\\':
+			// the lexer keeps a backslash and the character after it together
+			if i+1 == len(runes) || runes[i+1] == q || runes[i+1] == '\r' {
+				return "", false
+			}
+			b.WriteRune(r)
+			b.WriteRune(runes[i+1])
+			i++
+		case q:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
 	}
-	quoted := strings.ReplaceAll(repr(arg), `\\`, `\`)
-	return quoted
+	b.WriteRune(q)
+	return b.String(), true
 }
 
 func needsQuotes(s string) bool {
@@ -154,7 +436,7 @@ func needsQuotes(s string) bool {
 	char = chars[0]
 	chars = chars[1:]
 
-	if isSpace(char) || char == "{" || char == "}" || char == ";" || char == `"` || char == "'" || char == "${" {
+	if isSpace(char) || char == "{" || char == "}" || char == ";" || char == `"` || char == "'" || char == "${" || char == "#" {
 		return true
 	}
 
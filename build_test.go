@@ -3,10 +3,14 @@ package crossplane
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -251,6 +255,174 @@ var buildFixtures = []buildFixture{
 		},
 		expected: "#comment1\nuser root; #comment2 #comment3",
 	},
+	buildFixture{
+		name:    "with-final-newline",
+		options: BuildOptions{FinalNewline: pBool(true)},
+		parsed: []Directive{
+			Directive{
+				Directive: "user",
+				Line:      1,
+				Args:      []string{"root"},
+			},
+		},
+		expected: "user root;\n",
+	},
+	buildFixture{
+		name: "with-quote-func",
+		options: BuildOptions{QuoteFunc: func(arg string) (string, bool) {
+			if strings.HasPrefix(arg, "$") {
+				return `"` + arg + `"`, true
+			}
+			return "", false
+		}},
+		parsed: []Directive{
+			Directive{
+				Directive: "add_header",
+				Line:      1,
+				Args:      []string{"X-Foo", "$host", "foo bar"},
+			},
+		},
+		expected: `add_header X-Foo "$host" "foo bar";`,
+	},
+	buildFixture{
+		name:    "with-conservative-quoting",
+		options: BuildOptions{NginxQuoteCompat: "conservative"},
+		parsed: []Directive{
+			Directive{Directive: "set", Line: 1, Args: []string{"$a", "${host}.example.com"}},
+			Directive{Directive: "return", Line: 2, Args: []string{"200", "a#b"}},
+			Directive{Directive: "add_header", Line: 3, Args: []string{"X-Foo", `{"a":1}`}},
+			Directive{Directive: "location", Line: 4, Args: []string{"~", "^/a{2}$"}, Block: &[]Directive{}},
+		},
+		expected: strings.Join([]string{
+			`set $a "${host}.example.com";`,
+			`return 200 "a#b";`,
+			`add_header X-Foo '{"a":1}';`,
+			`location ~ "^/a{2}$" {`,
+			"}",
+		}, "\n"),
+	},
+	buildFixture{
+		name:    "if-return-oneliners",
+		options: BuildOptions{},
+		parsed: []Directive{
+			Directive{Directive: "if", Line: 1, Args: []string{"$http_user_agent", "~*", "bad bot"}, Block: &[]Directive{
+				Directive{Directive: "return", Line: 1, Args: []string{"403"}},
+			}},
+			Directive{Directive: "if", Line: 2, Args: []string{"-f", "$request_filename"}, Block: &[]Directive{
+				Directive{Directive: "break", Line: 2, Args: []string{}},
+			}},
+			Directive{Directive: "return", Line: 3, Args: []string{"200", "hello world"}},
+			Directive{Directive: "return", Line: 4, Args: []string{"301", "$scheme://example.com$request_uri"}},
+		},
+		expected: strings.Join([]string{
+			`if ($http_user_agent ~* "bad bot") {`,
+			"    return 403;",
+			"}",
+			"if (-f $request_filename) {",
+			"    break;",
+			"}",
+			`return 200 "hello world";`,
+			"return 301 $scheme://example.com$request_uri;",
+		}, "\n"),
+	},
+	buildFixture{
+		name:    "with-blank-lines-between-blocks",
+		options: BuildOptions{BlankLineBetweenBlocks: true},
+		parsed: []Directive{
+			Directive{Directive: "user", Line: 1, Args: []string{"nginx"}},
+			Directive{Directive: "events", Line: 2, Args: []string{}, Block: &[]Directive{}},
+			Directive{Directive: "#", Line: 3, Args: []string{}, Comment: pStr(" web")},
+			Directive{Directive: "http", Line: 4, Args: []string{}, Block: &[]Directive{
+				Directive{Directive: "server", Line: 5, Args: []string{}, Block: &[]Directive{
+					Directive{Directive: "listen", Line: 6, Args: []string{"80"}},
+				}},
+				Directive{Directive: "server", Line: 7, Args: []string{}, Block: &[]Directive{
+					Directive{Directive: "listen", Line: 8, Args: []string{"81"}},
+					Directive{Directive: "location", Line: 9, Args: []string{"/"}, Block: &[]Directive{}},
+				}},
+			}},
+		},
+		expected: strings.Join([]string{
+			"user nginx;",
+			"",
+			"events {",
+			"}",
+			"# web",
+			"http {",
+			"    server {",
+			"        listen 80;",
+			"    }",
+			"",
+			"    server {",
+			"        listen 81;",
+			"        location / {",
+			"        }",
+			"    }",
+			"}",
+		}, "\n"),
+	},
+	buildFixture{
+		name:    "align-inline-comments",
+		options: BuildOptions{AlignInlineComments: 25},
+		parsed: []Directive{
+			Directive{
+				Directive: "server",
+				Args:      []string{},
+				Line:      1,
+				Block: &[]Directive{
+					Directive{Directive: "#", Args: []string{}, Line: 1, Comment: pStr("server")},
+					Directive{Directive: "listen", Args: []string{"80"}, Line: 2},
+					Directive{Directive: "#", Args: []string{}, Line: 2, Comment: pStr("http")},
+					Directive{Directive: "#", Args: []string{}, Line: 2, Comment: pStr("again")},
+					Directive{Directive: "server_name", Args: []string{"a-very-long-name.example.com"}, Line: 3},
+					Directive{Directive: "#", Args: []string{}, Line: 3, Comment: pStr("too long")},
+					Directive{Directive: "#", Args: []string{}, Line: 4, Comment: pStr(" own line")},
+					Directive{Directive: "root", Args: []string{"/var/www"}, Line: 5},
+					Directive{Directive: "#", Args: []string{}, Line: 5, Comment: pStr("ünïcode")},
+				},
+			},
+		},
+		expected: strings.Join([]string{
+			"server {                #server",
+			"    listen 80;          #http #again",
+			"    server_name a-very-long-name.example.com; #too long",
+			"    # own line",
+			"    root /var/www;      #ünïcode",
+			"}",
+		}, "\n"),
+	},
+	buildFixture{
+		name: "directive-formatter",
+		options: BuildOptions{
+			// align the values of proxy_set_header and leave the rest alone
+			DirectiveFormatter: func(depth int, d Directive, line string) string {
+				if d.Directive != "proxy_set_header" || len(d.Args) != 2 {
+					return line
+				}
+				return fmt.Sprintf("%s%s %-16s %s;", strings.Repeat("    ", depth), d.Directive, d.Args[0], d.Args[1])
+			},
+		},
+		parsed: []Directive{
+			Directive{
+				Directive: "location",
+				Args:      []string{"/"},
+				Block: &[]Directive{
+					Directive{Directive: "proxy_set_header", Args: []string{"Host", "$host"}},
+					Directive{Directive: "proxy_set_header", Args: []string{"X-Real-IP", "$remote_addr"}},
+					Directive{Directive: "proxy_set_header", Args: []string{"X-Forwarded-For", "$proxy_add_x_forwarded_for"}},
+					Directive{Directive: "proxy_pass", Args: []string{"http://backend"}},
+				},
+			},
+		},
+		expected: strings.Join([]string{
+			"location / {",
+			"    proxy_set_header Host             $host;",
+			"    proxy_set_header X-Real-IP        $remote_addr;",
+			"    proxy_set_header X-Forwarded-For  $proxy_add_x_forwarded_for;",
+			"    proxy_pass http://backend;",
+			"}",
+		}, "\n"),
+	},
 }
 
 func TestBuild(t *testing.T) {
@@ -268,6 +440,72 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestBuildOptions(t *testing.T) {
+	config := Config{Parsed: []Directive{
+		Directive{Directive: "events", Args: []string{}, Block: &[]Directive{
+			Directive{Directive: "worker_connections", Args: []string{"1024"}},
+		}},
+	}}
+
+	t.Run("not-mutated", func(t *testing.T) {
+		options := BuildOptions{}
+		var buf bytes.Buffer
+		if err := Build(&buf, config, &options); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(options, BuildOptions{}) {
+			t.Fatalf("expected options to be unchanged but got %+v", options)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		var dflt, zero bytes.Buffer
+		if err := Build(&dflt, config, DefaultBuildOptions()); err != nil {
+			t.Fatal(err)
+		}
+		if err := Build(&zero, config, &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if dflt.String() != zero.String() {
+			t.Fatalf("expected: %#v\nbut got: %#v", zero.String(), dflt.String())
+		}
+
+		// the default parse options are explicit, but parse like the zero value
+		path := filepath.Join("testdata", "includes-regular", "nginx.conf")
+		dfltPayload, err := Parse(path, DefaultParseOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		zeroPayload, err := Parse(path, &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dfltPayload, zeroPayload) {
+			t.Fatalf("expected: %+v\nbut got: %+v", zeroPayload, dfltPayload)
+		}
+	})
+
+	t.Run("shared-concurrently", func(t *testing.T) {
+		// run with -race to catch Build writing to the shared options
+		options := &BuildOptions{}
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var buf bytes.Buffer
+				if err := Build(&buf, config, options); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if options.Indent != 0 {
+			t.Fatalf("expected shared options to be unchanged but got %+v", options)
+		}
+	})
+}
+
 var buildFilesFixtures = []buildFilesFixture{
 	buildFilesFixture{
 		name:    "with-missing-status-and-errors",
@@ -311,6 +549,142 @@ var buildFilesFixtures = []buildFilesFixture{
 		},
 		expected: "user 測試;\n",
 	},
+	buildFilesFixture{
+		name:    "without-final-newline",
+		options: BuildOptions{FinalNewline: pBool(false)},
+		payload: Payload{
+			Config: []Config{
+				Config{
+					File: "nginx.conf",
+					Parsed: []Directive{
+						Directive{
+							Directive: "user",
+							Line:      1,
+							Args:      []string{"nginx"},
+						},
+					},
+				},
+			},
+		},
+		expected: "user nginx;",
+	},
+}
+
+func TestBuildDirectives(t *testing.T) {
+	location := []Directive{
+		Directive{Directive: "location", Args: []string{"/api"}, Line: 1, Block: &[]Directive{
+			Directive{Directive: "proxy_pass", Args: []string{"http://backend"}, Line: 2},
+			Directive{Directive: "#", Args: []string{}, Line: 2, Comment: pStr(" upstream")},
+			Directive{Directive: "if", Args: []string{"$http_x_debug", "=", "1"}, Line: 3, Block: &[]Directive{
+				Directive{Directive: "return", Args: []string{"204"}, Line: 4},
+			}},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		depth    int
+		options  BuildOptions
+		expected string
+	}{
+		{
+			"top-level",
+			0,
+			BuildOptions{},
+			"location /api {\n" +
+				"    proxy_pass http://backend; # upstream\n" +
+				"    if ($http_x_debug = 1) {\n" +
+				"        return 204;\n" +
+				"    }\n" +
+				"}",
+		},
+		{
+			"nested",
+			2,
+			BuildOptions{Indent: 2, FinalNewline: pBool(true)},
+			"    location /api {\n" +
+				"      proxy_pass http://backend; # upstream\n" +
+				"      if ($http_x_debug = 1) {\n" +
+				"        return 204;\n" +
+				"      }\n" +
+				"    }\n",
+		},
+		{
+			"tabs-without-header",
+			1,
+			BuildOptions{Tabs: true, Header: true},
+			"\tlocation /api {\n" +
+				"\t\tproxy_pass http://backend; # upstream\n" +
+				"\t\tif ($http_x_debug = 1) {\n" +
+				"\t\t\treturn 204;\n" +
+				"\t\t}\n" +
+				"\t}",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := BuildDirectives(&buf, location, test.depth, &test.options); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.expected {
+				t.Fatalf("expected: %#v\nbut got: %#v", test.expected, got)
+			}
+		})
+	}
+
+	t.Run("negative-depth", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := BuildDirectives(&buf, location, -1, &BuildOptions{}); err == nil {
+			t.Fatal("expected an error for a negative depth")
+		}
+	})
+}
+
+func TestBuildUnknownQuoteCompat(t *testing.T) {
+	var buf bytes.Buffer
+	config := Config{Parsed: []Directive{Directive{Directive: "user", Args: []string{"nginx"}}}}
+	err := Build(&buf, config, &BuildOptions{NginxQuoteCompat: "1.0"})
+	if expected := `unknown quote compat "1.0"`; err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q but got %v", expected, err)
+	}
+}
+
+func TestBuildMaxDepth(t *testing.T) {
+	// a location in a location in a server in http
+	config := Config{Parsed: []Directive{
+		Directive{Directive: "http", Args: []string{}, Line: 1, Block: &[]Directive{
+			Directive{Directive: "server", Args: []string{}, Line: 2, Block: &[]Directive{
+				Directive{Directive: "location", Args: []string{"/"}, Line: 3, Block: &[]Directive{
+					Directive{Directive: "location", Args: []string{"/a"}, Line: 4, Block: &[]Directive{
+						Directive{Directive: "return", Args: []string{"204"}, Line: 5},
+					}},
+				}},
+			}},
+		}},
+	}}
+
+	var buf bytes.Buffer
+	if err := Build(&buf, config, &BuildOptions{MaxDepth: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	err := Build(&buf, config, &BuildOptions{MaxDepth: 3})
+	if expected := `"location" directive on line 4 is nested more than 3 blocks deep`; err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q but got %v", expected, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written but got %q", buf.String())
+	}
+
+	// depths are counted from the directives being built
+	server := (*config.Parsed[0].Block)[0:1]
+	if err := BuildDirectives(&buf, server, 1, &BuildOptions{MaxDepth: 3}); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestBuildFiles(t *testing.T) {
@@ -346,7 +720,34 @@ var compareFixtures = []compareFixture{
 	compareFixture{"empty-value-map", ParseOptions{}},
 	compareFixture{"russian-text", ParseOptions{}},
 	compareFixture{"quoted-right-brace", ParseOptions{}},
+	compareFixture{"lua-block-larger", ParseOptions{RawLuaBlocks: true, SkipDirectiveContextCheck: true}},
+	compareFixture{"lua-block-tricky", ParseOptions{RawLuaBlocks: true}},
+	compareFixture{"lua-block-long-brackets", ParseOptions{RawLuaBlocks: true, ErrorOnUnknownDirectives: true}},
 	compareFixture{"directive-with-space", ParseOptions{}},
+	compareFixture{"flag-or-path", ParseOptions{}},
+	compareFixture{"otel", ParseOptions{}},
+	compareFixture{"stream-map", ParseOptions{}},
+	compareFixture{"modsecurity", ParseOptions{}},
+	compareFixture{"deprecated", ParseOptions{}},
+	compareFixture{"escaped-braces", ParseOptions{}},
+	compareFixture{"real-ip", ParseOptions{}},
+	compareFixture{"undefined-upstreams", ParseOptions{}},
+	compareFixture{"directive-names", ParseOptions{}},
+	compareFixture{"comments-before-brace", ParseOptions{}},
+	compareFixture{"comments-before-brace", ParseOptions{ParseComments: true}},
+	compareFixture{"stream-ssl-preread", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"webdav", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"mail-proxy", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"ssl-dual-certs", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"quoted-escapes", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"geoip2", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"empty", ParseOptions{}},
+	compareFixture{"whitespace-only", ParseOptions{}},
+	compareFixture{"comments-only", ParseOptions{ParseComments: true}},
+	compareFixture{"stream-njs", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"ssl-dynamic-certs", ParseOptions{ErrorOnUnknownDirectives: true}},
+	compareFixture{"map-geo-params", ParseOptions{SingleFile: true, ErrorOnUnknownDirectives: true}},
+	compareFixture{"if-return-oneliners", ParseOptions{ErrorOnUnknownDirectives: true}},
 }
 
 func TestCompareParsedAndBuilt(t *testing.T) {
@@ -499,3 +900,146 @@ func equalDirectives(d1, d2 Directive) bool {
 	}
 	return true
 }
+
+func TestRoundTripStable(t *testing.T) {
+	for _, fixture := range compareFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", fixture.name, "nginx.conf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			stable, built, err := RoundTripStable(file, &fixture.options, &BuildOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !stable {
+				t.Fatalf("config was not stable after building:\n%s", built)
+			}
+		})
+	}
+}
+
+func TestRoundTripStableIncludes(t *testing.T) {
+	// includes are found relative to the file, not the working directory
+	path := filepath.Join("testdata", "includes-globbed", "nginx.conf")
+	for _, options := range []*ParseOptions{nil, &ParseOptions{StopParsingOnError: true}} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stable, built, err := RoundTripStable(file, options, nil)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stable {
+			t.Fatalf("config was not stable after building:\n%s", built)
+		}
+	}
+}
+
+func TestContainerIncludesRoundTrip(t *testing.T) {
+	// the included entries can only be built once they're combined into the
+	// main config, because built configs are parsed away from their includes
+	path := filepath.Join("testdata", "container-includes", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{CombineConfigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Build(&buf, payload.Config[0], &BuildOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{"text/css css;", "api.example.com api;", "10.0.0.0/8 RU;"} {
+		if !strings.Contains(buf.String(), entry) {
+			t.Fatalf("expected built config to contain %q:\n%s", entry, buf.String())
+		}
+	}
+
+	stable, built, err := RoundTripStable(&buf, &ParseOptions{}, &BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stable {
+		t.Fatalf("config was not stable after building:\n%s", built)
+	}
+}
+
+func TestBuildArgsRoundTrip(t *testing.T) {
+	// these characters are the ones that the lexer treats specially
+	alphabet := []rune{'a', 'b', ' ', '\t', '\n', '\r', '"', '\'', '\\', '$', '{', '}', ';', '#', '(', ')', 'ж'}
+	rng := rand.New(rand.NewSource(1))
+
+	args := []string{"", `"`, `'`, "${", "$", `\`, "a$", `a\`, " ", "\t", "\n", "\r", "a\rb", "#", "a#", "${a}", "${a", "a}", `\"'`}
+	for i := 0; i < 5000; i++ {
+		runes := make([]rune, rng.Intn(8))
+		for j := range runes {
+			runes[j] = alphabet[rng.Intn(len(alphabet))]
+		}
+		args = append(args, string(runes))
+	}
+
+	for _, arg := range args {
+		var buf bytes.Buffer
+		config := Config{Parsed: []Directive{Directive{Directive: "foo", Args: []string{arg}}}}
+		err := Build(&buf, config, &BuildOptions{})
+
+		// some arguments just can't be read by the lexer, like ones that end
+		// in a backslash or have carriage returns, so building has to fail
+		if _, ok := quote(arg); !ok {
+			if !strings.ContainsAny(arg, "\\\r") {
+				t.Fatalf("arg %q should be buildable", arg)
+			}
+			if err == nil {
+				t.Fatalf("arg %q can't be read back but was built as %q", arg, buf.String())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		built := buf.String()
+		tokens, err := Tokenize(&buf)
+		if err != nil {
+			t.Fatalf("arg %q was built as %q which can't be lexed: %v", arg, built, err)
+		}
+		if len(tokens) != 3 || tokens[1].Value != arg {
+			t.Fatalf("arg %q was built as %q which was lexed as %v", arg, built, tokens)
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	// a config with a few thousand servers, each with a handful of locations
+	servers := []Directive{}
+	for i := 0; i < 2000; i++ {
+		locations := []Directive{
+			Directive{Directive: "listen", Args: []string{"127.0.0.1:8080"}},
+			Directive{Directive: "server_name", Args: []string{fmt.Sprintf("server%d.example.com", i)}},
+		}
+		for j := 0; j < 5; j++ {
+			locations = append(locations, Directive{
+				Directive: "location",
+				Args:      []string{fmt.Sprintf("/path%d", j)},
+				Block: &[]Directive{
+					Directive{Directive: "proxy_set_header", Args: []string{"Host", "$host"}},
+					Directive{Directive: "return", Args: []string{"200", "foo bar baz"}},
+				},
+			})
+		}
+		servers = append(servers, Directive{Directive: "server", Args: []string{}, Block: &locations})
+	}
+	config := Config{Parsed: []Directive{Directive{Directive: "http", Args: []string{}, Block: &servers}}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Build(ioutil.Discard, config, &BuildOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
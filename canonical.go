@@ -0,0 +1,134 @@
+package crossplane
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// directives whose position among their siblings changes how nginx behaves,
+// so Canonicalize never moves them or moves other directives across them
+var orderedDirectives = []string{
+	"allow", "break", "deny", "if", "include", "location", "return", "rewrite", "set",
+}
+
+// blocks whose contents are key/value entries that may be order-sensitive,
+// like regular expressions in a map, so Canonicalize doesn't sort them
+var unsortedBlocks = []string{
+	"charset_map", "geo", "map", "match", "split_clients", "types",
+}
+
+// Canonicalize returns a copy of the config in a canonical form, so that
+// configs that only differ in ways that don't matter to nginx build to the
+// same bytes. These transformations are applied to every block:
+//   - Comments are removed.
+//   - Directives are stably sorted by name, so directives with the same name
+//     keep their order. Directives in the orderedDirectives list (like
+//     "location", "if", "rewrite", and "return") are never moved, and other
+//     directives are only sorted among the ones between them.
+//   - The entries inside of key/value blocks like "map" and "geo" are not
+//     sorted, since their order can matter.
+//   - Each run of whitespace inside of an argument, like the newline and
+//     indentation in a multi-line log_format, is replaced with a single
+//     space. The Lua code of Lua directives read with RawLuaBlocks is kept
+//     as it is.
+//
+// Quoting and the whitespace between arguments are normalized by Build,
+// which only quotes arguments that need it and separates them with single
+// spaces.
+func Canonicalize(config Config) Config {
+	config.Errors = append([]ConfigError{}, config.Errors...)
+	config.Parsed = canonicalBlock(config.Parsed, true)
+	return config
+}
+
+func canonicalBlock(block []Directive, sortable bool) []Directive {
+	canonical := make([]Directive, 0, len(block))
+	for _, d := range block {
+		if d.IsComment() {
+			continue
+		}
+		d = copyDirective(d)
+		for i, arg := range d.Args {
+			if d.Block == nil && isLuaBlock(d.Directive) && i == len(d.Args)-1 {
+				break
+			}
+			d.Args[i] = collapseSpace(arg)
+		}
+		if d.Block != nil {
+			inner := canonicalBlock(*d.Block, !contains(unsortedBlocks, d.Directive))
+			d.Block = &inner
+		}
+		canonical = append(canonical, d)
+	}
+	if !sortable {
+		return canonical
+	}
+
+	// sort each run of directives between the order-sensitive ones
+	start := 0
+	for i := 0; i <= len(canonical); i++ {
+		if i < len(canonical) && !contains(orderedDirectives, canonical[i].Directive) {
+			continue
+		}
+		run := canonical[start:i]
+		sort.SliceStable(run, func(a, b int) bool {
+			return run[a].Directive < run[b].Directive
+		})
+		start = i + 1
+	}
+	return canonical
+}
+
+// collapseSpace replaces each run of whitespace in s with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// Hash returns a hex-encoded SHA-256 hash of the config's canonical form, so
+// configs that only differ in their comments, formatting, line numbers, or
+// in ways that Canonicalize removes have the same hash. The config's file
+// name, status, and errors aren't part of the hash.
+func (c Config) Hash() string {
+	h := sha256.New()
+	hashBlock(h, Canonicalize(c).Parsed)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashBlock writes each directive's name and args with their lengths, so
+// that args can't run into each other, like "a b" and "ab".
+func hashBlock(h hash.Hash, block []Directive) {
+	for _, d := range block {
+		fmt.Fprintf(h, "%d:%s%d", len(d.Directive), d.Directive, len(d.Args))
+		for _, arg := range d.Args {
+			fmt.Fprintf(h, ":%d:%s", len(arg), arg)
+		}
+		if d.Block == nil {
+			h.Write([]byte(";"))
+		} else {
+			h.Write([]byte("{"))
+			hashBlock(h, *d.Block)
+			h.Write([]byte("}"))
+		}
+	}
+}
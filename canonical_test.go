@@ -0,0 +1,186 @@
+package crossplane
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Run("equivalent", func(t *testing.T) {
+		c1 := parseMergeInput(t, strings.Join([]string{
+			"# main config",
+			"worker_processes 1;",
+			"http {",
+			"    server {",
+			"        server_name 'example.com';",
+			"        listen 80; # plain http",
+			"        add_header X-A a;",
+			"        add_header X-B b;",
+			"    }",
+			"    gzip on;",
+			"}",
+		}, "\n"))
+		c2 := parseMergeInput(t, strings.Join([]string{
+			"http {",
+			"    gzip   on;",
+			"    server {",
+			"        add_header X-A \"a\";",
+			"        listen 80;",
+			"        add_header X-B b;",
+			"        server_name example.com;",
+			"    }",
+			"}",
+			"worker_processes 1;",
+		}, "\n"))
+		expected := strings.Join([]string{
+			"http {",
+			"    gzip on;",
+			"    server {",
+			"        add_header X-A a;",
+			"        add_header X-B b;",
+			"        listen 80;",
+			"        server_name example.com;",
+			"    }",
+			"}",
+			"worker_processes 1;",
+		}, "\n")
+		for _, config := range []Config{c1, c2} {
+			if got := buildMergeOutput(t, Canonicalize(config)); got != expected {
+				t.Fatalf("expected:\n%s\nbut got:\n%s", expected, got)
+			}
+		}
+	})
+
+	t.Run("order-sensitive", func(t *testing.T) {
+		config := parseMergeInput(t, strings.Join([]string{
+			"server {",
+			"    root /srv;",
+			"    index index.html;",
+			"    location /b {",
+			"        deny 10.0.0.1;",
+			"        allow 10.0.0.0/8;",
+			"        deny all;",
+			"    }",
+			"    location /a {",
+			"        return 200;",
+			"    }",
+			"    error_page 404 /404.html;",
+			"    access_log off;",
+			"    map $host $name {",
+			"        b.example.com b;",
+			"        a.example.com a;",
+			"    }",
+			"}",
+		}, "\n"))
+		expected := strings.Join([]string{
+			"server {",
+			"    index index.html;",
+			"    root /srv;",
+			"    location /b {",
+			"        deny 10.0.0.1;",
+			"        allow 10.0.0.0/8;",
+			"        deny all;",
+			"    }",
+			"    location /a {",
+			"        return 200;",
+			"    }",
+			"    access_log off;",
+			"    error_page 404 /404.html;",
+			"    map $host $name {",
+			"        b.example.com b;",
+			"        a.example.com a;",
+			"    }",
+			"}",
+		}, "\n")
+		if got := buildMergeOutput(t, Canonicalize(config)); got != expected {
+			t.Fatalf("expected:\n%s\nbut got:\n%s", expected, got)
+		}
+	})
+
+	t.Run("whitespace", func(t *testing.T) {
+		config := parseMergeInput(t, strings.Join([]string{
+			"log_format main '$remote_addr -  $status'",
+			"                '\t$body_bytes_sent ';",
+			"add_header X-A \"a\n   b\";",
+		}, "\n"))
+		expected := strings.Join([]string{
+			"add_header X-A \"a b\";",
+			"log_format main \"$remote_addr - $status\" \" $body_bytes_sent \";",
+		}, "\n")
+		if got := buildMergeOutput(t, Canonicalize(config)); got != expected {
+			t.Fatalf("expected:\n%s\nbut got:\n%s", expected, got)
+		}
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		comment := " comment"
+		config := Config{Parsed: []Directive{
+			Directive{Directive: "#", Args: []string{}, Comment: &comment},
+			Directive{Directive: "user", Args: []string{"nginx"}},
+		}}
+		if parsed := Canonicalize(config).Parsed; len(parsed) != 1 || parsed[0].Directive != "user" {
+			t.Fatalf("expected comments to be removed but got %v", parsed)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		config := parseMergeInput(t, "b 1;\na 2;\n")
+		Canonicalize(config)
+		if config.Parsed[0].Directive != "b" {
+			t.Fatalf("expected the original config to be unchanged but got %v", config.Parsed)
+		}
+	})
+}
+
+func TestConfigHash(t *testing.T) {
+	base := parseMergeInput(t, strings.Join([]string{
+		"http {",
+		"    gzip on;",
+		"    server {",
+		"        listen 80;",
+		"        location / {",
+		"            return 200 'ok';",
+		"        }",
+		"        location /api {",
+		"            proxy_pass http://backend;",
+		"        }",
+		"    }",
+		"}",
+	}, "\n"))
+
+	same := []string{
+		// comments, whitespace, quoting, and line numbers
+		"# http\nhttp {\n\n  gzip \"on\"; # compress\n  server { listen 80;\n location / { return 200 ok; }\n" +
+			"    location /api { proxy_pass http://backend; } }\n}\n",
+		// directives that can be sorted
+		"http { server { listen 80; location / { return 200 ok; } location /api { proxy_pass http://backend; } } gzip on; }",
+	}
+	for _, input := range same {
+		if got := parseMergeInput(t, input).Hash(); got != base.Hash() {
+			t.Fatalf("expected the same hash for:\n%s", input)
+		}
+	}
+
+	different := []string{
+		// a changed arg
+		"http { gzip off; server { listen 80; location / { return 200 ok; } location /api { proxy_pass http://backend; } } }",
+		// reordered locations
+		"http { gzip on; server { listen 80; location /api { proxy_pass http://backend; } location / { return 200 ok; } } }",
+		// args that only differ in where they're split
+		"http { gzip on; server { listen 80; location / { return '200 ok'; } location /api { proxy_pass http://backend; } } }",
+	}
+	for _, input := range different {
+		if got := parseMergeInput(t, input).Hash(); got == base.Hash() {
+			t.Fatalf("expected a different hash for:\n%s", input)
+		}
+	}
+
+	// an empty block isn't the same as no block
+	if parseMergeInput(t, "foo;").Hash() == parseMergeInput(t, "foo {}").Hash() {
+		t.Fatal("expected a different hash for an empty block")
+	}
+
+	if len(base.Hash()) != 64 {
+		t.Fatalf("expected a hex-encoded SHA-256 hash but got %q", base.Hash())
+	}
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 
@@ -17,16 +15,11 @@ func main() {
 		log.Fatal(err)
 	}
 
-	input, err := ioutil.ReadAll(file)
+	payload, err := crossplane.ReadPayload(file)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var payload crossplane.Payload
-	if err = json.Unmarshal(input, &payload); err != nil {
-		log.Fatal(err)
-	}
-
 	combined, err := payload.Combined()
 	if err != nil {
 		log.Fatal(err)
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"os"
 
@@ -15,10 +13,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	b, err := json.Marshal(payload)
-	if err != nil {
+	if err = payload.WriteJSON(os.Stdout, false); err != nil {
 		log.Fatal(err)
 	}
-
-	fmt.Println(string(b))
 }
@@ -11,6 +11,12 @@ type ParseError struct {
 }
 
 func (e ParseError) Error() string {
+	// errors from the lexer don't know which file they're in
+	if e.file == nil && e.line != nil {
+		return fmt.Sprintf("%s on line %d", e.what, *e.line)
+	} else if e.file == nil {
+		return e.what
+	}
 	if e.line != nil {
 		return fmt.Sprintf("%s in %s:%d", e.what, *e.file, *e.line)
 	}
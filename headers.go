@@ -0,0 +1,223 @@
+package crossplane
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// HeaderInheritanceIssue is a block that sets its own add_header directives
+// and so silently drops the headers that it would otherwise have inherited
+// from the blocks enclosing it.
+type HeaderInheritanceIssue struct {
+	File    string
+	Line    int
+	Problem string
+
+	// The block that re-declares add_header.
+	Block *Directive
+
+	// The inherited add_header directives that no longer apply.
+	Dropped []*Directive
+}
+
+// AddHeaderInheritance finds blocks that have add_header directives while
+// an enclosing block also has some. nginx only inherits add_header from the
+// outer block if the inner block doesn't have any of its own, so any header
+// that isn't set again in the inner block is dropped. Headers are compared
+// by name without regard to case. Each config is checked on its own, so
+// headers that come from the file that includes it aren't seen. The Block
+// and Dropped fields point into the payload's configs.
+func (p Payload) AddHeaderInheritance() []HeaderInheritanceIssue {
+	issues := []HeaderInheritanceIssue{}
+	for _, config := range p.Config {
+		checkAddHeaders(config.File, config.Parsed, nil, &issues)
+	}
+	return issues
+}
+
+func checkAddHeaders(file string, block []Directive, inherited []*Directive, issues *[]HeaderInheritanceIssue) {
+	for i := range block {
+		d := &block[i]
+		if d.Block == nil {
+			continue
+		}
+
+		own := addHeaders(*d.Block)
+		if len(own) == 0 {
+			checkAddHeaders(file, *d.Block, inherited, issues)
+			continue
+		}
+
+		names := map[string]bool{}
+		for _, h := range own {
+			names[strings.ToLower(h.Args[0])] = true
+		}
+		dropped := []*Directive{}
+		quoted := []string{}
+		for _, h := range inherited {
+			if !names[strings.ToLower(h.Args[0])] {
+				dropped = append(dropped, h)
+				quoted = append(quoted, fmt.Sprintf(`"%s"`, h.Args[0]))
+			}
+		}
+		if len(dropped) > 0 {
+			name := d.Directive
+			if len(d.Args) > 0 {
+				name += fmt.Sprintf(` "%s"`, strings.Join(d.Args, " "))
+			}
+			*issues = append(*issues, HeaderInheritanceIssue{
+				File:    file,
+				Line:    d.Line,
+				Problem: fmt.Sprintf("add_header in %s drops inherited headers %s", name, strings.Join(quoted, ", ")),
+				Block:   d,
+				Dropped: dropped,
+			})
+		}
+		checkAddHeaders(file, *d.Block, own, issues)
+	}
+}
+
+// addHeaders returns the add_header directives directly inside a block.
+func addHeaders(block []Directive) []*Directive {
+	headers := []*Directive{}
+	for i := range block {
+		if block[i].Directive == "add_header" && len(block[i].Args) > 0 {
+			headers = append(headers, &block[i])
+		}
+	}
+	return headers
+}
+
+// HeaderPolicyReport is the response headers that a payload's configs set,
+// hide, pass, and clear. Header names are in canonical form, like
+// "X-Powered-By", so that names that only differ by case are the same.
+type HeaderPolicyReport struct {
+	// The headers that are set, hidden, passed, or cleared anywhere in the
+	// payload, sorted by name.
+	Set     []string
+	Hidden  []string
+	Passed  []string
+	Cleared []string
+
+	// The blocks that have any of these directives, in the order that they
+	// appear.
+	Blocks []HeaderBlockPolicy
+}
+
+// HeaderBlockPolicy is the response headers that one block sets, hides,
+// passes, and clears with its own directives, in the order that they
+// appear. The top level of a config has a Line of 0 and an empty Context.
+type HeaderBlockPolicy struct {
+	File string
+	Line int
+
+	// The names of the block directives enclosing the directives, starting
+	// with the outermost one, like the ctx of a WalkFunc.
+	Context []string
+
+	Set     []string
+	Hidden  []string
+	Passed  []string
+	Cleared []string
+}
+
+// the *_hide_header and *_pass_header directives of the modules that proxy
+// requests
+var headerProxyModules = []string{"fastcgi", "grpc", "proxy", "scgi", "uwsgi"}
+
+// HeaderPolicy collects the response headers that are set by add_header and
+// more_set_headers, hidden by proxy_hide_header and the other *_hide_header
+// directives, passed by proxy_pass_header and the other *_pass_header
+// directives, and cleared by more_clear_headers, for each block of each
+// config. The -s and -t options of the headers-more directives are skipped,
+// and wildcards like "X-Debug-*" are kept as they are. Like
+// AddHeaderInheritance, this doesn't work out which headers a block
+// inherits.
+func (p Payload) HeaderPolicy() HeaderPolicyReport {
+	report := HeaderPolicyReport{Blocks: []HeaderBlockPolicy{}}
+	for _, config := range p.Config {
+		collectHeaderPolicy(config.File, 0, []string{}, config.Parsed, &report)
+	}
+
+	report.Set = headerUnion(report.Blocks, func(b HeaderBlockPolicy) []string { return b.Set })
+	report.Hidden = headerUnion(report.Blocks, func(b HeaderBlockPolicy) []string { return b.Hidden })
+	report.Passed = headerUnion(report.Blocks, func(b HeaderBlockPolicy) []string { return b.Passed })
+	report.Cleared = headerUnion(report.Blocks, func(b HeaderBlockPolicy) []string { return b.Cleared })
+	return report
+}
+
+func collectHeaderPolicy(file string, line int, ctx []string, block []Directive, report *HeaderPolicyReport) {
+	policy := HeaderBlockPolicy{File: file, Line: line, Context: ctx}
+	for _, d := range block {
+		switch {
+		case d.Directive == "add_header" && len(d.Args) > 0:
+			policy.Set = appendHeader(policy.Set, d.Args[0])
+		case d.Directive == "more_set_headers":
+			for _, arg := range headersMoreArgs(d.Args) {
+				policy.Set = appendHeader(policy.Set, strings.SplitN(arg, ":", 2)[0])
+			}
+		case d.Directive == "more_clear_headers":
+			for _, arg := range headersMoreArgs(d.Args) {
+				policy.Cleared = appendHeader(policy.Cleared, arg)
+			}
+		case strings.HasSuffix(d.Directive, "_hide_header") && len(d.Args) > 0:
+			if contains(headerProxyModules, strings.TrimSuffix(d.Directive, "_hide_header")) {
+				policy.Hidden = appendHeader(policy.Hidden, d.Args[0])
+			}
+		case strings.HasSuffix(d.Directive, "_pass_header") && len(d.Args) > 0:
+			if contains(headerProxyModules, strings.TrimSuffix(d.Directive, "_pass_header")) {
+				policy.Passed = appendHeader(policy.Passed, d.Args[0])
+			}
+		}
+	}
+	if len(policy.Set)+len(policy.Hidden)+len(policy.Passed)+len(policy.Cleared) > 0 {
+		report.Blocks = append(report.Blocks, policy)
+	}
+
+	for _, d := range block {
+		if d.Block != nil {
+			inner := append(append([]string{}, ctx...), d.Directive)
+			collectHeaderPolicy(file, d.Line, inner, *d.Block, report)
+		}
+	}
+}
+
+// headersMoreArgs returns the headers of a more_set_headers or
+// more_clear_headers directive, skipping its -s and -t options.
+func headersMoreArgs(args []string) []string {
+	headers := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-s" || args[i] == "-t" {
+			i++
+			continue
+		}
+		headers = append(headers, args[i])
+	}
+	return headers
+}
+
+// appendHeader adds the canonical form of a header name to a list of names
+// if it isn't already in it.
+func appendHeader(names []string, name string) []string {
+	name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+	if name == "" || contains(names, name) {
+		return names
+	}
+	return append(names, name)
+}
+
+// headerUnion returns the sorted names that are in any of the blocks' lists.
+func headerUnion(blocks []HeaderBlockPolicy, list func(HeaderBlockPolicy) []string) []string {
+	names := []string{}
+	for _, block := range blocks {
+		for _, name := range list(block) {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,104 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAddHeaderInheritance(t *testing.T) {
+	path := filepath.Join("testdata", "add-header-inheritance", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := payload.AddHeaderInheritance()
+
+	// check the directives separately, since they point into the payload
+	blockLines := []int{}
+	droppedLines := [][]int{}
+	for i := range issues {
+		blockLines = append(blockLines, issues[i].Block.Line)
+		lines := []int{}
+		for _, d := range issues[i].Dropped {
+			lines = append(lines, d.Line)
+		}
+		droppedLines = append(droppedLines, lines)
+		issues[i].Block = nil
+		issues[i].Dropped = nil
+	}
+
+	expected := []HeaderInheritanceIssue{
+		HeaderInheritanceIssue{
+			File:    path,
+			Line:    10,
+			Problem: `add_header in location "/api" drops inherited headers "X-Frame-Options", "Strict-Transport-Security"`,
+		},
+		HeaderInheritanceIssue{
+			File:    path,
+			Line:    18,
+			Problem: `add_header in server drops inherited headers "X-Frame-Options", "Strict-Transport-Security"`,
+		},
+		HeaderInheritanceIssue{
+			File:    path,
+			Line:    22,
+			Problem: `add_header in if "$request_method = OPTIONS" drops inherited headers "X-Served-By"`,
+		},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, issues)
+	}
+	if expectedLines := []int{10, 18, 22}; !reflect.DeepEqual(blockLines, expectedLines) {
+		t.Fatalf("expected blocks on lines %v but got %v", expectedLines, blockLines)
+	}
+	if expectedLines := [][]int{{3, 4}, {3, 4}, {20}}; !reflect.DeepEqual(droppedLines, expectedLines) {
+		t.Fatalf("expected dropped headers on lines %v but got %v", expectedLines, droppedLines)
+	}
+}
+
+func TestHeaderPolicy(t *testing.T) {
+	path := filepath.Join("testdata", "header-policy", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := HeaderPolicyReport{
+		Set:     []string{"X-Cache-Status", "X-Frame-Options", "X-Request-Id"},
+		Hidden:  []string{"X-Powered-By"},
+		Passed:  []string{"Server"},
+		Cleared: []string{"Server", "X-Debug-*"},
+		Blocks: []HeaderBlockPolicy{
+			HeaderBlockPolicy{
+				File:    path,
+				Line:    2,
+				Context: []string{"http"},
+				Set:     []string{"X-Frame-Options"},
+				Hidden:  []string{"X-Powered-By"},
+			},
+			HeaderBlockPolicy{
+				File:    path,
+				Line:    5,
+				Context: []string{"http", "server"},
+				Cleared: []string{"Server", "X-Debug-*"},
+			},
+			HeaderBlockPolicy{
+				File:    path,
+				Line:    8,
+				Context: []string{"http", "server", "location"},
+				Set:     []string{"X-Frame-Options"},
+				Hidden:  []string{"X-Powered-By"},
+				Passed:  []string{"Server"},
+			},
+			HeaderBlockPolicy{
+				File:    path,
+				Line:    14,
+				Context: []string{"http", "server", "location"},
+				Set:     []string{"X-Cache-Status", "X-Request-Id"},
+				Hidden:  []string{"X-Powered-By"},
+			},
+		},
+	}
+	if report := payload.HeaderPolicy(); !reflect.DeepEqual(report, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, report)
+	}
+}
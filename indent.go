@@ -0,0 +1,48 @@
+package crossplane
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// IndentStats describes how the lines of a config are indented.
+type IndentStats struct {
+	TabLines   int   // lines indented only with tabs
+	SpaceLines int   // lines indented only with spaces
+	MixedLines []int // line numbers of lines indented with both
+}
+
+// IndentStyleReport reads a config and counts the lines that are indented
+// with tabs and with spaces, and finds the lines that use both. Blank lines
+// and lines without indentation aren't counted. The config isn't lexed, so
+// lines inside of quoted arguments and Lua blocks are counted like any
+// others.
+func IndentStyleReport(r io.Reader) (IndentStats, error) {
+	stats := IndentStats{MixedLines: []int{}}
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return stats, err
+		}
+
+		indent := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+		if strings.TrimSpace(text) != "" && indent != "" {
+			tabs := strings.Contains(indent, "\t")
+			spaces := strings.Contains(indent, " ")
+			switch {
+			case tabs && spaces:
+				stats.MixedLines = append(stats.MixedLines, line)
+			case tabs:
+				stats.TabLines++
+			default:
+				stats.SpaceLines++
+			}
+		}
+
+		if err == io.EOF {
+			return stats, nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package crossplane
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndentStyleReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected IndentStats
+	}{
+		{
+			"spaces",
+			"events {\n    worker_connections 1024;\n}\n",
+			IndentStats{SpaceLines: 1, MixedLines: []int{}},
+		},
+		{
+			"tabs",
+			"http {\n\tserver {\n\t\tlisten 80;\n\t}\n}",
+			IndentStats{TabLines: 3, MixedLines: []int{}},
+		},
+		{
+			"mixed",
+			"http {\n\tserver {\n\t    listen 80;\n  \n        server_name a;\n \tindex x;\n\t}\n}\n",
+			IndentStats{TabLines: 2, SpaceLines: 1, MixedLines: []int{3, 6}},
+		},
+		{
+			"crlf",
+			"events {\r\n  worker_connections 1024;\r\n}\r\n",
+			IndentStats{SpaceLines: 1, MixedLines: []int{}},
+		},
+		{
+			"empty",
+			"",
+			IndentStats{MixedLines: []int{}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stats, err := IndentStyleReport(strings.NewReader(test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stats, test.expected) {
+				t.Fatalf("expected: %+v\nbut got: %+v", test.expected, stats)
+			}
+		})
+	}
+}
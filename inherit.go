@@ -0,0 +1,166 @@
+package crossplane
+
+import "strings"
+
+// directives that only apply to the block that they're in, either because
+// nginx doesn't inherit them or because they define something by being there
+var uninheritedDirectives = map[string]bool{
+	"alias":          true,
+	"break":          true,
+	"fastcgi_pass":   true,
+	"grpc_pass":      true,
+	"if":             true,
+	"include":        true,
+	"internal":       true,
+	"limit_except":   true,
+	"listen":         true,
+	"location":       true,
+	"memcached_pass": true,
+	"proxy_pass":     true,
+	"return":         true,
+	"rewrite":        true,
+	"scgi_pass":      true,
+	"server":         true,
+	"server_name":    true,
+	"set":            true,
+	"try_files":      true,
+	"upstream":       true,
+	"uwsgi_pass":     true,
+}
+
+// Effective returns the directive that sets the effective value of a
+// directive in a block, by looking in the block first and then in each of
+// the blocks that enclose it, the way nginx inherits most directives from
+// outer blocks. Each element of the path selects the first block directive
+// inside of the last one that has that name, and can also have the block's
+// args after a space to pick a specific block, like
+// []string{"http", "server", "location /api"}. An empty path looks at the
+// config's top level only. If the path doesn't lead to a block or no
+// enclosing block sets the directive, Effective returns false.
+//
+// This is a best-effort model of nginx's inheritance. Directives that
+// nginx doesn't inherit, like rewrite or proxy_pass, are only looked for in
+// the block itself. Directives that can be repeated, like add_header, are
+// inherited from the nearest block that has any of them, so the returned
+// directive is the first of possibly several that apply. Paths are relative
+// to the config's file, like they are for Walk.
+func (c Config) Effective(path []string, directive string) (*Directive, bool) {
+	levels := []*[]Directive{&c.Parsed}
+	for _, sel := range path {
+		block := selectBlock(*levels[len(levels)-1], sel)
+		if block == nil {
+			return nil, false
+		}
+		levels = append(levels, block)
+	}
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		block := *levels[i]
+		for j := range block {
+			if block[j].Directive == directive {
+				return &block[j], true
+			}
+		}
+		if uninheritedDirectives[directive] {
+			break
+		}
+	}
+	return nil, false
+}
+
+// selectBlock returns the block of the first block directive that matches
+// a path element like "location /api", or nil if there isn't one.
+func selectBlock(block []Directive, sel string) *[]Directive {
+	fields := strings.Fields(sel)
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, d := range block {
+		if d.Block == nil || d.Directive != fields[0] {
+			continue
+		}
+		if len(fields) == 1 || strings.Join(d.Args, " ") == strings.Join(fields[1:], " ") {
+			return d.Block
+		}
+	}
+	return nil
+}
+
+// the contexts of blocks that inherit directives from the block that
+// encloses them
+var inheritingContexts = map[string]bool{
+	blockCtx{"http", "server"}.key():   true,
+	blockCtx{"http", "location"}.key(): true,
+	blockCtx{"stream", "server"}.key(): true,
+	blockCtx{"mail", "server"}.key():   true,
+}
+
+// MaterializeInheritance returns a copy of a config where each server and
+// location block (and each server block in stream and mail) explicitly
+// contains the directives that it inherits from the block enclosing it, so
+// that a block's effective settings can be read without looking at its
+// parents. The config that's passed in isn't changed.
+//
+// A directive is treated as inheritable if it isn't a block or a comment,
+// isn't one of the directives that nginx doesn't inherit (like rewrite,
+// proxy_pass, or server_name), and is allowed in the inner block's context
+// according to the directives that crossplane knows about. Unknown
+// directives are never copied. Inherited directives are added to the start
+// of the inner block, in the order that they appear in the outer block, and
+// keep the line numbers of the directives that they were copied from.
+//
+// Directives are inherited by name, so a block that has any directive with
+// a given name inherits none of the outer block's directives with that
+// name. This matches how nginx handles directives that can be repeated, like
+// add_header or proxy_set_header: a single add_header in a location replaces
+// all of the headers set in its server rather than adding to them. Like
+// Effective, this only looks at the config's own file, so directives that
+// come from the file that includes it aren't seen.
+func MaterializeInheritance(c Config) Config {
+	c.Parsed = copyBlock(c.Parsed)
+	materializeBlock(c.Parsed, blockCtx{})
+	return c
+}
+
+func materializeBlock(block []Directive, ctx blockCtx) {
+	for i := range block {
+		d := &block[i]
+		if d.Block == nil || d.Directive == "#" {
+			continue
+		}
+		inner := enterBlockCtx(*d, ctx)
+		if inheritingContexts[inner.key()] {
+			*d.Block = append(inheritedDirectives(block, *d.Block, contexts[inner.key()]), *d.Block...)
+		}
+		materializeBlock(*d.Block, inner)
+	}
+}
+
+// inheritedDirectives returns copies of the directives in an outer block
+// that an inner block with the given context mask inherits.
+func inheritedDirectives(outer, inner []Directive, mask int) []Directive {
+	own := map[string]bool{}
+	for _, d := range inner {
+		own[d.Directive] = true
+	}
+	inherited := []Directive{}
+	for _, d := range outer {
+		if d.Block != nil || d.Directive == "#" || uninheritedDirectives[d.Directive] || own[d.Directive] {
+			continue
+		}
+		if allowedIn(d.Directive, mask) {
+			inherited = append(inherited, copyDirective(d))
+		}
+	}
+	return inherited
+}
+
+// allowedIn returns true if a known directive can be used in a context.
+func allowedIn(directive string, mask int) bool {
+	for _, m := range directives[directive] {
+		if m&mask != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type effectiveFixture struct {
+	path      []string
+	directive string
+	line      int // 0 if the directive shouldn't be found
+}
+
+var effectiveFixtures = []effectiveFixture{
+	effectiveFixture{[]string{"http", "server", "location /"}, "gzip", 4},
+	effectiveFixture{[]string{"http", "server", "location /api"}, "gzip", 14},
+	effectiveFixture{[]string{"http", "server", "location /"}, "root", 9},
+	effectiveFixture{[]string{"http", "server", "location /"}, "add_header", 5},
+	effectiveFixture{[]string{"http", "server", "location /api"}, "add_header", 15},
+	effectiveFixture{[]string{"http", "server"}, "gzip", 4},
+	effectiveFixture{[]string{"http", "server", "location"}, "return", 11},
+	effectiveFixture{[]string{"http", "server", "location /api"}, "proxy_pass", 17},
+	effectiveFixture{[]string{"http", "server", "location /api"}, "server_name", 0},
+	effectiveFixture{[]string{"http", "server", "location /"}, "client_max_body_size", 0},
+	effectiveFixture{[]string{"http", "server", "location /missing"}, "gzip", 0},
+	effectiveFixture{[]string{}, "gzip", 0},
+}
+
+func TestEffective(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "inheritance", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	for _, fixture := range effectiveFixtures {
+		fixture := fixture
+		name := strings.Join(append(fixture.path, fixture.directive), ">")
+		t.Run(name, func(t *testing.T) {
+			d, ok := config.Effective(fixture.path, fixture.directive)
+			if fixture.line == 0 {
+				if ok || d != nil {
+					t.Fatalf("expected no directive but got %v", d)
+				}
+				return
+			}
+			if !ok || d.Directive != fixture.directive || d.Line != fixture.line {
+				t.Fatalf("expected %s on line %d but got %v", fixture.directive, fixture.line, d)
+			}
+		})
+	}
+
+	t.Run("points-into-config", func(t *testing.T) {
+		d, _ := config.Effective([]string{"http", "server", "location /api"}, "gzip")
+		d.Args[0] = "on"
+		if d, _ := config.Effective([]string{"http", "server", "location /api"}, "gzip"); d.Args[0] != "on" {
+			t.Fatal("expected the returned directive to point into the config")
+		}
+	})
+}
+
+func TestMaterializeInheritance(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "inheritance", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	var b strings.Builder
+	if err := Build(&b, MaterializeInheritance(config), &BuildOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"events {",
+		"}",
+		"http {",
+		"    gzip on;",
+		"    add_header X-Frame-Options DENY;",
+		"    server {",
+		"        gzip on;",
+		"        add_header X-Frame-Options DENY;",
+		"        listen 80;",
+		"        server_name example.com;",
+		"        root /var/www;",
+		"        location / {",
+		"            gzip on;",
+		"            add_header X-Frame-Options DENY;",
+		"            root /var/www;",
+		"            return 200;",
+		"        }",
+		"        location /api {",
+		"            root /var/www;",
+		"            gzip off;",
+		"            add_header X-Api yes;",
+		"            add_header X-Version 1;",
+		"            proxy_pass http://backend;",
+		"        }",
+		"    }",
+		"}",
+	}, "\n")
+	if b.String() != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s", expected, b.String())
+	}
+
+	if n := len(*(*config.Parsed[1].Block)[2].Block); n != 5 {
+		t.Fatalf("expected the original server block to be unchanged but it has %d directives", n)
+	}
+}
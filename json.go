@@ -0,0 +1,146 @@
+package crossplane
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// compactDirective mirrors Directive, but leaves out zero line numbers and
+// empty argument lists when it's marshaled.
+type compactDirective struct {
+	Directive string              `json:"directive"`
+	Line      int                 `json:"line,omitempty"`
+	Args      []string            `json:"args,omitempty"`
+	Includes  *[]int              `json:"includes,omitempty"`
+	Block     *[]compactDirective `json:"block,omitempty"`
+	Comment   *string             `json:"comment,omitempty"`
+	Raw       *string             `json:"raw,omitempty"`
+	Column    int                 `json:"column,omitempty"`
+	EndLine   int                 `json:"end_line,omitempty"`
+	EndColumn int                 `json:"end_column,omitempty"`
+}
+
+type compactConfig struct {
+	File     string             `json:"file"`
+	Status   string             `json:"status"`
+	Errors   []ConfigError      `json:"errors"`
+	Warnings []ConfigWarning    `json:"warnings,omitempty"`
+	Parsed   []compactDirective `json:"parsed"`
+	Tokens   []Token            `json:"tokens,omitempty"`
+}
+
+type compactPayload struct {
+	Status   string           `json:"status"`
+	Errors   []PayloadError   `json:"errors"`
+	Warnings []PayloadWarning `json:"warnings,omitempty"`
+	Config   []compactConfig  `json:"config"`
+}
+
+// WriteJSON writes the JSON encoding of the Payload to w, followed by a
+// newline. If indent is true, the JSON is indented to be easier to read.
+func (p Payload) WriteJSON(w io.Writer, indent bool) error {
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(p)
+}
+
+// ReadPayload reads a JSON encoded Payload from r, like the output of
+// WriteJSON or MarshalCompact.
+func ReadPayload(r io.Reader) (*Payload, error) {
+	var payload Payload
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// MarshalCompact returns the JSON encoding of the Payload, leaving out the
+// "line" of directives whose line is 0 and the "args" of directives with no
+// arguments. The result can still be unmarshaled into a Payload.
+func (p Payload) MarshalCompact() ([]byte, error) {
+	compact := compactPayload{
+		Status:   p.Status,
+		Errors:   p.Errors,
+		Warnings: p.Warnings,
+		Config:   make([]compactConfig, 0, len(p.Config)),
+	}
+	for _, config := range p.Config {
+		compact.Config = append(compact.Config, compactConfig{
+			File:     config.File,
+			Status:   config.Status,
+			Errors:   config.Errors,
+			Warnings: config.Warnings,
+			Parsed:   compactBlock(config.Parsed),
+			Tokens:   config.Tokens,
+		})
+	}
+	return json.Marshal(compact)
+}
+
+func compactBlock(block []Directive) []compactDirective {
+	compact := make([]compactDirective, 0, len(block))
+	for _, d := range block {
+		c := compactDirective{
+			Directive: d.Directive,
+			Line:      d.Line,
+			Args:      d.Args,
+			Includes:  d.Includes,
+			Comment:   d.Comment,
+			Raw:       d.Raw,
+			Column:    d.Column,
+			EndLine:   d.EndLine,
+			EndColumn: d.EndColumn,
+		}
+		if d.Block != nil {
+			inner := compactBlock(*d.Block)
+			c.Block = &inner
+		}
+		compact = append(compact, c)
+	}
+	return compact
+}
+
+// ToMap returns the config as nested maps, for tools like template engines
+// and policy engines that are easier to use with keys than with lists of
+// directives. Each block becomes a map whose keys are the names of the
+// directives in it. The value of a directive without a block is its args
+// joined by spaces, and the value of a block directive is the map for its
+// block, keyed by its name and args joined by spaces, like "location /api".
+// A key that's used by more than one directive in the same block has a
+// []interface{} of their values, in the order that they appear.
+//
+// The conversion loses information: comments, line numbers, includes, and
+// the order of directives with different keys aren't kept, and args are no
+// longer separate. It can't be turned back into a config, so use Parsed with
+// Build for that.
+func (c Config) ToMap() map[string]interface{} {
+	return blockToMap(c.Parsed)
+}
+
+func blockToMap(block []Directive) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, d := range block {
+		if d.IsComment() {
+			continue
+		}
+
+		key, value := d.Directive, interface{}(strings.Join(d.Args, " "))
+		if d.Block != nil {
+			key = strings.Join(append([]string{d.Directive}, d.Args...), " ")
+			value = blockToMap(*d.Block)
+		}
+
+		switch prev := m[key].(type) {
+		case nil:
+			m[key] = value
+		case []interface{}:
+			m[key] = append(prev, value)
+		default:
+			m[key] = []interface{}{prev, value}
+		}
+	}
+	return m
+}
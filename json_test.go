@@ -0,0 +1,117 @@
+package crossplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalCompact(t *testing.T) {
+	payload := Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   "nginx.conf",
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Block: &[]Directive{
+							Directive{Directive: "worker_connections", Args: []string{"1024"}},
+						},
+					},
+					Directive{Directive: "user", Line: 3, Args: []string{"nginx"}, Column: 1, EndLine: 3, EndColumn: 11},
+				},
+				Tokens: []Token{Token{Value: "user", Line: 3, Column: 1, Offset: 42}},
+			},
+		},
+	}
+
+	b, err := payload.MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"status":"ok","errors":[],"config":[{"file":"nginx.conf","status":"ok","errors":[],"parsed":[` +
+		`{"directive":"events","block":[{"directive":"worker_connections","args":["1024"]}]},` +
+		`{"directive":"user","line":3,"args":["nginx"],"column":1,"end_line":3,"end_column":11}],` +
+		`"tokens":[{"value":"user","line":3,"column":1,"offset":42}]}]}`
+	if string(b) != expected {
+		t.Fatalf("expected: %s\nbut got: %s", expected, b)
+	}
+
+	var unmarshaled Payload
+	if err := json.Unmarshal(b, &unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Build(&buf, unmarshaled.Config[0], &BuildOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	built := strings.Join([]string{"events {", "    worker_connections 1024;", "}", "user nginx;"}, "\n")
+	if buf.String() != built {
+		t.Fatalf("expected: %#v\nbut got: %#v", built, buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "simple", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled, _ := json.Marshal(payload)
+
+	for _, indent := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := payload.WriteJSON(&buf, indent); err != nil {
+			t.Fatal(err)
+		}
+		if indent != strings.Contains(buf.String(), "\n  ") {
+			t.Fatalf("expected indent to be %v but got: %s", indent, buf.String())
+		}
+		if !indent && buf.String() != string(marshaled)+"\n" {
+			t.Fatalf("expected: %s\nbut got: %s", marshaled, buf.String())
+		}
+
+		read, err := ReadPayload(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, payload) {
+			t.Fatalf("expected: %#v\nbut got: %#v", payload, read)
+		}
+	}
+}
+
+func TestToMap(t *testing.T) {
+	input := "user nginx;\nhttp {\n    # comment\n    gzip on;\n    server {\n        listen 80;\n        listen [::]:80;\n        location /api {\n            proxy_pass http://api;\n        }\n    }\n    server {\n        listen 81;\n    }\n}\n"
+	parsed, errs := ParseSnippet(input, nil, &ParseOptions{ParseComments: true})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	expected := map[string]interface{}{
+		"user": "nginx",
+		"http": map[string]interface{}{
+			"gzip": "on",
+			"server": []interface{}{
+				map[string]interface{}{
+					"listen": []interface{}{"80", "[::]:80"},
+					"location /api": map[string]interface{}{
+						"proxy_pass": "http://api",
+					},
+				},
+				map[string]interface{}{
+					"listen": "81",
+				},
+			},
+		},
+	}
+	if m := (Config{Parsed: parsed}).ToMap(); !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, m)
+	}
+}
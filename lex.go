@@ -4,22 +4,134 @@ import (
 	"bufio"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
+// Token is a single lexical token from an NGINX config.
+type Token struct {
+	Value    string `json:"value"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+	IsQuoted bool   `json:"quoted,omitempty"`
+}
+
 type ngxToken struct {
 	Value    string
 	Line     int
+	Column   int
+	Offset   int // byte offset of the token's first char, like an opening quote
+	End      int // byte offset just past the token's last char
 	IsQuoted bool
 	Error    error
+	LuaBody  *string // raw Lua code of a Lua directive's block, set on its "{"
 }
 
 type charLine struct {
-	char string
-	line int
+	char   string
+	line   int
+	col    int
+	offset int
+}
+
+// Tokenize lexes an NGINX config and returns all of its tokens. Line and
+// column numbers start at 1, and columns are counted in runes. Offsets are
+// the number of bytes before the start of the token, so a quoted token's
+// offset is the offset of its opening quote. If the lexer
+// finds an error, such as unbalanced braces, then the tokens that were read
+// before it are returned along with the error.
+func Tokenize(reader io.Reader) ([]Token, error) {
+	tokens := []Token{}
+	for t := range lex(reader) {
+		if t.Error != nil {
+			return tokens, t.Error
+		}
+		tokens = append(tokens, Token{
+			Value:    t.Value,
+			Line:     t.Line,
+			Column:   t.Column,
+			Offset:   t.Offset,
+			IsQuoted: t.IsQuoted,
+		})
+	}
+	return tokens, nil
+}
+
+// LexRaw returns the tokens of an NGINX config as they're read, without
+// checking that its braces are balanced. It's meant for tools that work with
+// incomplete configs, like an editor that lexes a file as it's being typed.
+func LexRaw(reader io.Reader) chan Token {
+	c := make(chan Token)
+	go func() {
+		for t := range tokenize(reader, 1, false) {
+			c <- Token{
+				Value:    t.Value,
+				Line:     t.Line,
+				Column:   t.Column,
+				Offset:   t.Offset,
+				IsQuoted: t.IsQuoted,
+			}
+		}
+		close(c)
+	}()
+	return c
+}
+
+// retainTokens reads all of the tokens before any of them are parsed, so
+// that the list has every token even if parsing stops early, and returns a
+// channel that gives them back. Error tokens aren't added to the list.
+func retainTokens(tokens chan ngxToken, list *[]Token) chan ngxToken {
+	all := []ngxToken{}
+	*list = []Token{}
+	for t := range tokens {
+		all = append(all, t)
+		if t.Error == nil {
+			*list = append(*list, Token{
+				Value:    t.Value,
+				Line:     t.Line,
+				Column:   t.Column,
+				Offset:   t.Offset,
+				IsQuoted: t.IsQuoted,
+			})
+		}
+	}
+
+	c := make(chan ngxToken, len(all))
+	for _, t := range all {
+		c <- t
+	}
+	close(c)
+	return c
 }
 
 func lex(reader io.Reader) chan ngxToken {
-	return balanceBraces(tokenize(reader))
+	return balanceBraces(tokenize(reader, 1, false))
+}
+
+// closeBlocks adds a "}" token at the end of the input for each block that
+// was left open, as if the input ended where the blocks do.
+func closeBlocks(tokens chan ngxToken) chan ngxToken {
+	c := make(chan ngxToken)
+
+	go func() {
+		depth := 0
+		var last ngxToken
+		for t := range tokens {
+			if t.Value == "}" && !t.IsQuoted && depth > 0 {
+				depth--
+			} else if t.Value == "{" && !t.IsQuoted {
+				depth++
+			}
+			last = t
+			c <- t
+		}
+		for ; depth > 0; depth-- {
+			c <- ngxToken{Value: "}", Line: last.Line, Column: last.Column, Offset: last.End, End: last.End}
+		}
+		close(c)
+	}()
+
+	return c
 }
 
 func balanceBraces(tokens chan ngxToken) chan ngxToken {
@@ -66,22 +178,54 @@ func balanceBraces(tokens chan ngxToken) chan ngxToken {
 	return c
 }
 
-func tokenize(reader io.Reader) chan ngxToken {
+// tokenize reads the tokens of an NGINX config. A tab moves the column to
+// the next multiple of tabWidth, or counts as one column if it's 1 or less.
+// If luaBlocks is true, the block of each Lua directive is read as raw Lua
+// code, which is set on its "{" token, and the "}" that closes it follows
+// right after.
+func tokenize(reader io.Reader, tabWidth int, luaBlocks bool) chan ngxToken {
 	c := make(chan ngxToken)
 
 	go func() {
 		var ok bool
 		var token string
-		var tokenLine int
+		var tokenLine, tokenCol, tokenOffset, tokenEnd int
+
+		// the lexer keeps track of whether the next token is a directive so
+		// that the blocks of Lua directives can be read as raw text
+		expectDirective, luaBlock := true, false
+		emit := func(t ngxToken) {
+			if !t.IsQuoted && (t.Value == ";" || t.Value == "{" || t.Value == "}") {
+				expectDirective, luaBlock = true, false
+			} else if t.IsQuoted || !strings.HasPrefix(t.Value, "#") {
+				// args after a Lua directive (like set_by_lua_block's
+				// variable) don't change that its block is Lua
+				luaBlock = luaBlock || (luaBlocks && expectDirective && isLuaBlock(t.Value))
+				expectDirective = false
+			}
+			c <- t
+		}
 
-		it := lineCount(escapeChars(readChars(reader)))
+		it := lineCount(escapeChars(readChars(reader)), tabWidth)
 
 		for cl := range it {
+			// handle parameter expansion syntax (ex: "${var[@]}") before
+			// anything else so that the char after it is handled normally
+			if len(token) > 0 && strings.HasSuffix(token, "$") && cl.char == "{" {
+				for !strings.HasSuffix(token, "}") && !isSpace(cl.char) && cl.char != ";" {
+					token += cl.char
+					tokenEnd = cl.offset + len(cl.char)
+					if cl, ok = <-it; !ok {
+						break
+					}
+				}
+			}
+
 			// handle whitespace
 			if isSpace(cl.char) {
 				// if token complete yield it and reset token buffer
 				if len(token) > 0 {
-					c <- ngxToken{Value: token, Line: tokenLine, IsQuoted: false}
+					emit(ngxToken{Value: token, Line: tokenLine, Column: tokenCol, Offset: tokenOffset, End: tokenEnd, IsQuoted: false})
 					token = ""
 				}
 				// disregard until char isn't a whitespace character
@@ -94,30 +238,21 @@ func tokenize(reader io.Reader) chan ngxToken {
 
 			// if starting comment
 			if len(token) == 0 && cl.char == "#" {
-				lineAtStart := cl.line
+				lineAtStart, colAtStart, offsetAtStart := cl.line, cl.col, cl.offset
 				for !strings.HasSuffix(cl.char, "\n") {
 					token += cl.char
+					tokenEnd = cl.offset + len(cl.char)
 					if cl, ok = <-it; !ok {
 						break
 					}
 				}
-				c <- ngxToken{Value: token, Line: lineAtStart, IsQuoted: false}
+				emit(ngxToken{Value: token, Line: lineAtStart, Column: colAtStart, Offset: offsetAtStart, End: tokenEnd, IsQuoted: false})
 				token = ""
 				continue
 			}
 
 			if len(token) == 0 {
-				tokenLine = cl.line
-			}
-
-			// handle parameter expansion syntax (ex: "${var[@]}")
-			if len(token) > 0 && strings.HasSuffix(token, "$") && cl.char == "{" {
-				for !strings.HasSuffix(token, "}") && !isSpace(cl.char) {
-					token += cl.char
-					if cl, ok = <-it; !ok {
-						break
-					}
-				}
+				tokenLine, tokenCol, tokenOffset = cl.line, cl.col, cl.offset
 			}
 
 			// if a quote is found, add the whole string to the token buffer
@@ -125,6 +260,7 @@ func tokenize(reader io.Reader) chan ngxToken {
 				// if a quote is inside a token, treat it like any other char
 				if len(token) > 0 {
 					token += cl.char
+					tokenEnd = cl.offset + len(cl.char)
 					continue
 				}
 
@@ -142,9 +278,10 @@ func tokenize(reader io.Reader) chan ngxToken {
 						break
 					}
 				}
+				tokenEnd = cl.offset + len(cl.char)
 
 				// True because this is in quotes
-				c <- ngxToken{Value: token, Line: tokenLine, IsQuoted: true}
+				emit(ngxToken{Value: token, Line: tokenLine, Column: tokenCol, Offset: tokenOffset, End: tokenEnd, IsQuoted: true})
 				token = ""
 				continue
 			}
@@ -153,21 +290,37 @@ func tokenize(reader io.Reader) chan ngxToken {
 			if cl.char == "{" || cl.char == "}" || cl.char == ";" {
 				// if token complete yield it and reset token buffer
 				if len(token) > 0 {
-					c <- ngxToken{Value: token, Line: tokenLine, IsQuoted: false}
+					emit(ngxToken{Value: token, Line: tokenLine, Column: tokenCol, Offset: tokenOffset, End: tokenEnd, IsQuoted: false})
 					token = ""
 				}
 
+				// the block of a Lua directive is read as raw text
+				if cl.char == "{" && luaBlock {
+					open := ngxToken{Value: cl.char, Line: cl.line, Column: cl.col, Offset: cl.offset, End: cl.offset + 1}
+					body := ""
+					if cl, ok = readLuaBlock(it, &body); !ok {
+						open.LuaBody = &body
+						emit(open)
+						break
+					}
+					open.LuaBody = &body
+					emit(open)
+					emit(ngxToken{Value: cl.char, Line: cl.line, Column: cl.col, Offset: cl.offset, End: cl.offset + 1, IsQuoted: false})
+					continue
+				}
+
 				// this character is a full token so yield it now
-				c <- ngxToken{Value: cl.char, Line: cl.line, IsQuoted: false}
+				emit(ngxToken{Value: cl.char, Line: cl.line, Column: cl.col, Offset: cl.offset, End: cl.offset + 1, IsQuoted: false})
 				continue
 			}
 
 			// append char to the token buffer
 			token += cl.char
+			tokenEnd = cl.offset + len(cl.char)
 		}
 
 		if token != "" {
-			c <- ngxToken{Value: token, Line: tokenLine, IsQuoted: false}
+			emit(ngxToken{Value: token, Line: tokenLine, Column: tokenCol, Offset: tokenOffset, End: tokenEnd, IsQuoted: false})
 		}
 
 		close(c)
@@ -176,6 +329,69 @@ func tokenize(reader io.Reader) chan ngxToken {
 	return c
 }
 
+// readLuaBlock reads the chars of a Lua block up to the "}" that closes it,
+// skipping over braces in Lua strings and comments, including long strings
+// and comments like [[...]] and --[==[...]==]. The chars before the closing
+// brace are added to body. It returns the closing brace, or false if the
+// input ended first.
+func readLuaBlock(it chan charLine, body *string) (charLine, bool) {
+	depth, quote, longClose := 1, "", ""
+	comment := -1 // where the text of the comment being read starts in body
+	for cl := range it {
+		switch {
+		case longClose != "":
+			if strings.HasSuffix(*body+cl.char, longClose) {
+				longClose = ""
+			}
+		case comment >= 0:
+			// a comment that starts with a long bracket ends with its match
+			if close, n, ok := luaLongBracket(*body); ok && cl.char == "[" && n == len(*body)-comment {
+				longClose, comment = close, -1
+			} else if strings.HasSuffix(cl.char, "\n") {
+				comment = -1
+			}
+		case quote != "":
+			if cl.char == quote {
+				quote = ""
+			}
+		case cl.char == `"` || cl.char == "'":
+			quote = cl.char
+		case cl.char == "[":
+			if close, _, ok := luaLongBracket(*body); ok {
+				longClose = close
+			}
+		case cl.char == "-" && strings.HasSuffix(*body, "-"):
+			comment = len(*body) + 1
+		case cl.char == "{":
+			depth++
+		case cl.char == "}":
+			depth--
+		}
+		if depth == 0 {
+			return cl, true
+		}
+		*body += cl.char
+	}
+	return charLine{}, false
+}
+
+// luaLongBracket checks whether s ends in the start of a Lua long bracket,
+// like "[" or "[==", that another "[" would finish. It returns the bracket
+// that closes it, like "]==]", and the length of the start in s.
+func luaLongBracket(s string) (string, int, bool) {
+	level := len(s) - len(strings.TrimRight(s, "="))
+	if !strings.HasSuffix(s[:len(s)-level], "[") {
+		return "", 0, false
+	}
+	return "]" + strings.Repeat("=", level) + "]", level + 1, true
+}
+
+// isLuaBlock returns true if the directive's block holds Lua code instead of
+// directives, like content_by_lua_block.
+func isLuaBlock(name string) bool {
+	return strings.HasSuffix(name, "_by_lua_block")
+}
+
 func readChars(reader io.Reader) chan string {
 	c := make(chan string)
 
@@ -191,16 +407,26 @@ func readChars(reader io.Reader) chan string {
 	return c
 }
 
-func lineCount(chars chan string) chan charLine {
+func lineCount(chars chan charLine, tabWidth int) chan charLine {
 	c := make(chan charLine)
 
 	go func() {
-		line := 1
-		for char := range chars {
-			if strings.HasSuffix(char, "\n") {
+		line, col := 1, 0
+		for cl := range chars {
+			if strings.HasSuffix(cl.char, "\n") {
 				line++
+				col = 0
+				cl.line, cl.col = line, col
+				c <- cl
+				continue
+			}
+			cl.line, cl.col = line, col+1
+			c <- cl
+			if cl.char == "\t" && tabWidth > 1 {
+				col += tabWidth - col%tabWidth
+			} else {
+				col += utf8.RuneCountInString(cl.char)
 			}
-			c <- charLine{char: char, line: line}
 		}
 		close(c)
 	}()
@@ -208,19 +434,22 @@ func lineCount(chars chan string) chan charLine {
 	return c
 }
 
-func escapeChars(chars chan string) chan string {
-	c := make(chan string)
+func escapeChars(chars chan string) chan charLine {
+	c := make(chan charLine)
 
 	go func() {
+		offset := 0
 		for char := range chars {
+			start := offset
 			if char == "\\" {
 				char += <-chars
 			}
+			offset += len(char)
 			// Skip carriage return characters.
 			if char == "\r" || char == "\\\r" {
 				continue
 			}
-			c <- char
+			c <- charLine{char: char, offset: start}
 		}
 		close(c)
 	}()
@@ -1,8 +1,10 @@
 package crossplane
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -152,7 +154,8 @@ var lexFixtures = []lexFixture{
 		tokenLine{"/status.html", 18},
 		tokenLine{"{", 18},
 		tokenLine{"try_files", 19},
-		tokenLine{"/abc/${uri} /abc/${uri}.html", 19},
+		tokenLine{"/abc/${uri}", 19},
+		tokenLine{"/abc/${uri}.html", 19},
 		tokenLine{"=404", 19},
 		tokenLine{";", 19},
 		tokenLine{"}", 20},
@@ -217,6 +220,69 @@ var lexFixtures = []lexFixture{
 		tokenLine{";", 15},
 		tokenLine{"}", 16},
 	}},
+	lexFixture{"escaped-braces", []tokenLine{
+		tokenLine{"events", 1},
+		tokenLine{"{", 1},
+		tokenLine{"}", 1},
+		tokenLine{"http", 2},
+		tokenLine{"{", 2},
+		tokenLine{"log_format", 3},
+		tokenLine{"json", 3},
+		tokenLine{"{\"uri\":\"$uri\",\"status\":$status}", 3},
+		tokenLine{";", 3},
+		tokenLine{"log_format", 4},
+		tokenLine{"escaped", 4},
+		tokenLine{"\\{uri:$uri\\}", 4},
+		tokenLine{";", 4},
+		tokenLine{"map", 5},
+		tokenLine{"$uri", 5},
+		tokenLine{"$brace", 5},
+		tokenLine{"{", 5},
+		tokenLine{"default", 6},
+		tokenLine{"\\}", 6},
+		tokenLine{";", 6},
+		tokenLine{"~^/a\\{", 7},
+		tokenLine{"open", 7},
+		tokenLine{";", 7},
+		tokenLine{"}", 8},
+		tokenLine{"server", 9},
+		tokenLine{"{", 9},
+		tokenLine{"location", 10},
+		tokenLine{"~", 10},
+		tokenLine{"^/foo\\}$", 10},
+		tokenLine{"{", 10},
+		tokenLine{"return", 11},
+		tokenLine{"200", 11},
+		tokenLine{"}", 11},
+		tokenLine{";", 11},
+		tokenLine{"}", 12},
+		tokenLine{"location", 13},
+		tokenLine{"~", 13},
+		tokenLine{"^/bar\\{2\\}$", 13},
+		tokenLine{"{", 13},
+		tokenLine{"set", 14},
+		tokenLine{"$name", 14},
+		tokenLine{"${uri}_suffix", 14},
+		tokenLine{";", 14},
+		tokenLine{"set", 15},
+		tokenLine{"$other", 15},
+		tokenLine{"${arg_x}", 15},
+		tokenLine{";", 15},
+		tokenLine{"return", 16},
+		tokenLine{"200", 16},
+		tokenLine{"${name}", 16},
+		tokenLine{";", 16},
+		tokenLine{"}", 17},
+		tokenLine{"}", 18},
+		tokenLine{"}", 19},
+	}},
+	lexFixture{"empty", []tokenLine{}},
+	lexFixture{"whitespace-only", []tokenLine{}},
+	lexFixture{"comments-only", []tokenLine{
+		tokenLine{"# nothing to see here", 1},
+		tokenLine{"# indented comment", 3},
+		tokenLine{"#no trailing newline", 4},
+	}},
 }
 
 func TestLex(t *testing.T) {
@@ -239,3 +305,89 @@ func TestLex(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenize(t *testing.T) {
+	t.Run("positions", func(t *testing.T) {
+		input := "events {\n    worker_connections 1024;\n}\nhttp { # comment\n\treturn 200 \"foo bar\";\n}\n"
+		tokens, err := Tokenize(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Token{
+			Token{Value: "events", Line: 1, Column: 1, Offset: 0},
+			Token{Value: "{", Line: 1, Column: 8, Offset: 7},
+			Token{Value: "worker_connections", Line: 2, Column: 5, Offset: 13},
+			Token{Value: "1024", Line: 2, Column: 24, Offset: 32},
+			Token{Value: ";", Line: 2, Column: 28, Offset: 36},
+			Token{Value: "}", Line: 3, Column: 1, Offset: 38},
+			Token{Value: "http", Line: 4, Column: 1, Offset: 40},
+			Token{Value: "{", Line: 4, Column: 6, Offset: 45},
+			Token{Value: "# comment", Line: 4, Column: 8, Offset: 47},
+			Token{Value: "return", Line: 5, Column: 2, Offset: 58},
+			Token{Value: "200", Line: 5, Column: 9, Offset: 65},
+			Token{Value: "foo bar", Line: 5, Column: 13, Offset: 69, IsQuoted: true},
+			Token{Value: ";", Line: 5, Column: 22, Offset: 78},
+			Token{Value: "}", Line: 6, Column: 1, Offset: 80},
+		}
+		if len(tokens) != len(expected) {
+			t.Fatalf("expected %d tokens but got %d: %v", len(expected), len(tokens), tokens)
+		}
+		for i, token := range tokens {
+			if token != expected[i] {
+				t.Fatalf("expected %+v but got %+v", expected[i], token)
+			}
+		}
+	})
+
+	t.Run("unbalanced", func(t *testing.T) {
+		tokens, err := Tokenize(strings.NewReader("http {\n    server {\n}\n"))
+		if err == nil {
+			t.Fatal("expected error to not be nil")
+		}
+		if len(tokens) != 5 {
+			t.Fatalf("expected 5 tokens before the error but got %d: %v", len(tokens), tokens)
+		}
+		if expected := `unexpected end of file, expecting "}" on line 3`; err.Error() != expected {
+			t.Fatalf("expected error %q but got %q", expected, err.Error())
+		}
+	})
+}
+
+func TestLexRaw(t *testing.T) {
+	var values []string
+	for token := range LexRaw(strings.NewReader("}\nhttp {\n    server {\n")) {
+		values = append(values, token.Value)
+	}
+	if expected := "} http { server {"; strings.Join(values, " ") != expected {
+		t.Fatalf("expected tokens %q but got %q", expected, values)
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	// a config with a few thousand servers, each with a handful of locations
+	var sb strings.Builder
+	sb.WriteString("http {\n")
+	for i := 0; i < 2000; i++ {
+		sb.WriteString("    server {\n        listen 127.0.0.1:8080;\n")
+		fmt.Fprintf(&sb, "        server_name server%d.example.com;\n", i)
+		for j := 0; j < 5; j++ {
+			fmt.Fprintf(&sb, "        location /path%d {\n", j)
+			sb.WriteString("            proxy_set_header Host $host; # comment\n")
+			sb.WriteString("            return 200 \"foo bar baz\";\n        }\n")
+		}
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("}\n")
+	input := sb.String()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for t := range lex(strings.NewReader(input)) {
+			if t.Error != nil {
+				b.Fatal(t.Error)
+			}
+		}
+	}
+}
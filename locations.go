@@ -0,0 +1,243 @@
+package crossplane
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LocationShadow is a location block that can never be used to handle a
+// request, because another location in the same block always wins.
+type LocationShadow struct {
+	File    string
+	Line    int
+	Problem string
+
+	// The location that can't be used and the one that wins instead.
+	Location   *Directive
+	ShadowedBy *Directive
+}
+
+// locationMatch is a location block's modifier, which is "" for a plain
+// prefix and "@" for a named location, and its path or regex.
+type locationMatch struct {
+	d        *Directive
+	modifier string
+	path     string
+}
+
+// regexes that match every URI, since every URI starts with "/"
+var catchAllRegexes = []string{"", "^", ".", "^.", ".*", "^.*", "/", "^/", "^/.*"}
+
+// ShadowedLocations finds location blocks that nginx will never choose,
+// comparing the locations that are directly inside the same server or
+// location block. This is a heuristic that only flags locations that are
+// obviously shadowed, and it doesn't try to work out what regexes can
+// match in general. It finds:
+//
+//   - locations that repeat another one's modifier and path, or regex
+//   - "~" regexes like "^/foo$" that only match the URI of an exact ("=")
+//     location, which nginx always checks first
+//   - "~" regexes like "^/static/" that only match URIs under a "^~"
+//     location, which stops nginx from checking regexes, unless a longer
+//     plain prefix location could be chosen for some of them
+//   - regexes after one that matches every URI, like "~ .*", and plain
+//     prefix locations without nested locations beside one
+//
+// The Location and ShadowedBy fields point into the config.
+func (c Config) ShadowedLocations() []LocationShadow {
+	shadows := []LocationShadow{}
+	checkLocations(c.File, c.Parsed, &shadows)
+	return shadows
+}
+
+func checkLocations(file string, block []Directive, shadows *[]LocationShadow) {
+	var locations []locationMatch
+	for i := range block {
+		if m, ok := parseLocationMatch(&block[i]); ok {
+			locations = append(locations, m)
+		}
+	}
+
+	for i, m := range locations {
+		if by, problem := locationShadowedBy(m, locations[:i], locations); by != nil {
+			*shadows = append(*shadows, LocationShadow{
+				File:       file,
+				Line:       m.d.Line,
+				Problem:    problem,
+				Location:   m.d,
+				ShadowedBy: by,
+			})
+		}
+	}
+
+	for i := range block {
+		if block[i].Block != nil {
+			checkLocations(file, *block[i].Block, shadows)
+		}
+	}
+}
+
+// parseLocationMatch reads the modifier and path of a location block, which
+// nginx also accepts without a space between them, like "=/foo".
+func parseLocationMatch(d *Directive) (locationMatch, bool) {
+	if d.Directive != "location" || d.Block == nil {
+		return locationMatch{}, false
+	}
+	switch len(d.Args) {
+	case 2:
+		return locationMatch{d: d, modifier: d.Args[0], path: d.Args[1]}, true
+	case 1:
+		arg := d.Args[0]
+		for _, modifier := range []string{"=", "^~", "~*", "~", "@"} {
+			if strings.HasPrefix(arg, modifier) {
+				return locationMatch{d: d, modifier: modifier, path: arg[len(modifier):]}, true
+			}
+		}
+		return locationMatch{d: d, path: arg}, true
+	}
+	return locationMatch{}, false
+}
+
+// locationShadowedBy returns the location that shadows m and why, or nil if
+// m isn't obviously shadowed. The earlier locations are the ones before m.
+func locationShadowedBy(m locationMatch, earlier, all []locationMatch) (*Directive, string) {
+	name := strings.Join(m.d.Args, " ")
+	isRegex := m.modifier == "~" || m.modifier == "~*"
+
+	for _, other := range earlier {
+		if locationKey(other) == locationKey(m) {
+			return other.d, fmt.Sprintf(`location "%s" is a duplicate of the location on line %d`, name, other.d.Line)
+		}
+	}
+
+	if isRegex {
+		for _, other := range earlier {
+			if (other.modifier == "~" || other.modifier == "~*") && contains(catchAllRegexes, other.path) {
+				return other.d, fmt.Sprintf(`location "%s" is never used because the regex location on line %d matches every URI`, name, other.d.Line)
+			}
+		}
+	} else if m.modifier == "" && !hasNestedLocations(*m.d) {
+		for _, other := range all {
+			if (other.modifier == "~" || other.modifier == "~*") && contains(catchAllRegexes, other.path) {
+				return other.d, fmt.Sprintf(`location "%s" is never used because the regex location on line %d matches every URI`, name, other.d.Line)
+			}
+		}
+	}
+
+	// only a case-sensitive regex is limited to the URIs that a prefix or
+	// exact location matches, unless what it matches has no letters
+	literal, anchored, full := regexLiteral(m.path)
+	if !isRegex || !anchored || (m.modifier == "~*" && strings.ToLower(literal) != strings.ToUpper(literal)) {
+		return nil, ""
+	}
+	for _, other := range all {
+		if full && other.modifier == "=" && other.path == literal {
+			return other.d, fmt.Sprintf(`location "%s" only matches the URI of the exact location on line %d`, name, other.d.Line)
+		}
+	}
+	for _, other := range all {
+		if other.modifier == "^~" && strings.HasPrefix(literal, other.path) && !hasLongerPrefix(other.path, literal, all) {
+			return other.d, fmt.Sprintf(`location "%s" only matches URIs that the "^~" location on line %d stops regexes from being checked for`, name, other.d.Line)
+		}
+	}
+	return nil, ""
+}
+
+// locationKey is the same for two locations if nginx would see them as
+// duplicates. Prefix locations are duplicates whether or not they use "^~".
+func locationKey(m locationMatch) string {
+	if m.modifier == "^~" {
+		return " " + m.path
+	}
+	return m.modifier + " " + m.path
+}
+
+// hasNestedLocations returns true if a location has locations inside of it,
+// which nginx checks before the regexes around it.
+func hasNestedLocations(d Directive) bool {
+	for _, stmt := range *d.Block {
+		if stmt.Directive == "location" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLongerPrefix returns true if there's a plain prefix location that's
+// longer than prefix and could be the longest match for a URI that starts
+// with literal, in which case nginx would go on to check regexes.
+func hasLongerPrefix(prefix, literal string, all []locationMatch) bool {
+	for _, other := range all {
+		if other.modifier != "" || len(other.path) <= len(prefix) || !strings.HasPrefix(other.path, prefix) {
+			continue
+		}
+		if strings.HasPrefix(other.path, literal) || strings.HasPrefix(literal, other.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexLiteral returns the literal text at the start of a regex, whether
+// the regex is anchored with "^", and whether the literal is all that the
+// regex matches, like "/foo" for "^/foo$". Only escaped punctuation is
+// treated as part of the literal. A regex with a "|" outside of any group,
+// like "^/foo|/bar", isn't anchored since the "^" only applies to the first
+// alternative.
+func regexLiteral(pattern string) (literal string, anchored bool, full bool) {
+	if !strings.HasPrefix(pattern, "^") || hasTopLevelAlternation(pattern) {
+		return "", false, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte(`./-\^$*+?()[]{}|`, pattern[i+1]) >= 0:
+			if i+2 < len(pattern) && strings.IndexByte("*?{", pattern[i+2]) >= 0 {
+				return b.String(), true, false
+			}
+			b.WriteByte(pattern[i+1])
+			i++
+		case c == '$' && i == len(pattern)-1:
+			return b.String(), true, true
+		case strings.IndexByte(`\.^$*+?()[]{}|`, c) >= 0:
+			return b.String(), true, false
+		case i+1 < len(pattern) && strings.IndexByte("*?{", pattern[i+1]) >= 0:
+			// the character is optional or repeated
+			return b.String(), true, false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true, false
+}
+
+// hasTopLevelAlternation returns true if the regex has a "|" that isn't
+// escaped or inside of a group or a character class.
+func hasTopLevelAlternation(pattern string) bool {
+	depth, class := 0, false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+			// a "]" right after the opening bracket is part of the class
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == '|' && depth == 0:
+			return true
+		}
+	}
+	return false
+}
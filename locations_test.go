@@ -0,0 +1,64 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShadowedLocations(t *testing.T) {
+	path := filepath.Join("testdata", "shadowed-locations", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	type shadow struct {
+		line, by int
+		problem  string
+	}
+	expected := []shadow{
+		{8, 5, `location "~ ^/health$" only matches the URI of the exact location on line 5`},
+		{14, 11, `location "~ ^/static/.*\.css$" only matches URIs that the "^~" location on line 11 stops regexes from being checked for`},
+		{23, 20, `location "^~ /api" is a duplicate of the location on line 20`},
+		{38, 35, `location "~ \.php$" is a duplicate of the location on line 35`},
+		{47, 55, `location "/" is never used because the regex location on line 55 matches every URI`},
+		{58, 55, `location "~ \.js$" is never used because the regex location on line 55 matches every URI`},
+	}
+	got := []shadow{}
+	for _, s := range config.ShadowedLocations() {
+		if s.File != path || s.Location.Line != s.Line {
+			t.Fatalf("expected the shadow to be in %s on line %d but got %s", path, s.Location.Line, s.File)
+		}
+		got = append(got, shadow{s.Line, s.ShadowedBy.Line, s.Problem})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, got)
+	}
+}
+
+func TestRegexLiteral(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		literal  string
+		anchored bool
+		full     bool
+	}{
+		{`^/foo$`, "/foo", true, true},
+		{`^/foo\.html$`, "/foo.html", true, true},
+		{`^/static/`, "/static/", true, false},
+		{`^/fooo?$`, "/foo", true, false},
+		{`^/a\.?b`, "/a", true, false},
+		{`^/(a|b)`, "/", true, false},
+		{`^/foo|/bar`, "", false, false},
+		{`^/[|]foo`, "/", true, false},
+		{`\.php$`, "", false, false},
+	}
+	for _, test := range tests {
+		literal, anchored, full := regexLiteral(test.pattern)
+		if literal != test.literal || anchored != test.anchored || full != test.full {
+			t.Fatalf("%s: expected %q, %v, %v but got %q, %v, %v", test.pattern, test.literal, test.anchored, test.full, literal, anchored, full)
+		}
+	}
+}
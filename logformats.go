@@ -0,0 +1,124 @@
+package crossplane
+
+import "strings"
+
+// LogFormat is a format for access logs that's defined by a log_format
+// directive.
+type LogFormat struct {
+	Name   string
+	Format string
+
+	// The names of the variables that the format uses, without the "$",
+	// in the order that they first appear.
+	Variables []string
+
+	File string
+	Line int
+}
+
+// LogFormats returns the log formats that are defined by log_format
+// directives in the payload, in the order that they appear. A format that's
+// split across several arguments is joined into one string the way nginx
+// joins it, without anything between the parts, and the "escape=" parameter
+// isn't part of it. The predefined "combined" format is only included if the
+// payload defines it.
+func (p Payload) LogFormats() []LogFormat {
+	var formats []LogFormat
+	for _, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if d.Directive != "log_format" || len(d.Args) == 0 {
+				return true
+			}
+			parts := d.Args[1:]
+			if len(parts) > 0 && strings.HasPrefix(parts[0], "escape=") {
+				parts = parts[1:]
+			}
+			format := strings.Join(parts, "")
+			formats = append(formats, LogFormat{
+				Name:      d.Args[0],
+				Format:    format,
+				Variables: formatVariables(format),
+				File:      config.File,
+				Line:      d.Line,
+			})
+			return true
+		})
+	}
+	return formats
+}
+
+// formatVariables returns the names of the variables in a string, like
+// "remote_addr" for "$remote_addr" or "${remote_addr}", without duplicates.
+func formatVariables(s string) []string {
+	vars := []string{}
+	seen := map[string]bool{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			continue
+		}
+		start, end := i+1, i+1
+		braced := end < len(s) && s[end] == '{'
+		if braced {
+			start, end = start+1, end+1
+		}
+		for end < len(s) && isVariableChar(s[end]) {
+			end++
+		}
+		if end == start || (braced && (end == len(s) || s[end] != '}')) {
+			continue
+		}
+		if name := s[start:end]; !seen[name] {
+			seen[name] = true
+			vars = append(vars, name)
+		}
+		i = end - 1
+	}
+	return vars
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// UndefinedLogFormat is an access_log directive that uses a log format that
+// isn't defined anywhere in the payload.
+type UndefinedLogFormat struct {
+	File   string
+	Line   int
+	Format string
+}
+
+// UndefinedLogFormats finds the access_log directives whose format isn't
+// defined by any log_format directive in the payload. In http, the
+// predefined "combined" format doesn't need to be defined. Formats in http
+// and stream blocks are treated as one set of names, because included files
+// don't know which of the two they're in. error_log directives don't take a
+// format, so they aren't checked.
+func (p Payload) UndefinedLogFormats() []UndefinedLogFormat {
+	defined := map[string]bool{}
+	for _, format := range p.LogFormats() {
+		defined[format.Name] = true
+	}
+
+	var undefined []UndefinedLogFormat
+	for _, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			// nginx always reads the argument after the path as the format,
+			// even if it looks like a parameter such as "buffer=32k"
+			if d.Directive != "access_log" || len(d.Args) < 2 || d.Args[0] == "off" {
+				return true
+			}
+			format := d.Args[1]
+			if defined[format] || (format == "combined" && !contains(ctx, "stream")) {
+				return true
+			}
+			undefined = append(undefined, UndefinedLogFormat{
+				File:   config.File,
+				Line:   d.Line,
+				Format: format,
+			})
+			return true
+		})
+	}
+	return undefined
+}
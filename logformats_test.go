@@ -0,0 +1,64 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogFormats(t *testing.T) {
+	path := filepath.Join("testdata", "log-formats", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LogFormat{
+		LogFormat{
+			Name:      "main",
+			Format:    `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+			Variables: []string{"remote_addr", "remote_user", "time_local", "request", "status", "body_bytes_sent", "http_referer", "http_user_agent"},
+			File:      path,
+			Line:      3,
+		},
+		LogFormat{
+			Name:      "json",
+			Format:    `{"addr":"$remote_addr","time":"${time_iso8601}","addr_again":"$remote_addr"}`,
+			Variables: []string{"remote_addr", "time_iso8601"},
+			File:      path,
+			Line:      6,
+		},
+		LogFormat{
+			Name:      "plain",
+			Format:    "static",
+			Variables: []string{},
+			File:      path,
+			Line:      8,
+		},
+		LogFormat{
+			Name:      "proxy",
+			Format:    "$remote_addr [$time_local] $protocol $status",
+			Variables: []string{"remote_addr", "time_local", "protocol", "status"},
+			File:      path,
+			Line:      12,
+		},
+	}
+	if formats := payload.LogFormats(); !reflect.DeepEqual(formats, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, formats)
+	}
+}
+
+func TestUndefinedLogFormats(t *testing.T) {
+	path := filepath.Join("testdata", "undefined-log-formats", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []UndefinedLogFormat{
+		UndefinedLogFormat{File: path, Line: 8, Format: "missingformat"},
+		UndefinedLogFormat{File: path, Line: 14, Format: "buffer=32k"},
+		UndefinedLogFormat{File: path, Line: 22, Format: "combined"},
+	}
+	if undefined := payload.UndefinedLogFormats(); !reflect.DeepEqual(undefined, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, undefined)
+	}
+}
@@ -0,0 +1,190 @@
+package crossplane
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy determines how a directive from an override config is merged
+// into the block of a base config.
+type MergeStrategy int
+
+const (
+	// MergeReplace removes every directive in the base block that has the
+	// same name and puts the override's directives in place of the first one.
+	MergeReplace MergeStrategy = iota
+
+	// MergeAppend keeps the base block's directives with the same name and
+	// adds the override's directives after them.
+	MergeAppend
+
+	// MergeByKey matches directives by name and arguments (e.g. "location /foo"
+	// matches "location /foo"). Server blocks have no arguments, so they're
+	// matched by their server_name and listen addresses instead; an override
+	// server without one of those matches any base server's. Matching blocks
+	// are merged recursively, other matches are replaced, and directives
+	// without a match are appended.
+	MergeByKey
+)
+
+// MergeOptions determine the behavior of MergeConfigs.
+type MergeOptions struct {
+	// Maps directive names to the strategy used to merge them. Directives
+	// that aren't in this map are merged with MergeByKey if they're blocks
+	// and with MergeReplace otherwise.
+	Strategies map[string]MergeStrategy
+}
+
+// MergeConfigs overlays the directives of the override config onto the base
+// config and returns the result. Directives are only merged with directives
+// in the same block, and comments from the override config are not merged.
+// Neither of the given configs is modified.
+func MergeConfigs(base, override Config, options *MergeOptions) (Config, error) {
+	if options == nil {
+		options = &MergeOptions{}
+	}
+	parsed, err := mergeBlocks(base.Parsed, override.Parsed, options)
+	if err != nil {
+		return Config{}, err
+	}
+	base.Errors = append([]ConfigError{}, base.Errors...)
+	base.Parsed = parsed
+	return base, nil
+}
+
+func (o *MergeOptions) strategy(stmt Directive) MergeStrategy {
+	if strategy, ok := o.Strategies[stmt.Directive]; ok {
+		return strategy
+	}
+	if stmt.IsBlock() {
+		return MergeByKey
+	}
+	return MergeReplace
+}
+
+func mergeBlocks(base, override []Directive, options *MergeOptions) ([]Directive, error) {
+	merged := copyBlock(base)
+	replaced := map[string]bool{}
+
+	for _, stmt := range override {
+		if stmt.IsComment() {
+			continue
+		}
+		stmt = copyDirective(stmt)
+
+		switch options.strategy(stmt) {
+		case MergeReplace:
+			if !replaced[stmt.Directive] {
+				replaced[stmt.Directive] = true
+				var i int
+				merged, i = removeNamed(merged, stmt.Directive)
+				merged = insertDirective(merged, i, stmt)
+			} else {
+				merged = insertDirective(merged, afterLastNamed(merged, stmt.Directive), stmt)
+			}
+		case MergeAppend:
+			merged = insertDirective(merged, afterLastNamed(merged, stmt.Directive), stmt)
+		case MergeByKey:
+			i := indexByKey(merged, stmt)
+			if i < 0 {
+				merged = insertDirective(merged, afterLastNamed(merged, stmt.Directive), stmt)
+			} else if merged[i].IsBlock() && stmt.IsBlock() {
+				block, err := mergeBlocks(*merged[i].Block, *stmt.Block, options)
+				if err != nil {
+					return nil, err
+				}
+				merged[i].Block = &block
+			} else {
+				merged[i] = stmt
+			}
+		default:
+			return nil, fmt.Errorf("unknown merge strategy %d for directive %q", options.strategy(stmt), stmt.Directive)
+		}
+	}
+
+	return merged, nil
+}
+
+// removeNamed removes all directives with the given name from the block and
+// returns the index where the first one was, or the block's new length if
+// there were none.
+func removeNamed(block []Directive, name string) ([]Directive, int) {
+	kept := block[:0]
+	first := -1
+	for _, d := range block {
+		if d.Directive == name {
+			if first < 0 {
+				first = len(kept)
+			}
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if first < 0 {
+		first = len(kept)
+	}
+	return kept, first
+}
+
+// afterLastNamed returns the index after the last directive with the given
+// name, or the length of the block if there is none.
+func afterLastNamed(block []Directive, name string) int {
+	for i := len(block) - 1; i >= 0; i-- {
+		if block[i].Directive == name {
+			return i + 1
+		}
+	}
+	return len(block)
+}
+
+func indexByKey(block []Directive, stmt Directive) int {
+	if stmt.Directive == "server" && stmt.IsBlock() {
+		return indexServer(block, stmt)
+	}
+	key := mergeKey(stmt)
+	for i, d := range block {
+		if !d.IsComment() && mergeKey(d) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mergeKey(d Directive) string {
+	return d.Directive + "\x00" + strings.Join(d.Args, "\x00")
+}
+
+// indexServer returns the index of the first server block that has the same
+// server names and listen addresses as stmt, ignoring whichever of the two
+// stmt doesn't set, or -1 if there is none.
+func indexServer(block []Directive, stmt Directive) int {
+	names, listens := serverKeys(stmt)
+	for i, d := range block {
+		if d.Directive != "server" || !d.IsBlock() {
+			continue
+		}
+		dNames, dListens := serverKeys(d)
+		if (names == "" || names == dNames) && (listens == "" || listens == dListens) {
+			return i
+		}
+	}
+	return -1
+}
+
+// serverKeys returns the sorted server names and listen addresses of a
+// server block, each joined into a single string.
+func serverKeys(server Directive) (string, string) {
+	var names, listens []string
+	for _, d := range *server.Block {
+		switch {
+		case d.Directive == "server_name":
+			names = append(names, d.Args...)
+		case d.Directive == "listen" && len(d.Args) > 0:
+			listens = append(listens, d.Args[0])
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(listens)
+	return strings.Join(names, "\x00"), strings.Join(listens, "\x00")
+}
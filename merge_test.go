@@ -0,0 +1,205 @@
+package crossplane
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type mergeFixture struct {
+	name     string
+	options  *MergeOptions
+	base     string
+	override string
+	expected string
+}
+
+var mergeFixtures = []mergeFixture{
+	mergeFixture{
+		name:    "replace-and-merge-by-key",
+		options: nil,
+		base: strings.Join([]string{
+			"worker_processes 1;",
+			"http {",
+			"    gzip off;",
+			"    server {",
+			"        listen 80;",
+			"        location /foo {",
+			"            return 200 foo;",
+			"        }",
+			"        location /bar {",
+			"            return 200 bar;",
+			"        }",
+			"    }",
+			"}",
+		}, "\n"),
+		override: strings.Join([]string{
+			"worker_processes auto;",
+			"http {",
+			"    gzip on;",
+			"    server {",
+			"        location /foo {",
+			"            return 404;",
+			"        }",
+			"        location /baz {",
+			"            return 200 baz;",
+			"        }",
+			"    }",
+			"}",
+		}, "\n"),
+		expected: strings.Join([]string{
+			"worker_processes auto;",
+			"http {",
+			"    gzip on;",
+			"    server {",
+			"        listen 80;",
+			"        location /foo {",
+			"            return 404;",
+			"        }",
+			"        location /bar {",
+			"            return 200 bar;",
+			"        }",
+			"        location /baz {",
+			"            return 200 baz;",
+			"        }",
+			"    }",
+			"}",
+		}, "\n"),
+	},
+	mergeFixture{
+		name:    "append",
+		options: &MergeOptions{Strategies: map[string]MergeStrategy{"add_header": MergeAppend}},
+		base: strings.Join([]string{
+			"add_header X-Foo foo;",
+			"add_header X-Bar bar;",
+			"root /srv;",
+		}, "\n"),
+		override: strings.Join([]string{
+			"add_header X-Baz baz;",
+			"root /var/www;",
+			"index index.html;",
+		}, "\n"),
+		expected: strings.Join([]string{
+			"add_header X-Foo foo;",
+			"add_header X-Bar bar;",
+			"add_header X-Baz baz;",
+			"root /var/www;",
+			"index index.html;",
+		}, "\n"),
+	},
+	mergeFixture{
+		name:    "merge-servers-by-name",
+		options: nil,
+		base: strings.Join([]string{
+			"http {",
+			"    server {",
+			"        listen 80;",
+			"        server_name a;",
+			"        root /a;",
+			"    }",
+			"    server {",
+			"        listen 80;",
+			"        server_name b;",
+			"        root /b;",
+			"    }",
+			"}",
+		}, "\n"),
+		override: strings.Join([]string{
+			"http {",
+			"    server {",
+			"        server_name b;",
+			"        root /srv/b;",
+			"    }",
+			"    server {",
+			"        listen 8080;",
+			"        server_name b;",
+			"        root /srv/b8080;",
+			"    }",
+			"}",
+		}, "\n"),
+		expected: strings.Join([]string{
+			"http {",
+			"    server {",
+			"        listen 80;",
+			"        server_name a;",
+			"        root /a;",
+			"    }",
+			"    server {",
+			"        listen 80;",
+			"        server_name b;",
+			"        root /srv/b;",
+			"    }",
+			"    server {",
+			"        listen 8080;",
+			"        server_name b;",
+			"        root /srv/b8080;",
+			"    }",
+			"}",
+		}, "\n"),
+	},
+	mergeFixture{
+		name:    "replace-blocks",
+		options: &MergeOptions{Strategies: map[string]MergeStrategy{"server": MergeReplace}},
+		base: strings.Join([]string{
+			"server {",
+			"    listen 80;",
+			"}",
+			"server {",
+			"    listen 81;",
+			"}",
+		}, "\n"),
+		override: strings.Join([]string{
+			"server {",
+			"    listen 8080;",
+			"}",
+		}, "\n"),
+		expected: strings.Join([]string{
+			"server {",
+			"    listen 8080;",
+			"}",
+		}, "\n"),
+	},
+}
+
+func TestMergeConfigs(t *testing.T) {
+	for _, fixture := range mergeFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			base := parseMergeInput(t, fixture.base)
+			override := parseMergeInput(t, fixture.override)
+			baseBefore := buildMergeOutput(t, base)
+
+			merged, err := MergeConfigs(base, override, fixture.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buildMergeOutput(t, merged); got != fixture.expected {
+				t.Fatalf("expected: %#v\nbut got: %#v", fixture.expected, got)
+			}
+			if got := buildMergeOutput(t, base); got != baseBefore {
+				t.Fatalf("base config was modified: %#v", got)
+			}
+		})
+	}
+}
+
+func parseMergeInput(t *testing.T, input string) Config {
+	payload, err := Parse("nginx.conf", &ParseOptions{
+		SingleFile:                true,
+		SkipDirectiveContextCheck: true,
+		Open:                      func(string) (io.Reader, error) { return strings.NewReader(input), nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload.Config[0]
+}
+
+func buildMergeOutput(t *testing.T, config Config) string {
+	var buf bytes.Buffer
+	if err := Build(&buf, config, &BuildOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -1,12 +1,18 @@
 package crossplane
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"syscall"
+	"unicode/utf8"
 )
 
 var dfltFileOpen = func(path string) (io.Reader, error) { return os.Open(path) }
@@ -24,12 +30,31 @@ type fileCtx struct {
 	ctx  blockCtx
 }
 
+// contentKey identifies a file by its contents and the context that it's
+// included into, since the same contents parse differently in different
+// contexts.
+type contentKey struct {
+	sum [sha256.Size]byte
+	ctx string
+}
+
 type parser struct {
 	configDir   string
 	options     *ParseOptions
 	handleError func(*Config, error)
+	handleWarn  func(*Config, error)
 	includes    []fileCtx
-	included    map[string]int
+	included    map[string]int     // config indexes by path
+	configs     int                // number of configs parsed or queued
+	hashed      map[contentKey]int // config indexes by content hash and context
+	open        func(path string) (io.Reader, error)
+	glob        func(pattern string) ([]string, error)
+	started     bool        // true once a directive in the current file is parsed
+	ignoring    int         // number of enclosing blocks ignored by a pragma
+	source      []byte      // contents of the current file if raw text is retained
+	parents     []Directive // the block directives enclosing the current one
+	version     []int       // the target version of nginx, if it's set
+	closing     ngxToken    // the "}" that closed the last block
 }
 
 // ParseOptions determine the behavior of an NGINX config parse.
@@ -56,6 +81,10 @@ type ParseOptions struct {
 	// resulting Payload.
 	ErrorOnUnknownDirectives bool
 
+	// If true, the errors for unknown directives suggest the known directive
+	// with the closest name, e.g. `(did you mean "proxy_pass"?)`.
+	SuggestDirectives bool
+
 	// If true, checks that directives are in valid contexts.
 	SkipDirectiveContextCheck bool
 
@@ -67,8 +96,150 @@ type ParseOptions struct {
 	// PayloadError struct that's added to the Payload struct's Errors array.
 	ErrorCallback func(error) interface{}
 
+	// If true, an explicit include of a file that doesn't exist adds a
+	// warning to the payload instead of an error, and parsing continues
+	// as if the include matched no files.
+	IgnoreMissingIncludes bool
+
+	// If true, the blocks of Lua directives, like content_by_lua_block, are
+	// read as raw Lua code instead of being parsed as directives. The code is
+	// added as the directive's last argument and the directive has no Block,
+	// and Build writes that argument back out as the block.
+	RawLuaBlocks bool
+
+	// If specified, this is called with the name and raw Lua code of the
+	// block of each Lua directive, like content_by_lua_block, and the
+	// directive that it returns is used in its place. Lua blocks are read as
+	// raw code when this is set, even if RawLuaBlocks isn't.
+	LuaBlockHandler func(name string, body string) (Directive, error)
+
 	// If specified, use this alternative to open config files
 	Open func(path string) (io.Reader, error)
+
+	// The context that the main config file is parsed in, for example
+	// []string{"http", "server"} for a file that's included in a server
+	// block. If empty, the main context is used.
+	DefaultContext []string
+
+	// If true, comments of the form "# crossplane:<pragma>" change how the
+	// rest of the file is parsed. The supported pragmas are:
+	//   - "ignore-next" skips analyzing the next directive.
+	//   - "ignore-block" skips analyzing the next block directive and
+	//     everything inside of it.
+	//   - "context <name>..." parses the file as if it were in the given
+	//     context (e.g. "context http server"). It must come before any
+	//     directives in the file.
+	ParsePragmas bool
+
+	// If true, the errors in the resulting Payload and in each of its Config
+	// structs are sorted by file and line instead of the order they were found.
+	SortErrors bool
+
+	// If true, add a warning to the payload when encountering a directive
+	// that's deprecated or obsolete in current versions of nginx, saying what
+	// to use instead.
+	WarnDeprecated bool
+
+	// If true, the Raw field of each directive is set to its unmodified text
+	// from the config file. For block directives, the text ends with the
+	// block's opening "{".
+	RetainRawText bool
+
+	// If true, add a warning to the payload for each "if" directive in a
+	// location, which the nginx docs warn can behave in surprising ways,
+	// suggesting what to use instead. An "if" whose block only has return
+	// directives or rewrite directives with the "last" flag isn't flagged,
+	// since the docs say those are safe.
+	WarnIfInLocation bool
+
+	// If true, an included file whose contents are the same as a file that
+	// was already included into the same context isn't parsed again, and the
+	// include directive's Includes point at the existing Config instead. This
+	// keeps a file that's reachable through several paths, like symlinks or
+	// "../" variations, from being parsed more than once. By default, files
+	// are only considered the same if their paths are.
+	DedupeByContent bool
+
+	// If true, blocks that are still open at the end of a file are closed as
+	// if the file ended with the right number of "}", instead of causing an
+	// error. This is useful for parsing partial configs.
+	AllowUnbalancedBraces bool
+
+	// If true, add an error to the payload when the condition of an "if"
+	// directive isn't one of the forms that nginx accepts.
+	ValidateIfConditions bool
+
+	// If true, a directive that's ended by the closing "}" of its block
+	// instead of by ";" is an error, even if the directive is unknown. Otherwise
+	// unknown directives that are missing their ";" are kept, and the "}"
+	// that ended them no longer closes their block.
+	StrictBlockTerminators bool
+
+	// If true, add a warning to the payload when the arguments of some
+	// directives are malformed, like set_real_ip_from with an invalid CIDR.
+	ValidateArgumentFormats bool
+
+	// If true, the Tokens field of each config is set to the tokens that the
+	// parser read from it, which helps with finding out why a config was
+	// parsed the way it was. The tokens are all kept in memory until the
+	// payload is discarded.
+	RetainTokens bool
+
+	// If specified, this is called with each directive as soon as it's been
+	// parsed, along with the context that it's in, like []string{"http",
+	// "server"}. The context is the one that's used to check where
+	// directives are allowed, so a location nested in another location is
+	// in []string{"http", "location"} too. A block directive is passed after
+	// all of the directives inside of it. Comments aren't passed.
+	OnDirective func(ctx []string, d Directive)
+
+	// If true, only the names and blocks of directives are kept, and their
+	// Args are left empty, which is faster when only the shape of a config
+	// is needed. The args of include directives are still kept so that the
+	// included files can be parsed. Since the other directives have no args,
+	// they aren't checked for their contexts or numbers of arguments.
+	SkeletonOnly bool
+
+	// If set, add a warning to the payload when a directive isn't in this
+	// version of nginx, like "1.18.0", because it was added in a later
+	// version or was removed. Only the directives whose history is known
+	// are checked.
+	NginxVersion string
+
+	// If true, the Column, EndLine, and EndColumn fields of each directive
+	// are set to where it starts and ends in its file, for tools like
+	// editors that need to find directives by their position.
+	RetainPositions bool
+
+	// The number of columns between tab stops, used for the Column and
+	// EndColumn fields of directives so that they match what an editor
+	// shows for tab-indented configs. If it's 0 or 1, a tab counts as one
+	// column like any other character.
+	TabWidth int
+
+	// If specified, use this alternative to find the files matching a globbed
+	// include pattern. It's only set by ParseFiles.
+	glob func(pattern string) ([]string, error)
+}
+
+// DefaultParseOptions returns the options that match how nginx itself reads
+// a config: included files are parsed into their own Config structs,
+// comments are left out, directives are checked for valid contexts and
+// numbers of arguments, and tabs count as one column. Unlike nginx, parsing
+// keeps going after an error so that every error is found, and unknown
+// directives are kept without being checked, since they may come from
+// modules that crossplane doesn't know about.
+func DefaultParseOptions() *ParseOptions {
+	return &ParseOptions{
+		StopParsingOnError:        false,
+		CombineConfigs:            false,
+		SingleFile:                false,
+		ParseComments:             false,
+		ErrorOnUnknownDirectives:  false,
+		SkipDirectiveContextCheck: false,
+		SkipDirectiveArgsCheck:    false,
+		TabWidth:                  1,
+	}
 }
 
 // Parse parses an NGINX configuration file.
@@ -98,18 +269,49 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 		payload.Errors = append(payload.Errors, perr)
 	}
 
+	handleWarn := func(config *Config, err error) {
+		var line *int
+		if e, ok := err.(ParseError); ok {
+			line = e.line
+		}
+		config.Warnings = append(config.Warnings, ConfigWarning{Line: line, Warning: err.Error()})
+		payload.Warnings = append(payload.Warnings, PayloadWarning{Line: line, Warning: err.Error(), File: config.File})
+	}
+
+	fileOpen := dfltFileOpen
+	if options.Open != nil {
+		fileOpen = options.Open
+	}
+
+	glob := filepath.Glob
+	if options.glob != nil {
+		glob = options.glob
+	}
+
 	// Start with the main nginx config file/context.
 	p := parser{
 		configDir:   filepath.Dir(filename),
 		options:     options,
 		handleError: handleError,
-		includes:    []fileCtx{fileCtx{path: filename, ctx: blockCtx{}}},
+		handleWarn:  handleWarn,
+		includes:    []fileCtx{fileCtx{path: filename, ctx: append(blockCtx{}, options.DefaultContext...)}},
 		included:    map[string]int{filename: 0},
+		configs:     1,
+		hashed:      map[contentKey]int{},
+		open:        fileOpen,
+		glob:        glob,
 	}
-
-	fileOpen := dfltFileOpen
-	if options.Open != nil {
-		fileOpen = options.Open
+	if options.NginxVersion != "" {
+		version, err := parseVersion(options.NginxVersion)
+		if err != nil {
+			return nil, err
+		}
+		p.version = version
+	}
+	if options.DedupeByContent {
+		if sum, ok := p.hashFile(filename); ok {
+			p.hashed[contentKey{sum, p.includes[0].ctx.key()}] = 0
+		}
 	}
 
 	for len(p.includes) > 0 {
@@ -121,13 +323,33 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 			return nil, err
 		}
 
-		tokens := lex(file)
+		// keep the file's contents around so directives can slice them
+		p.source = nil
+		if options.RetainRawText {
+			if p.source, err = ioutil.ReadAll(file); err != nil {
+				return nil, err
+			}
+			file = bytes.NewReader(p.source)
+		}
+
 		config := Config{
 			File:   incl.path,
 			Status: "ok",
 			Errors: []ConfigError{},
 			Parsed: []Directive{},
 		}
+		luaBlocks := options.RawLuaBlocks || options.LuaBlockHandler != nil
+		var tokens chan ngxToken
+		if options.AllowUnbalancedBraces {
+			tokens = balanceBraces(closeBlocks(tokenize(file, options.TabWidth, luaBlocks)))
+		} else {
+			tokens = balanceBraces(tokenize(file, options.TabWidth, luaBlocks))
+		}
+		if options.RetainTokens {
+			tokens = retainTokens(tokens, &config.Tokens)
+		}
+		p.started = false
+		p.parents = nil
 		parsed, err := p.parse(&config, tokens, incl.ctx, false)
 		if err != nil {
 			if options.StopParsingOnError {
@@ -141,6 +363,10 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 		payload.Config = append(payload.Config, config)
 	}
 
+	if options.SortErrors {
+		payload.SortErrors()
+	}
+
 	if options.CombineConfigs {
 		return payload.Combined()
 	}
@@ -148,20 +374,119 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 	return &payload, nil
 }
 
+// parseReader parses an NGINX config that's read from r instead of a file,
+// pretending that it's in the file with the given name, so that includes are
+// found relative to its directory. Other files are still opened using the
+// given options.
+func parseReader(r io.Reader, filename string, options *ParseOptions) (*Payload, error) {
+	fileOpen := dfltFileOpen
+	if options.Open != nil {
+		fileOpen = options.Open
+	}
+
+	opts := *options
+	opts.Open = func(path string) (io.Reader, error) {
+		if path == filename && r != nil {
+			reader := r
+			r = nil
+			return reader, nil
+		}
+		return fileOpen(path)
+	}
+
+	return Parse(filename, &opts)
+}
+
+// ParseSnippet parses a fragment of an NGINX config as if it were in the
+// given context, like []string{"http", "server"}, and returns its directives
+// along with any errors that were found. Include directives in the snippet
+// aren't followed. If options is nil, the default options are used.
+func ParseSnippet(s string, ctx []string, options *ParseOptions) ([]Directive, []error) {
+	opts := ParseOptions{}
+	if options != nil {
+		opts = *options
+	}
+	opts.SingleFile = true
+	opts.CombineConfigs = false
+	opts.DefaultContext = ctx
+
+	var errs []error
+	callback := opts.ErrorCallback
+	opts.ErrorCallback = func(err error) interface{} {
+		errs = append(errs, err)
+		if callback != nil {
+			return callback(err)
+		}
+		return nil
+	}
+
+	payload, err := parseReader(strings.NewReader(s), "nginx.conf", &opts)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return payload.Config[0].Parsed, errs
+}
+
+// ParseFiles parses an NGINX config made up of in-memory files instead of
+// files on disk. The files map holds the contents of each file keyed by its
+// path, and entry is the path of the main config file. Include directives
+// and their glob patterns are resolved against the other paths in the map.
+// If options is nil, the default options are used.
+func ParseFiles(files map[string][]byte, entry string, options *ParseOptions) (*Payload, error) {
+	contents := make(map[string][]byte, len(files))
+	for path, data := range files {
+		contents[filepath.Clean(path)] = data
+	}
+
+	if options == nil {
+		options = DefaultParseOptions()
+	}
+	opts := *options
+	opts.Open = func(path string) (io.Reader, error) {
+		data, ok := contents[filepath.Clean(path)]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: path, Err: syscall.ENOENT}
+		}
+		return bytes.NewReader(data), nil
+	}
+	opts.glob = func(pattern string) ([]string, error) {
+		var matches []string
+		for path := range contents {
+			matched, err := filepath.Match(pattern, path)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				matches = append(matches, path)
+			}
+		}
+		return matches, nil
+	}
+
+	return Parse(filepath.Clean(entry), &opts)
+}
+
 // parse Recursively parses directives from an nginx config context.
 func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, consume bool) ([]Directive, error) {
 	parsed := []Directive{}
+	ignoreNext, ignoreBlock := false, false
 
 	// parse recursively by pulling from a flat stream of tokens
 	for t := range tokens {
 		if t.Error != nil {
+			// the lexer doesn't know which file its errors are in
+			if perr, ok := t.Error.(ParseError); ok && perr.file == nil {
+				perr.file = &parsing.File
+				return nil, perr
+			}
 			return nil, t.Error
 		}
 
-		commentsInArgs := []string{}
+		commentsInArgs := []ngxToken{}
 
 		// we are parsing a block, so break if it's closing
 		if t.Value == "}" && !t.IsQuoted {
+			p.closing = t
 			break
 		}
 
@@ -181,27 +506,95 @@ func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, cons
 			Line:      t.Line,
 			Args:      []string{},
 		}
+		start := t
 
 		// if token is comment
 		if strings.HasPrefix(t.Value, "#") && !t.IsQuoted {
+			if name, args, ok := parsePragma(t.Value[1:]); ok && p.options.ParsePragmas {
+				var what string
+				switch {
+				case name == "ignore-next" && len(args) == 0:
+					ignoreNext = true
+				case name == "ignore-block" && len(args) == 0:
+					ignoreBlock = true
+				case name == "context" && !p.started:
+					ctx = blockCtx(args)
+				case name == "context":
+					what = `"crossplane:context" pragma must come before any directives`
+				default:
+					what = fmt.Sprintf(`invalid pragma "%s"`, strings.TrimSpace(t.Value[1:]))
+				}
+				if what != "" {
+					perr := ParseError{what: what, file: &parsing.File, line: &stmt.Line}
+					if p.options.StopParsingOnError {
+						return nil, perr
+					}
+					p.handleError(parsing, perr)
+				}
+			}
 			if p.options.ParseComments {
 				comment := t.Value[1:]
 				stmt.Directive = "#"
 				stmt.Comment = &comment
+				stmt.Raw = p.rawText(t.Offset, t.End)
+				p.setPosition(&stmt, t, t)
 				parsed = append(parsed, stmt)
 			}
 			continue
 		}
 
 		// parse arguments by reading tokens
-		t = <-tokens
-		for t.IsQuoted || (t.Value != "{" && t.Value != ";" && t.Value != "}") {
+		line := t.Line
+		var ok bool
+		t, ok = <-tokens
+		for ok && t.Error == nil && (t.IsQuoted || (t.Value != "{" && t.Value != ";" && t.Value != "}")) {
 			if strings.HasPrefix(t.Value, "#") && !t.IsQuoted {
-				commentsInArgs = append(commentsInArgs, t.Value[1:])
-			} else {
+				commentsInArgs = append(commentsInArgs, t)
+			} else if !p.options.SkeletonOnly || stmt.Directive == "include" {
 				stmt.Args = append(stmt.Args, t.Value)
 			}
-			t = <-tokens
+			line = t.Line
+			t, ok = <-tokens
+		}
+		if !ok {
+			return nil, ParseError{
+				what: `unexpected end of file, expecting ";" or "}"`,
+				file: &parsing.File,
+				line: &line,
+			}
+		} else if t.Error != nil {
+			if perr, ok := t.Error.(ParseError); ok && perr.file == nil {
+				perr.file = &parsing.File
+				return nil, perr
+			}
+			return nil, t.Error
+		}
+		p.started = true
+
+		// a directive that's ended by the "}" of its block was never
+		// terminated, so in strict mode it's an error instead of a directive
+		if p.options.StrictBlockTerminators && t.Value == "}" && !t.IsQuoted {
+			perr := ParseError{
+				what: fmt.Sprintf(`directive "%s" is not terminated by ";"`, stmt.Directive),
+				file: &parsing.File,
+				line: &stmt.Line,
+			}
+			if p.options.StopParsingOnError {
+				return nil, perr
+			}
+			p.handleError(parsing, perr)
+			p.closing = t
+			break
+		}
+		stmt.Raw = p.rawText(start.Offset, t.End)
+		end := t
+
+		// pragmas can turn off analysis of this directive and its block
+		ignored := p.ignoring > 0 || ignoreNext
+		ignoreNext = false
+		if ignoreBlock && t.Value == "{" && !t.IsQuoted {
+			ignored = true
+			ignoreBlock = false
 		}
 
 		// consume the directive if it is ignored and move on
@@ -219,7 +612,10 @@ func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, cons
 		}
 
 		// raise errors if this statement is invalid
-		err := analyze(parsing.File, stmt, t.Value, ctx, p.options)
+		var err error
+		if !ignored && (!p.options.SkeletonOnly || stmt.Directive == "include") {
+			err = analyze(parsing.File, stmt, t.Value, ctx, p.options)
+		}
 
 		if perr, ok := err.(ParseError); ok && !p.options.StopParsingOnError {
 			p.handleError(parsing, perr)
@@ -228,18 +624,49 @@ func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, cons
 				if t.Value != "}" && !t.IsQuoted {
 					_, _ = p.parse(parsing, tokens, nil, true)
 				} else {
+					p.closing = t
 					break
 				}
 			}
+			// skip the block of an "if" directive with an invalid condition
+			if strings.Contains(perr.what, `"if" condition`) && t.Value == "{" && !t.IsQuoted {
+				_, _ = p.parse(parsing, tokens, nil, true)
+			}
 			// keep on parsin'
 			continue
 		} else if err != nil {
 			return nil, err
 		}
 
+		if advice, ok := deprecatedDirectives[stmt.Directive]; ok && p.options.WarnDeprecated && !ignored {
+			p.handleWarn(parsing, ParseError{
+				what: fmt.Sprintf(`"%s" directive is deprecated, %s`, stmt.Directive, advice),
+				file: &parsing.File,
+				line: &stmt.Line,
+			})
+		}
+
+		if p.version != nil && !ignored {
+			if what := checkVersion(stmt, p.version); what != "" {
+				p.handleWarn(parsing, ParseError{what: what, file: &parsing.File, line: &stmt.Line})
+			}
+		}
+
+		if p.options.ValidateArgumentFormats && !p.options.SkeletonOnly && !ignored {
+			var parent *Directive
+			if len(p.parents) > 0 {
+				parent = &p.parents[len(p.parents)-1]
+			}
+			for _, what := range validateArgs(stmt, ctx, parent) {
+				p.handleWarn(parsing, ParseError{what: what, file: &parsing.File, line: &stmt.Line})
+			}
+		}
+
 		// add "includes" to the payload if this is an include statement
 		if !p.options.SingleFile && stmt.Directive == "include" {
-			pattern := stmt.Args[0]
+			// configs written for Windows separate paths with backslashes,
+			// so accept either separator no matter which OS we're on
+			pattern := filepath.FromSlash(strings.Replace(stmt.Args[0], `\`, "/", -1))
 			if !filepath.IsAbs(pattern) {
 				pattern = filepath.Join(p.configDir, pattern)
 			}
@@ -249,7 +676,7 @@ func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, cons
 			// get names of all included files
 			var fnames []string
 			if hasMagic.MatchString(pattern) {
-				fnames, err = filepath.Glob(pattern)
+				fnames, err = p.glob(pattern)
 				if err != nil {
 					return nil, err
 				}
@@ -257,57 +684,205 @@ func (p *parser) parse(parsing *Config, tokens chan ngxToken, ctx blockCtx, cons
 			} else {
 				// if the file pattern was explicit, nginx will check
 				// that the included file can be opened and read
-				if f, err := os.Open(pattern); err != nil {
+				if f, err := p.open(pattern); err != nil {
 					perr := ParseError{
 						what: err.Error(),
 						file: &parsing.File,
 						line: &stmt.Line,
 					}
-					if !p.options.StopParsingOnError {
+					if p.options.IgnoreMissingIncludes && os.IsNotExist(err) {
+						p.handleWarn(parsing, perr)
+					} else if !p.options.StopParsingOnError {
 						p.handleError(parsing, perr)
 					} else {
 						return nil, perr
 					}
 				} else {
-					f.Close()
+					if c, ok := f.(io.Closer); ok {
+						c.Close()
+					}
 					fnames = []string{pattern}
 				}
 			}
 
 			for _, fname := range fnames {
-				// the included set keeps files from being parsed twice
-				// TODO: handle files included from multiple contexts
-				if _, ok := p.included[fname]; !ok {
-					p.included[fname] = len(p.included)
-					p.includes = append(p.includes, fileCtx{fname, ctx})
-				}
-				*stmt.Includes = append(*stmt.Includes, p.included[fname])
+				*stmt.Includes = append(*stmt.Includes, p.include(fname, ctx))
 			}
 		}
 
 		// if this statement terminated with "{" then it is a block
 		if t.Value == "{" && !t.IsQuoted {
 			inner := enterBlockCtx(stmt, ctx) // get context for block
+			if ignored {
+				p.ignoring++
+			}
+			p.parents = append(p.parents, stmt)
+			p.closing = ngxToken{}
 			block, err := p.parse(parsing, tokens, inner, false)
+			p.parents = p.parents[:len(p.parents)-1]
+			end = p.closing
+			if ignored {
+				p.ignoring--
+			}
 			if err != nil {
 				return nil, err
 			}
+
+			// comments between the args and the opening brace are kept at
+			// the start of the block on their own lines, which is where
+			// Build writes them, so that they survive a round trip
+			if len(commentsInArgs) > 0 {
+				if p.options.ParseComments {
+					leading := make([]Directive, 0, len(commentsInArgs)+len(block))
+					for _, ct := range commentsInArgs {
+						comment := ct.Value[1:]
+						d := Directive{
+							Directive: "#",
+							Line:      ct.Line,
+							Args:      []string{},
+							Comment:   &comment,
+							Raw:       p.rawText(ct.Offset, ct.End),
+						}
+						p.setPosition(&d, ct, ct)
+						leading = append(leading, d)
+					}
+					block = append(leading, block...)
+				}
+				commentsInArgs = nil
+			}
 			stmt.Block = &block
+
+			if p.options.WarnIfInLocation && !ignored && stmt.Directive == "if" && ctx.key() == "http>location" {
+				if advice, ok := ifInLocationAdvice(stmt); ok {
+					p.handleWarn(parsing, ParseError{
+						what: fmt.Sprintf(`"if" directive in location is evil, %s`, advice),
+						file: &parsing.File,
+						line: &stmt.Line,
+					})
+				}
+			}
+
+			// the code of a Lua block is kept in place of its block, unless
+			// the handler replaces the whole directive
+			if t.LuaBody != nil && p.options.LuaBlockHandler == nil {
+				stmt.Args = append(stmt.Args, *t.LuaBody)
+				stmt.Block = nil
+			} else if t.LuaBody != nil {
+				handled, err := p.options.LuaBlockHandler(stmt.Directive, *t.LuaBody)
+				if err != nil {
+					perr := ParseError{what: err.Error(), file: &parsing.File, line: &stmt.Line}
+					if p.options.StopParsingOnError {
+						return nil, perr
+					}
+					p.handleError(parsing, perr)
+					continue
+				}
+				if handled.Line == 0 {
+					handled.Line = stmt.Line
+				}
+				stmt = handled
+			}
 		}
 
+		p.setPosition(&stmt, start, end)
+		if p.options.OnDirective != nil {
+			p.options.OnDirective(append([]string{}, ctx...), stmt)
+		}
 		parsed = append(parsed, stmt)
 
 		// add all comments found inside args after stmt is added
-		for _, comment := range commentsInArgs {
-			comment := comment
-			parsed = append(parsed, Directive{
+		for _, ct := range commentsInArgs {
+			comment := ct.Value[1:]
+			d := Directive{
 				Directive: "#",
 				Line:      stmt.Line,
 				Args:      []string{},
 				Comment:   &comment,
-			})
+				Raw:       p.rawText(ct.Offset, ct.End),
+			}
+			p.setPosition(&d, ct, ct)
+			parsed = append(parsed, d)
 		}
 	}
 
 	return parsed, nil
 }
+
+// include returns the index of the Config for an included file, queueing the
+// file to be parsed if it hasn't been included yet.
+func (p *parser) include(fname string, ctx blockCtx) int {
+	// the included set keeps files from being parsed twice
+	// TODO: handle files included from multiple contexts
+	if i, ok := p.included[fname]; ok {
+		return i
+	}
+
+	// files with the same contents as an included file share its Config
+	if p.options.DedupeByContent {
+		if sum, ok := p.hashFile(fname); ok {
+			key := contentKey{sum, ctx.key()}
+			if i, ok := p.hashed[key]; ok {
+				p.included[fname] = i
+				return i
+			}
+			p.hashed[key] = p.configs
+		}
+	}
+
+	i := p.configs
+	p.configs++
+	p.included[fname] = i
+	p.includes = append(p.includes, fileCtx{fname, ctx})
+	return i
+}
+
+// hashFile returns the SHA-256 hash of a file's contents, or false if the
+// file can't be read.
+func (p *parser) hashFile(fname string) ([sha256.Size]byte, bool) {
+	var sum [sha256.Size]byte
+	f, err := p.open(fname)
+	if err != nil {
+		return sum, false
+	}
+	if c, ok := f.(io.Closer); ok {
+		defer c.Close()
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, false
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, true
+}
+
+// setPosition sets the column that a directive starts at and the line and
+// column of its last character, which is in the end token, if positions are
+// being retained. The end token has to be on one line, like ";" or "}".
+func (p *parser) setPosition(d *Directive, start, end ngxToken) {
+	if !p.options.RetainPositions || end.Line == 0 {
+		return
+	}
+	d.Column = start.Column
+	d.EndLine = end.Line
+	d.EndColumn = end.Column + utf8.RuneCountInString(end.Value) - 1
+}
+
+// rawText returns the unmodified text of the current file between the two
+// byte offsets, or nil if raw text isn't being retained.
+func (p *parser) rawText(start, end int) *string {
+	if p.source == nil || start > end || end > len(p.source) {
+		return nil
+	}
+	raw := string(p.source[start:end])
+	return &raw
+}
+
+// parsePragma splits a comment like " crossplane:context http server" into
+// the pragma's name and arguments.
+func parsePragma(comment string) (string, []string, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "crossplane:") {
+		return "", nil, false
+	}
+	return strings.TrimPrefix(fields[0], "crossplane:"), fields[1:], true
+}
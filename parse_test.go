@@ -2,9 +2,14 @@ package crossplane
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -23,6 +28,10 @@ func pStr(s string) *string {
 	return &s
 }
 
+func pBool(b bool) *bool {
+	return &b
+}
+
 func noSuchFileErrMsg() string {
 	if runtime.GOOS == "windows" {
 		return "The system cannot find the file specified."
@@ -139,6 +148,116 @@ var parseFixtures = []parseFixture{
 			},
 		},
 	}},
+	parseFixture{"includes-regular", "-ignore-missing-includes", ParseOptions{IgnoreMissingIncludes: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "includes-regular", "conf.d", "server.conf"),
+				Warning: fmt.Sprintf(
+					"open %s: %s in %s:5",
+					filepath.Join("testdata", "includes-regular", "bar.conf"),
+					noSuchFileErrMsg(),
+					filepath.Join("testdata", "includes-regular", "conf.d", "server.conf"),
+				),
+				Line: pInt(5),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-regular", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"conf.d/server.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-regular", "conf.d", "server.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							"open %s: %s in %s:5",
+							filepath.Join("testdata", "includes-regular", "bar.conf"),
+							noSuchFileErrMsg(),
+							filepath.Join("testdata", "includes-regular", "conf.d", "server.conf"),
+						),
+						Line: pInt(5),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      2,
+							},
+							Directive{
+								Directive: "server_name",
+								Args:      []string{"default_server"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"foo.conf"},
+								Line:      4,
+								Includes:  &[]int{2},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"bar.conf"},
+								Line:      5,
+								Includes:  &[]int{},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-regular", "foo.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "location",
+						Args:      []string{"/foo"},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "return",
+								Args:      []string{"200", "foo"},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
 	parseFixture{"includes-regular", "-single-file", ParseOptions{SingleFile: true}, Payload{
 		Status: "ok",
 		Errors: []PayloadError{},
@@ -924,21 +1043,6440 @@ var parseFixtures = []parseFixture{
 			},
 		},
 	}},
-}
-
-func TestParse(t *testing.T) {
-	for _, fixture := range parseFixtures {
-		t.Run(fixture.name+fixture.suffix, func(t *testing.T) {
-			path := filepath.Join("testdata", fixture.name, "nginx.conf")
-			payload, err := Parse(path, &fixture.options)
-			if err != nil {
-				t.Fatal(err)
-			}
-			b1, _ := json.Marshal(fixture.expected)
-			b2, _ := json.Marshal(payload)
-			if string(b1) != string(b2) {
-				t.Fatalf("expected: %s\nbut got: %s", b1, b2)
-			}
-		})
+	parseFixture{"flag-or-path", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "flag-or-path", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "error_log",
+						Args:      []string{"stderr"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "error_log",
+						Args:      []string{"/var/log/x.log", "debug"},
+						Line:      2,
+					},
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      3,
+						Block: &[]Directive{
+							Directive{
+								Directive: "worker_connections",
+								Args:      []string{"1024"},
+								Line:      4,
+							},
+						},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      6,
+						Block: &[]Directive{
+							Directive{
+								Directive: "access_log",
+								Args:      []string{"off"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      8,
+								Block: &[]Directive{
+									Directive{
+										Directive: "access_log",
+										Args:      []string{"/var/log/access.log", "combined", "buffer=32k"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "proxy_next_upstream",
+										Args:      []string{"off"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      11,
+										Block: &[]Directive{
+											Directive{
+												Directive: "proxy_cache",
+												Args:      []string{"off"},
+												Line:      12,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      16,
+						Block: &[]Directive{
+							Directive{
+								Directive: "access_log",
+								Args:      []string{"off"},
+								Line:      17,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      18,
+								Block: &[]Directive{
+									Directive{
+										Directive: "proxy_next_upstream",
+										Args:      []string{"on"},
+										Line:      19,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"otel", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "otel", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "load_module",
+						Args:      []string{"modules/ngx_otel_module.so"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      2,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      3,
+						Block: &[]Directive{
+							Directive{
+								Directive: "otel_exporter",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "endpoint",
+										Args:      []string{"localhost:4317"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "interval",
+										Args:      []string{"5s"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "batch_size",
+										Args:      []string{"512"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "batch_count",
+										Args:      []string{"4"},
+										Line:      8,
+									},
+								},
+							},
+							Directive{
+								Directive: "otel_service_name",
+								Args:      []string{"nginx"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "otel_trace",
+								Args:      []string{"on"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      12,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      13,
+									},
+									Directive{
+										Directive: "otel_trace_context",
+										Args:      []string{"inject"},
+										Line:      14,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      15,
+										Block: &[]Directive{
+											Directive{
+												Directive: "otel_span_name",
+												Args:      []string{"root location"},
+												Line:      16,
+											},
+											Directive{
+												Directive: "otel_span_attr",
+												Args:      []string{"app.route", "/"},
+												Line:      17,
+											},
+											Directive{
+												Directive: "proxy_pass",
+												Args:      []string{"http://127.0.0.1:8081"},
+												Line:      18,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stream-map", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stream-map", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "map",
+								Args:      []string{"$ssl_preread_server_name", "$backend"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "hostnames",
+										Args:      []string{},
+										Line:      4,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"backend_default"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "example.com",
+										Args:      []string{"backend1"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "*.example.org",
+										Args:      []string{"backend2"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "",
+										Args:      []string{"backend_default"},
+										Line:      8,
+									},
+								},
+							},
+							Directive{
+								Directive: "geo",
+								Args:      []string{"$remote_addr", "$allowed"},
+								Line:      10,
+								Block: &[]Directive{
+									Directive{
+										Directive: "default",
+										Args:      []string{"0"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "10.0.0.0/8",
+										Args:      []string{"1"},
+										Line:      12,
+									},
+								},
+							},
+							Directive{
+								Directive: "split_clients",
+								Args:      []string{"${remote_addr}AAA", "$variant"},
+								Line:      14,
+								Block: &[]Directive{
+									Directive{
+										Directive: "50%",
+										Args:      []string{"backend1"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "*",
+										Args:      []string{"backend2"},
+										Line:      16,
+									},
+								},
+							},
+							Directive{
+								Directive: "match",
+								Args:      []string{"is_ok"},
+								Line:      18,
+								Block: &[]Directive{
+									Directive{
+										Directive: "send",
+										Args:      []string{"PING\\r\\n"},
+										Line:      19,
+									},
+									Directive{
+										Directive: "expect",
+										Args:      []string{"~", "PONG"},
+										Line:      20,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend1"},
+								Line:      22,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.1:443"},
+										Line:      23,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend2"},
+								Line:      25,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.2:443"},
+										Line:      26,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend_default"},
+								Line:      28,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.3:443"},
+										Line:      29,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      31,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443"},
+										Line:      32,
+									},
+									Directive{
+										Directive: "ssl_preread",
+										Args:      []string{"on"},
+										Line:      33,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"$backend"},
+										Line:      34,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"pragmas", "", ParseOptions{ParsePragmas: true, ErrorOnUnknownDirectives: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "pragmas", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unknown directive "bogus_directive" in %s:11`,
+					filepath.Join("testdata", "pragmas", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "pragmas", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unknown directive "bogus_directive" in %s:11`,
+							filepath.Join("testdata", "pragmas", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "proxy_passs",
+								Args:      []string{"http://127.0.0.1:8081"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "location",
+								Args:      []string{"/"},
+								Line:      7,
+								Block: &[]Directive{
+									Directive{
+										Directive: "unknown_directive",
+										Args:      []string{"foo"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "return",
+										Args:      []string{},
+										Line:      9,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"pragmas", "-default-context", ParseOptions{DefaultContext: []string{"http"}}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "pragmas", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid number of arguments in "return" directive in %s:9`,
+					filepath.Join("testdata", "pragmas", "nginx.conf"),
+				),
+				Line: pInt(9),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "pragmas", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid number of arguments in "return" directive in %s:9`,
+							filepath.Join("testdata", "pragmas", "nginx.conf"),
+						),
+						Line: pInt(9),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "proxy_passs",
+								Args:      []string{"http://127.0.0.1:8081"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "location",
+								Args:      []string{"/"},
+								Line:      7,
+								Block: &[]Directive{
+									Directive{
+										Directive: "unknown_directive",
+										Args:      []string{"foo"},
+										Line:      8,
+									},
+								},
+							},
+							Directive{
+								Directive: "bogus_directive",
+								Args:      []string{},
+								Line:      11,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"spelling-mistake", "-suggest-directives", ParseOptions{ParseComments: true, ErrorOnUnknownDirectives: true, SuggestDirectives: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "spelling-mistake", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unknown directive "proxy_passs" (did you mean "proxy_pass"?) in %s:7`,
+					filepath.Join("testdata", "spelling-mistake", "nginx.conf"),
+				),
+				Line: pInt(7),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "spelling-mistake", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unknown directive "proxy_passs" (did you mean "proxy_pass"?) in %s:7`,
+							filepath.Join("testdata", "spelling-mistake", "nginx.conf"),
+						),
+						Line: pInt(7),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      3,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      5,
+										Block: &[]Directive{
+											Directive{
+												Directive: "#",
+												Args:      []string{},
+												Line:      6,
+												Comment:   pStr("directive is misspelled"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"limit-except", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "limit-except", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`"root" directive is not allowed here in %s:11`,
+					filepath.Join("testdata", "limit-except", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "limit-except", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`"root" directive is not allowed here in %s:11`,
+							filepath.Join("testdata", "limit-except", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      5,
+										Block: &[]Directive{
+											Directive{
+												Directive: "limit_except",
+												Args:      []string{"GET", "POST"},
+												Line:      6,
+												Block: &[]Directive{
+													Directive{
+														Directive: "allow",
+														Args:      []string{"192.168.1.0/24"},
+														Line:      7,
+													},
+													Directive{
+														Directive: "deny",
+														Args:      []string{"all"},
+														Line:      8,
+													},
+													Directive{
+														Directive: "auth_basic",
+														Args:      []string{"closed site"},
+														Line:      9,
+													},
+													Directive{
+														Directive: "proxy_pass",
+														Args:      []string{"http://127.0.0.1:8081"},
+														Line:      10,
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"modsecurity", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "modsecurity", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "modsecurity",
+								Args:      []string{"on"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "modsecurity_rules_file",
+								Args:      []string{"/etc/nginx/modsec/main.conf"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      5,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "modsecurity_transaction_id",
+										Args:      []string{"host-$request_id"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      8,
+										Block: &[]Directive{
+											Directive{
+												Directive: "modsecurity_rules",
+												Args:      []string{"\n                SecRuleEngine On\n                SecRule ARGS \"@streq test\" \"id:1,phase:2,deny,status:403,msg:'blocked'\"\n            "},
+												Line:      9,
+											},
+											Directive{
+												Directive: "modsecurity_rules_remote",
+												Args:      []string{"my-server-key", "https://example.com/rules"},
+												Line:      13,
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "ok"},
+												Line:      14,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"deprecated", "-warn-deprecated", ParseOptions{WarnDeprecated: true, ParsePragmas: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "deprecated", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"spdy_chunk_size" directive is deprecated, use the "http2_chunk_size" directive instead in %s:3`,
+					filepath.Join("testdata", "deprecated", "nginx.conf"),
+				),
+				Line: pInt(3),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "deprecated", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"ssl" directive is deprecated, use the "listen ... ssl" directive instead in %s:6`,
+					filepath.Join("testdata", "deprecated", "nginx.conf"),
+				),
+				Line: pInt(6),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "deprecated", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2_push" directive is deprecated, HTTP/2 server push is no longer supported in %s:7`,
+					filepath.Join("testdata", "deprecated", "nginx.conf"),
+				),
+				Line: pInt(7),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "deprecated", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2_max_requests" directive is deprecated, use the "keepalive_requests" directive instead in %s:8`,
+					filepath.Join("testdata", "deprecated", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "deprecated", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"spdy_chunk_size" directive is deprecated, use the "http2_chunk_size" directive instead in %s:3`,
+							filepath.Join("testdata", "deprecated", "nginx.conf"),
+						),
+						Line: pInt(3),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"ssl" directive is deprecated, use the "listen ... ssl" directive instead in %s:6`,
+							filepath.Join("testdata", "deprecated", "nginx.conf"),
+						),
+						Line: pInt(6),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2_push" directive is deprecated, HTTP/2 server push is no longer supported in %s:7`,
+							filepath.Join("testdata", "deprecated", "nginx.conf"),
+						),
+						Line: pInt(7),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2_max_requests" directive is deprecated, use the "keepalive_requests" directive instead in %s:8`,
+							filepath.Join("testdata", "deprecated", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "spdy_chunk_size",
+								Args:      []string{"8k"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "ssl",
+										Args:      []string{"on"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "http2_push",
+										Args:      []string{"/style.css"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "http2_max_requests",
+										Args:      []string{"1000"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "http2_push_preload",
+										Args:      []string{"on"},
+										Line:      10,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"escaped-braces", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "escaped-braces", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"json", `{"uri":"$uri","status":$status}`},
+								Line:      3,
+							},
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"escaped", "\\{uri:$uri\\}"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "map",
+								Args:      []string{"$uri", "$brace"},
+								Line:      5,
+								Block: &[]Directive{
+									Directive{
+										Directive: "default",
+										Args:      []string{"\\}"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "~^/a\\{",
+										Args:      []string{"open"},
+										Line:      7,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      9,
+								Block: &[]Directive{
+									Directive{
+										Directive: "location",
+										Args:      []string{"~", "^/foo\\}$"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "}"},
+												Line:      11,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"~", "^/bar\\{2\\}$"},
+										Line:      13,
+										Block: &[]Directive{
+											Directive{
+												Directive: "set",
+												Args:      []string{"$name", "${uri}_suffix"},
+												Line:      14,
+											},
+											Directive{
+												Directive: "set",
+												Args:      []string{"$other", "${arg_x}"},
+												Line:      15,
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "${name}"},
+												Line:      16,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"unbalanced-braces", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "unbalanced-braces", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unexpected end of file, expecting "}" in %s:5`,
+					filepath.Join("testdata", "unbalanced-braces", "nginx.conf"),
+				),
+				Line: pInt(5),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "unbalanced-braces", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unexpected end of file, expecting "}" in %s:5`,
+							filepath.Join("testdata", "unbalanced-braces", "nginx.conf"),
+						),
+						Line: pInt(5),
+					},
+				},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"real-ip", "-validate-argument-formats", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`low address bits of 10.0.0.1/8 are meaningless in "set_real_ip_from" directive in %s:8`,
+					filepath.Join("testdata", "real-ip", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid CIDR "10.0.0.0/33" in "set_real_ip_from" directive in %s:9`,
+					filepath.Join("testdata", "real-ip", "nginx.conf"),
+				),
+				Line: pInt(9),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid address "192.168.1.300" in "set_real_ip_from" directive in %s:10`,
+					filepath.Join("testdata", "real-ip", "nginx.conf"),
+				),
+				Line: pInt(10),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid address "2001:db8::zz" in "set_real_ip_from" directive in %s:11`,
+					filepath.Join("testdata", "real-ip", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid header name "X Forwarded" in "real_ip_header" directive in %s:17`,
+					filepath.Join("testdata", "real-ip", "nginx.conf"),
+				),
+				Line: pInt(17),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "real-ip", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`low address bits of 10.0.0.1/8 are meaningless in "set_real_ip_from" directive in %s:8`,
+							filepath.Join("testdata", "real-ip", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid CIDR "10.0.0.0/33" in "set_real_ip_from" directive in %s:9`,
+							filepath.Join("testdata", "real-ip", "nginx.conf"),
+						),
+						Line: pInt(9),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid address "192.168.1.300" in "set_real_ip_from" directive in %s:10`,
+							filepath.Join("testdata", "real-ip", "nginx.conf"),
+						),
+						Line: pInt(10),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid address "2001:db8::zz" in "set_real_ip_from" directive in %s:11`,
+							filepath.Join("testdata", "real-ip", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid header name "X Forwarded" in "real_ip_header" directive in %s:17`,
+							filepath.Join("testdata", "real-ip", "nginx.conf"),
+						),
+						Line: pInt(17),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"192.168.1.0/24"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"192.168.2.1"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"2001:db8::/32"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"unix:"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"proxy.example.com"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"10.0.0.1/8"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"10.0.0.0/33"},
+								Line:      9,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"192.168.1.300"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "set_real_ip_from",
+								Args:      []string{"2001:db8::zz"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "real_ip_header",
+								Args:      []string{"X-Forwarded-For"},
+								Line:      12,
+							},
+							Directive{
+								Directive: "real_ip_recursive",
+								Args:      []string{"on"},
+								Line:      13,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      14,
+								Block: &[]Directive{
+									Directive{
+										Directive: "real_ip_header",
+										Args:      []string{"CF-Connecting-IP"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      16,
+										Block: &[]Directive{
+											Directive{
+												Directive: "real_ip_header",
+												Args:      []string{"X Forwarded"},
+												Line:      17,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"raw-text", "-retain-raw-text", ParseOptions{RetainRawText: true, ParseComments: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "raw-text", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "user",
+						Args:      []string{"nginx", "nginx"},
+						Line:      1,
+						Raw:       pStr(`user  nginx  "nginx" ;`),
+					},
+					Directive{
+						Directive: "#",
+						Args:      []string{},
+						Line:      1,
+						Comment:   pStr(" trailing"),
+						Raw:       pStr("# trailing"),
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Raw:       pStr("http {"),
+						Block: &[]Directive{
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"main", `$remote_addr "$request"`, `\"escaped\"`},
+								Line:      3,
+								Raw:       pStr("log_format main\n        '$remote_addr \"$request\"' # mid\n        \\\"escaped\\\";"),
+							},
+							Directive{
+								Directive: "#",
+								Args:      []string{},
+								Line:      3,
+								Comment:   pStr(" mid"),
+								Raw:       pStr("# mid"),
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      6,
+								Raw:       pStr("server {"),
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      6,
+										Raw:       pStr("listen 80;"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"directive-names", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "directive-names", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "gzip_http_version",
+								Args:      []string{"1.1"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "proxy_http_version",
+								Args:      []string{"1.1"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "fastcgi_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "fastcgi_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "grpc_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "grpc_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "memcached_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      9,
+							},
+							Directive{
+								Directive: "memcached_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "proxy_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "proxy_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      12,
+							},
+							Directive{
+								Directive: "scgi_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      13,
+							},
+							Directive{
+								Directive: "scgi_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      14,
+							},
+							Directive{
+								Directive: "uwsgi_next_upstream_timeout",
+								Args:      []string{"10s"},
+								Line:      15,
+							},
+							Directive{
+								Directive: "uwsgi_next_upstream_tries",
+								Args:      []string{"2"},
+								Line:      16,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      17,
+								Block: &[]Directive{
+									Directive{
+										Directive: "location",
+										Args:      []string{"/upstream_conf"},
+										Line:      18,
+										Block: &[]Directive{
+											Directive{
+												Directive: "upstream_conf",
+												Args:      []string{},
+												Line:      19,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "mail",
+						Args:      []string{},
+						Line:      23,
+						Block: &[]Directive{
+							Directive{
+								Directive: "auth_http",
+								Args:      []string{"http://127.0.0.1/auth"},
+								Line:      24,
+							},
+							Directive{
+								Directive: "auth_http_header",
+								Args:      []string{"X-Auth-Key", "secret"},
+								Line:      25,
+							},
+							Directive{
+								Directive: "auth_http_pass_client_cert",
+								Args:      []string{"on"},
+								Line:      26,
+							},
+							Directive{
+								Directive: "auth_http_timeout",
+								Args:      []string{"5s"},
+								Line:      27,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"lua-block-simple", "", ParseOptions{RawLuaBlocks: true, SkipDirectiveContextCheck: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "lua-block-simple", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "init_by_lua_block",
+								Args:      []string{"\n        print(\"Lua block code with curly brace str {\")\n    "},
+								Line:      2,
+							},
+							Directive{
+								Directive: "init_worker_by_lua_block",
+								Args:      []string{"\n        print(\"Work that every worker\")\n    "},
+								Line:      5,
+							},
+							Directive{
+								Directive: "body_filter_by_lua_block",
+								Args:      []string{"\n        local data, eof = ngx.arg[1], ngx.arg[2]\n    "},
+								Line:      8,
+							},
+							Directive{
+								Directive: "header_filter_by_lua_block",
+								Args:      []string{"\n        ngx.header[\"content-length\"] = nil\n    "},
+								Line:      11,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      14,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      16,
+										Block: &[]Directive{
+											Directive{
+												Directive: "content_by_lua_block",
+												Args:      []string{"\n                ngx.say(\"I need no extra escaping here, for example: \\r\\nblah\")\n            "},
+												Line:      17,
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "foo bar baz"},
+												Line:      20,
+											},
+										},
+									},
+									Directive{
+										Directive: "ssl_certificate_by_lua_block",
+										Args:      []string{"\n            print(\"About to initiate a new SSL handshake!\")\n        "},
+										Line:      22,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/a"},
+										Line:      25,
+										Block: &[]Directive{
+											Directive{
+												Directive: "client_max_body_size",
+												Args:      []string{"100k"},
+												Line:      26,
+											},
+											Directive{
+												Directive: "client_body_buffer_size",
+												Args:      []string{"100k"},
+												Line:      27,
+											},
+										},
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"foo"},
+								Line:      31,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"127.0.0.1"},
+										Line:      32,
+									},
+									Directive{
+										Directive: "balancer_by_lua_block",
+										Args:      []string{"\n            -- use Lua to do something interesting here\n        "},
+										Line:      33,
+									},
+									Directive{
+										Directive: "log_by_lua_block",
+										Args:      []string{"\n            print(\"I need no extra escaping here, for example: \\r\\nblah\")\n        "},
+										Line:      36,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"lua-block-long-brackets", "", ParseOptions{RawLuaBlocks: true, ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "lua-block-long-brackets", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      2,
+								Block: &[]Directive{
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      3,
+										Block: &[]Directive{
+											Directive{
+												Directive: "content_by_lua_block",
+												Args:      []string{"\n                --[[ a block comment with a } in it\n                     and a { too ]]\n                local s = [[a long string with a } in it]]\n                local t = [==[ a ]] doesn't end it, but } is fine ]==]\n                --[=[ a comment with a level ]=] ngx.say(s, t)\n            "},
+												Line:      4,
+											},
+											Directive{
+												Directive: "access_by_lua_block",
+												Args:      []string{"\n                -- a line comment with [[ doesn't start a long one }\n                ngx.exit(ngx.OK)\n            "},
+												Line:      11,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"lua-block-tricky", "", ParseOptions{RawLuaBlocks: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "lua-block-tricky", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      2,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      3,
+									},
+									Directive{
+										Directive: "server_name",
+										Args:      []string{"content_by_lua_block"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "set_by_lua_block",
+										Args:      []string{"$res", " -- irregular lua block directive\n            local a = 32\n            local b = 56\n\n            ngx.var.diff = a - b;  -- write to $diff directly\n            return a + b;          -- return the $sum value normally\n        "},
+										Line:      5,
+									},
+									Directive{
+										Directive: "rewrite_by_lua_block",
+										Args:      []string{" -- have valid braces in Lua code and quotes around directive\n            do_something(\"hello, world!\\nhiya\\n\")\n            a = { 1, 2, 3 }\n            btn = iup.button({title=\"ok\"})\n        "},
+										Line:      12,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"content_by_lua_block"},
+								Line:      18,
+								Block:     &[]Directive{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"comments-before-brace", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "comments-before-brace", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      3,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      6,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"200"},
+												Line:      8,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/a"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"204"},
+												Line:      13,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/b"},
+										Line:      15,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"404"},
+												Line:      18,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"comments-before-brace", "-parse-comments", ParseOptions{ParseComments: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "comments-before-brace", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      3,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "#",
+										Args:      []string{},
+										Line:      4,
+										Comment:   pStr(" inline"),
+									},
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      6,
+										Block: &[]Directive{
+											Directive{
+												Directive: "#",
+												Args:      []string{},
+												Line:      6,
+												Comment:   pStr(" before brace"),
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"200"},
+												Line:      8,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/a"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "#",
+												Args:      []string{},
+												Line:      11,
+												Comment:   pStr(" on its own line"),
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"204"},
+												Line:      13,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/b"},
+										Line:      15,
+										Block: &[]Directive{
+											Directive{
+												Directive: "#",
+												Args:      []string{},
+												Line:      15,
+												Comment:   pStr(" first"),
+											},
+											Directive{
+												Directive: "#",
+												Args:      []string{},
+												Line:      16,
+												Comment:   pStr(" second"),
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"404"},
+												Line:      18,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"includes-windows", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-windows", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"conf.d\\server.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"conf.d\\maps\\*.conf"},
+								Line:      4,
+								Includes:  &[]int{2},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-windows", "conf.d", "server.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      2,
+							},
+							Directive{
+								Directive: "server_name",
+								Args:      []string{"default_server"},
+								Line:      3,
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-windows", "conf.d", "maps", "api.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "map",
+						Args:      []string{"$host", "$api"},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "default",
+								Args:      []string{"1"},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"includes-dedupe", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip-copy.conf"},
+								Line:      4,
+								Includes:  &[]int{2},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"conf.d/*.conf"},
+								Line:      5,
+								Includes:  &[]int{3},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "snippets", "gzip.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "gzip",
+						Args:      []string{"on"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "gzip_types",
+						Args:      []string{"text/plain"},
+						Line:      2,
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "snippets", "gzip-copy.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "gzip",
+						Args:      []string{"on"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "gzip_types",
+						Args:      []string{"text/plain"},
+						Line:      2,
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "conf.d", "server.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      2,
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip-copy.conf"},
+								Line:      4,
+								Includes:  &[]int{2},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"includes-dedupe", "-dedupe-by-content", ParseOptions{DedupeByContent: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip-copy.conf"},
+								Line:      4,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"conf.d/*.conf"},
+								Line:      5,
+								Includes:  &[]int{2},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "snippets", "gzip.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "gzip",
+						Args:      []string{"on"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "gzip_types",
+						Args:      []string{"text/plain"},
+						Line:      2,
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe", "conf.d", "server.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"127.0.0.1:8080"},
+								Line:      2,
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"snippets/gzip-copy.conf"},
+								Line:      4,
+								Includes:  &[]int{1},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"includes-dedupe-contexts", "-dedupe-by-content", ParseOptions{DedupeByContent: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe-contexts", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"server.conf"},
+								Line:      3,
+								Includes:  &[]int{1},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      5,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"server-copy.conf"},
+								Line:      6,
+								Includes:  &[]int{2},
+							},
+						},
+					},
+					Directive{
+						Directive: "include",
+						Args:      []string{"nginx-copy.conf"},
+						Line:      8,
+						Includes:  &[]int{0},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe-contexts", "server.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"8080"},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-dedupe-contexts", "server-copy.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{"8080"},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stream-ssl-preread", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stream-ssl-preread", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "worker_connections",
+								Args:      []string{"1024"},
+								Line:      2,
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      4,
+						Block: &[]Directive{
+							Directive{
+								Directive: "map",
+								Args:      []string{"$ssl_preread_server_name", "$backend"},
+								Line:      5,
+								Block: &[]Directive{
+									Directive{
+										Directive: "hostnames",
+										Args:      []string{},
+										Line:      6,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"https_default"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "app.example.com",
+										Args:      []string{"app_backend"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "*.example.org",
+										Args:      []string{"org_backend"},
+										Line:      9,
+									},
+								},
+							},
+							Directive{
+								Directive: "map",
+								Args:      []string{"$ssl_preread_protocol", "$proto"},
+								Line:      11,
+								Block: &[]Directive{
+									Directive{
+										Directive: "",
+										Args:      []string{"plain"},
+										Line:      12,
+									},
+									Directive{
+										Directive: "TLSv1.3",
+										Args:      []string{"modern"},
+										Line:      13,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"legacy"},
+										Line:      14,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"https_default"},
+								Line:      16,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"127.0.0.1:8443"},
+										Line:      17,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"app_backend"},
+								Line:      19,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.1:443", "weight=2"},
+										Line:      20,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.2:443", "backup"},
+										Line:      21,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"org_backend"},
+								Line:      23,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.1.1:443"},
+										Line:      24,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      26,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443"},
+										Line:      27,
+									},
+									Directive{
+										Directive: "ssl_preread",
+										Args:      []string{"on"},
+										Line:      28,
+									},
+									Directive{
+										Directive: "preread_timeout",
+										Args:      []string{"10s"},
+										Line:      29,
+									},
+									Directive{
+										Directive: "preread_buffer_size",
+										Args:      []string{"16k"},
+										Line:      30,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"$backend"},
+										Line:      31,
+									},
+									Directive{
+										Directive: "proxy_connect_timeout",
+										Args:      []string{"5s"},
+										Line:      32,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"unclosed-blocks", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "unclosed-blocks", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unexpected end of file, expecting "}" in %s:8`,
+					filepath.Join("testdata", "unclosed-blocks", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "unclosed-blocks", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unexpected end of file, expecting "}" in %s:8`,
+							filepath.Join("testdata", "unclosed-blocks", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+				},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"unclosed-blocks", "-allow-unbalanced-braces", ParseOptions{AllowUnbalancedBraces: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "unclosed-blocks", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "worker_connections",
+								Args:      []string{"1024"},
+								Line:      2,
+							},
+						},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      4,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      5,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      7,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"200"},
+												Line:      8,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"limit-req", "", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid parameter "burts=5" in "limit_req" directive (did you mean "burst="?) in %s:10`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(10),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid burst value "five" in "limit_req" directive in %s:11`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid parameter "nodely" in "limit_req" directive (did you mean "nodelay"?) in %s:11`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid delay value "0" in "limit_req" directive in %s:14`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(14),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"limit_req" directive must have "zone" parameter in %s:14`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(14),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid number of connections "0" in "limit_conn" directive in %s:15`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(15),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`connection limit must be less than 65536 in "limit_conn" directive in %s:16`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(16),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid number of connections "many" in "limit_conn" directive in %s:25`,
+					filepath.Join("testdata", "limit-req", "nginx.conf"),
+				),
+				Line: pInt(25),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "limit-req", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid parameter "burts=5" in "limit_req" directive (did you mean "burst="?) in %s:10`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(10),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid burst value "five" in "limit_req" directive in %s:11`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid parameter "nodely" in "limit_req" directive (did you mean "nodelay"?) in %s:11`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid delay value "0" in "limit_req" directive in %s:14`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(14),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"limit_req" directive must have "zone" parameter in %s:14`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(14),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid number of connections "0" in "limit_conn" directive in %s:15`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(15),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`connection limit must be less than 65536 in "limit_conn" directive in %s:16`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(16),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid number of connections "many" in "limit_conn" directive in %s:25`,
+							filepath.Join("testdata", "limit-req", "nginx.conf"),
+						),
+						Line: pInt(25),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "limit_req_zone",
+								Args:      []string{"$binary_remote_addr", "zone=one:10m", "rate=1r/s"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "limit_conn_zone",
+								Args:      []string{"$binary_remote_addr", "zone=addr:10m"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      5,
+								Block: &[]Directive{
+									Directive{
+										Directive: "limit_req",
+										Args:      []string{"zone=one", "burst=5", "nodelay"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "limit_req",
+										Args:      []string{"zone=one", "burst=10", "delay=4"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "limit_conn",
+										Args:      []string{"addr", "10"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/typo"},
+										Line:      9,
+										Block: &[]Directive{
+											Directive{
+												Directive: "limit_req",
+												Args:      []string{"zone=one", "burts=5"},
+												Line:      10,
+											},
+											Directive{
+												Directive: "limit_req",
+												Args:      []string{"zone=one", "burst=five", "nodely"},
+												Line:      11,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/missing-zone"},
+										Line:      13,
+										Block: &[]Directive{
+											Directive{
+												Directive: "limit_req",
+												Args:      []string{"burst=5", "delay=0"},
+												Line:      14,
+											},
+											Directive{
+												Directive: "limit_conn",
+												Args:      []string{"addr", "0"},
+												Line:      15,
+											},
+											Directive{
+												Directive: "limit_conn",
+												Args:      []string{"addr", "70000"},
+												Line:      16,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      20,
+						Block: &[]Directive{
+							Directive{
+								Directive: "limit_conn_zone",
+								Args:      []string{"$binary_remote_addr", "zone=tcp:10m"},
+								Line:      21,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      22,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"12345"},
+										Line:      23,
+									},
+									Directive{
+										Directive: "limit_conn",
+										Args:      []string{"tcp", "1"},
+										Line:      24,
+									},
+									Directive{
+										Directive: "limit_conn",
+										Args:      []string{"tcp", "many"},
+										Line:      25,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"127.0.0.1:8080"},
+										Line:      26,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"if-conditions", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "if",
+										Args:      []string{"$slow"},
+										Line:      4,
+										Block: &[]Directive{
+											Directive{
+												Directive: "set",
+												Args:      []string{"$limit_rate", "10k"},
+												Line:      5,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$http_user_agent", "~*", "MSIE (\\d+)"},
+										Line:      7,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"403"},
+												Line:      8,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$request_method", "!=", "GET"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"405"},
+												Line:      11,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"!-f", "$request_filename"},
+										Line:      13,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"404"},
+												Line:      14,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$host", "==", "example.com"},
+										Line:      16,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"301"},
+												Line:      17,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"-f"},
+										Line:      19,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"500"},
+												Line:      20,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"example", "=", "$host"},
+										Line:      22,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"500"},
+												Line:      23,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$a", "=", "b", "c"},
+										Line:      25,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"500"},
+												Line:      26,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"if-conditions", "-validate-if-conditions", ParseOptions{ValidateIfConditions: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unexpected "==" in "if" condition in %s:16`,
+					filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				),
+				Line: pInt(16),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid "if" condition "-f" in %s:19`,
+					filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				),
+				Line: pInt(19),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid "if" condition "example = $host", it must start with a variable or a file test in %s:22`,
+					filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				),
+				Line: pInt(22),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid "if" condition "$a = b c" in %s:25`,
+					filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				),
+				Line: pInt(25),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "if-conditions", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unexpected "==" in "if" condition in %s:16`,
+							filepath.Join("testdata", "if-conditions", "nginx.conf"),
+						),
+						Line: pInt(16),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid "if" condition "-f" in %s:19`,
+							filepath.Join("testdata", "if-conditions", "nginx.conf"),
+						),
+						Line: pInt(19),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid "if" condition "example = $host", it must start with a variable or a file test in %s:22`,
+							filepath.Join("testdata", "if-conditions", "nginx.conf"),
+						),
+						Line: pInt(22),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid "if" condition "$a = b c" in %s:25`,
+							filepath.Join("testdata", "if-conditions", "nginx.conf"),
+						),
+						Line: pInt(25),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "if",
+										Args:      []string{"$slow"},
+										Line:      4,
+										Block: &[]Directive{
+											Directive{
+												Directive: "set",
+												Args:      []string{"$limit_rate", "10k"},
+												Line:      5,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$http_user_agent", "~*", "MSIE (\\d+)"},
+										Line:      7,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"403"},
+												Line:      8,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$request_method", "!=", "GET"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"405"},
+												Line:      11,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"!-f", "$request_filename"},
+										Line:      13,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"404"},
+												Line:      14,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"webdav", "", ParseOptions{ErrorOnUnknownDirectives: true, ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "webdav", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "PROPFIND" in "dav_methods" directive in %s:19`,
+					filepath.Join("testdata", "webdav", "nginx.conf"),
+				),
+				Line: pInt(19),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "webdav", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "PROPFIND" in "dav_methods" directive in %s:19`,
+							filepath.Join("testdata", "webdav", "nginx.conf"),
+						),
+						Line: pInt(19),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "dav_access",
+								Args:      []string{"user:rw", "group:rw", "all:r"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/webdav"},
+										Line:      6,
+										Block: &[]Directive{
+											Directive{
+												Directive: "root",
+												Args:      []string{"/var/www"},
+												Line:      7,
+											},
+											Directive{
+												Directive: "client_body_temp_path",
+												Args:      []string{"/var/tmp/webdav"},
+												Line:      8,
+											},
+											Directive{
+												Directive: "dav_methods",
+												Args:      []string{"PUT", "DELETE", "MKCOL", "COPY", "MOVE"},
+												Line:      9,
+											},
+											Directive{
+												Directive: "dav_ext_methods",
+												Args:      []string{"PROPFIND", "OPTIONS"},
+												Line:      10,
+											},
+											Directive{
+												Directive: "create_full_put_path",
+												Args:      []string{"on"},
+												Line:      11,
+											},
+											Directive{
+												Directive: "min_delete_depth",
+												Args:      []string{"1"},
+												Line:      12,
+											},
+											Directive{
+												Directive: "limit_except",
+												Args:      []string{"GET", "PROPFIND", "OPTIONS"},
+												Line:      13,
+												Block: &[]Directive{
+													Directive{
+														Directive: "allow",
+														Args:      []string{"192.168.1.0/24"},
+														Line:      14,
+													},
+													Directive{
+														Directive: "deny",
+														Args:      []string{"all"},
+														Line:      15,
+													},
+												},
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/uploads"},
+										Line:      18,
+										Block: &[]Directive{
+											Directive{
+												Directive: "dav_methods",
+												Args:      []string{"PUT", "PROPFIND"},
+												Line:      19,
+											},
+											Directive{
+												Directive: "dav_ext_methods",
+												Args:      []string{"off"},
+												Line:      20,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"container-includes", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "container-includes", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "types",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "include",
+										Args:      []string{"mime.types"},
+										Line:      4,
+										Includes:  &[]int{1},
+									},
+									Directive{
+										Directive: "application/x-custom",
+										Args:      []string{"custom"},
+										Line:      5,
+									},
+								},
+							},
+							Directive{
+								Directive: "map",
+								Args:      []string{"$http_host", "$backend"},
+								Line:      7,
+								Block: &[]Directive{
+									Directive{
+										Directive: "default",
+										Args:      []string{"web"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "include",
+										Args:      []string{"maps/hosts.map"},
+										Line:      9,
+										Includes:  &[]int{2},
+									},
+								},
+							},
+							Directive{
+								Directive: "geo",
+								Args:      []string{"$country"},
+								Line:      11,
+								Block: &[]Directive{
+									Directive{
+										Directive: "default",
+										Args:      []string{"ZZ"},
+										Line:      12,
+									},
+									Directive{
+										Directive: "include",
+										Args:      []string{"geo.conf"},
+										Line:      13,
+										Includes:  &[]int{3},
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      15,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      16,
+									},
+									Directive{
+										Directive: "return",
+										Args:      []string{"200", "$backend"},
+										Line:      17,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "container-includes", "mime.types"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "text/html",
+						Args:      []string{"html", "htm", "shtml"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "text/css",
+						Args:      []string{"css"},
+						Line:      2,
+					},
+					Directive{
+						Directive: "application/javascript",
+						Args:      []string{"js"},
+						Line:      3,
+					},
+					Directive{
+						Directive: "image/png",
+						Args:      []string{"png"},
+						Line:      4,
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "container-includes", "maps", "hosts.map"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "api.example.com",
+						Args:      []string{"api"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "hostnames",
+						Args:      []string{},
+						Line:      2,
+					},
+					Directive{
+						Directive: "*.example.org",
+						Args:      []string{"org"},
+						Line:      3,
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "container-includes", "geo.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "127.0.0.0/8",
+						Args:      []string{"US"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "10.0.0.0/8",
+						Args:      []string{"RU"},
+						Line:      2,
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"container-includes-invalid", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid number of arguments in "include" directive in %s:3`,
+					filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				),
+				Line: pInt(3),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`invalid number of arguments in "include" directive in %s:4`,
+					filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				),
+				Line: pInt(4),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`directive "include" is not terminated by ";" in %s:5`,
+					filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				),
+				Line: pInt(5),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid number of arguments in "include" directive in %s:3`,
+							filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+						),
+						Line: pInt(3),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`invalid number of arguments in "include" directive in %s:4`,
+							filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+						),
+						Line: pInt(4),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`directive "include" is not terminated by ";" in %s:5`,
+							filepath.Join("testdata", "container-includes-invalid", "nginx.conf"),
+						),
+						Line: pInt(5),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "types",
+								Args:      []string{},
+								Line:      2,
+								Block: &[]Directive{
+									Directive{
+										Directive: "text/css",
+										Args:      []string{"css"},
+										Line:      8,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"mail-proxy", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "mail-proxy", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "worker_connections",
+								Args:      []string{"1024"},
+								Line:      2,
+							},
+						},
+					},
+					Directive{
+						Directive: "mail",
+						Args:      []string{},
+						Line:      4,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server_name",
+								Args:      []string{"mail.example.com"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "auth_http",
+								Args:      []string{"localhost:9000/cgi-bin/nginxauth.cgi"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "auth_http_header",
+								Args:      []string{"X-Auth-Key", "secret"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "proxy_pass_error_message",
+								Args:      []string{"on"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "imap_capabilities",
+								Args:      []string{"IMAP4rev1", "UIDPLUS", "IDLE", "LITERAL+", "QUOTA"},
+								Line:      9,
+							},
+							Directive{
+								Directive: "pop3_auth",
+								Args:      []string{"plain", "apop", "cram-md5"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "pop3_capabilities",
+								Args:      []string{"LAST", "TOP", "USER", "PIPELINING", "UIDL"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "smtp_auth",
+								Args:      []string{"login", "plain", "cram-md5"},
+								Line:      12,
+							},
+							Directive{
+								Directive: "smtp_capabilities",
+								Args:      []string{"SIZE 10485760", "ENHANCEDSTATUSCODES", "8BITMIME", "DSN"},
+								Line:      13,
+							},
+							Directive{
+								Directive: "xclient",
+								Args:      []string{"off"},
+								Line:      14,
+							},
+							Directive{
+								Directive: "ssl_certificate",
+								Args:      []string{"/etc/ssl/certs/mail.pem"},
+								Line:      15,
+							},
+							Directive{
+								Directive: "ssl_certificate_key",
+								Args:      []string{"/etc/ssl/private/mail.key"},
+								Line:      16,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      17,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"25"},
+										Line:      18,
+									},
+									Directive{
+										Directive: "protocol",
+										Args:      []string{"smtp"},
+										Line:      19,
+									},
+									Directive{
+										Directive: "smtp_auth",
+										Args:      []string{"none"},
+										Line:      20,
+									},
+									Directive{
+										Directive: "xclient",
+										Args:      []string{"on"},
+										Line:      21,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      23,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"110"},
+										Line:      24,
+									},
+									Directive{
+										Directive: "protocol",
+										Args:      []string{"pop3"},
+										Line:      25,
+									},
+									Directive{
+										Directive: "proxy_pass_error_message",
+										Args:      []string{"on"},
+										Line:      26,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      28,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"143"},
+										Line:      29,
+									},
+									Directive{
+										Directive: "protocol",
+										Args:      []string{"imap"},
+										Line:      30,
+									},
+									Directive{
+										Directive: "starttls",
+										Args:      []string{"on"},
+										Line:      31,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      33,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"993", "ssl"},
+										Line:      34,
+									},
+									Directive{
+										Directive: "protocol",
+										Args:      []string{"imap"},
+										Line:      35,
+									},
+									Directive{
+										Directive: "auth_http",
+										Args:      []string{"localhost:9001/auth"},
+										Line:      36,
+									},
+									Directive{
+										Directive: "ssl_certificate",
+										Args:      []string{"/etc/ssl/certs/imaps.pem"},
+										Line:      37,
+									},
+									Directive{
+										Directive: "ssl_certificate_key",
+										Args:      []string{"/etc/ssl/private/imaps.key"},
+										Line:      38,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stray-terminators", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`"server" directive is not allowed here in %s:6`,
+					filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				),
+				Line: pInt(6),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`"server" directive is not allowed here in %s:6`,
+							filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+						),
+						Line: pInt(6),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      2,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      3,
+									},
+									Directive{
+										Directive: "stray",
+										Args:      []string{},
+										Line:      4,
+									},
+									Directive{
+										Directive: "listen",
+										Args:      []string{"81"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "mystery",
+										Args:      []string{"value"},
+										Line:      8,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stray-terminators", "-strict-block-terminators", ParseOptions{StrictBlockTerminators: true}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`directive "stray" is not terminated by ";" in %s:4`,
+					filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				),
+				Line: pInt(4),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`directive "mystery" is not terminated by ";" in %s:8`,
+					filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`directive "stray" is not terminated by ";" in %s:4`,
+							filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+						),
+						Line: pInt(4),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`directive "mystery" is not terminated by ";" in %s:8`,
+							filepath.Join("testdata", "stray-terminators", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      2,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      3,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      6,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"81"},
+										Line:      7,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"unterminated-directive", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "unterminated-directive", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`unexpected end of file, expecting ";" or "}" in %s:3`,
+					filepath.Join("testdata", "unterminated-directive", "nginx.conf"),
+				),
+				Line: pInt(3),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "unterminated-directive", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`unexpected end of file, expecting ";" or "}" in %s:3`,
+							filepath.Join("testdata", "unterminated-directive", "nginx.conf"),
+						),
+						Line: pInt(3),
+					},
+				},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"ssl-dual-certs", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "ssl-dual-certs", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "ssl_session_cache",
+								Args:      []string{"shared:SSL:10m"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "ssl_session_tickets",
+								Args:      []string{"on"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "ssl_session_ticket_key",
+								Args:      []string{"/etc/nginx/ssl/ticket.current.key"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "ssl_session_ticket_key",
+								Args:      []string{"/etc/nginx/ssl/ticket.previous.key"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      7,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "ssl"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "server_name",
+										Args:      []string{"example.com"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "ssl_certificate",
+										Args:      []string{"/etc/nginx/ssl/example.com.rsa.crt"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "ssl_certificate_key",
+										Args:      []string{"/etc/nginx/ssl/example.com.rsa.key"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "ssl_certificate",
+										Args:      []string{"/etc/nginx/ssl/example.com.ecdsa.crt"},
+										Line:      12,
+									},
+									Directive{
+										Directive: "ssl_certificate_key",
+										Args:      []string{"/etc/nginx/ssl/example.com.ecdsa.key"},
+										Line:      13,
+									},
+									Directive{
+										Directive: "ssl_protocols",
+										Args:      []string{"TLSv1.2", "TLSv1.3"},
+										Line:      14,
+									},
+									Directive{
+										Directive: "ssl_ciphers",
+										Args:      []string{"ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "ssl_prefer_server_ciphers",
+										Args:      []string{"off"},
+										Line:      16,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stream-proxy-pass", "", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`URL with a scheme "http://backend" is not allowed in stream "proxy_pass" directive in %s:28`,
+					filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				),
+				Line: pInt(28),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid port in "db.internal:99999" of the "proxy_pass" directive in %s:32`,
+					filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				),
+				Line: pInt(32),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`no path in the unix domain socket "unix:" in "proxy_pass" directive in %s:36`,
+					filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				),
+				Line: pInt(36),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`URL with a scheme "http://backend" is not allowed in stream "proxy_pass" directive in %s:28`,
+							filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+						),
+						Line: pInt(28),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid port in "db.internal:99999" of the "proxy_pass" directive in %s:32`,
+							filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+						),
+						Line: pInt(32),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`no path in the unix domain socket "unix:" in "proxy_pass" directive in %s:36`,
+							filepath.Join("testdata", "stream-proxy-pass", "nginx.conf"),
+						),
+						Line: pInt(36),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.1:5432"},
+										Line:      4,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      6,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"5432"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"backend"},
+										Line:      8,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      10,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"5433"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"10.0.0.2:5432"},
+										Line:      12,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      14,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"5434"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"[::1]:5432"},
+										Line:      16,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      18,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"5435"},
+										Line:      19,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"unix:/var/run/postgres.sock"},
+										Line:      20,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      22,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"5436"},
+										Line:      23,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"$upstream_addr"},
+										Line:      24,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      26,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"8080"},
+										Line:      27,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"http://backend"},
+										Line:      28,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      30,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"8081"},
+										Line:      31,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"db.internal:99999"},
+										Line:      32,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      34,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"8082"},
+										Line:      35,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"unix:"},
+										Line:      36,
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      39,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      40,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      41,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      42,
+										Block: &[]Directive{
+											Directive{
+												Directive: "proxy_pass",
+												Args:      []string{"http://127.0.0.1:8080"},
+												Line:      43,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"worker-cpu-affinity", "", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid mask "0x10" in "worker_cpu_affinity" directive in %s:5`,
+					filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+				),
+				Line: pInt(5),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid number of arguments in "worker_cpu_affinity" directive in %s:6`,
+					filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+				),
+				Line: pInt(6),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid mask "0x10" in "worker_cpu_affinity" directive in %s:5`,
+							filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+						),
+						Line: pInt(5),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid number of arguments in "worker_cpu_affinity" directive in %s:6`,
+							filepath.Join("testdata", "worker-cpu-affinity", "nginx.conf"),
+						),
+						Line: pInt(6),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "worker_processes",
+						Args:      []string{"4"},
+						Line:      1,
+					},
+					Directive{
+						Directive: "worker_cpu_affinity",
+						Args:      []string{"0001", "0010", "0100", "1000"},
+						Line:      2,
+					},
+					Directive{
+						Directive: "worker_cpu_affinity",
+						Args:      []string{"auto"},
+						Line:      3,
+					},
+					Directive{
+						Directive: "worker_cpu_affinity",
+						Args:      []string{"auto", "01010101"},
+						Line:      4,
+					},
+					Directive{
+						Directive: "worker_cpu_affinity",
+						Args:      []string{"0001", "0x10"},
+						Line:      5,
+					},
+					Directive{
+						Directive: "worker_cpu_affinity",
+						Args:      []string{"auto", "0101", "1010"},
+						Line:      6,
+					},
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      7,
+						Block:     &[]Directive{},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"if-in-location", "", ParseOptions{WarnIfInLocation: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"if" directive in location is evil, use "try_files" to check for files instead in %s:8`,
+					filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"if" directive in location is evil, use "map" to set variables instead, or only use "return" or "rewrite ... last" inside of it in %s:11`,
+					filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"if" directive in location is evil, use "map" to set variables instead, or only use "return" or "rewrite ... last" inside of it in %s:21`,
+					filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				),
+				Line: pInt(21),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "if-in-location", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"if" directive in location is evil, use "try_files" to check for files instead in %s:8`,
+							filepath.Join("testdata", "if-in-location", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"if" directive in location is evil, use "map" to set variables instead, or only use "return" or "rewrite ... last" inside of it in %s:11`,
+							filepath.Join("testdata", "if-in-location", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"if" directive in location is evil, use "map" to set variables instead, or only use "return" or "rewrite ... last" inside of it in %s:21`,
+							filepath.Join("testdata", "if-in-location", "nginx.conf"),
+						),
+						Line: pInt(21),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "if",
+										Args:      []string{"$host", "=", "www.example.com"},
+										Line:      4,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"301", "https://example.com$request_uri"},
+												Line:      5,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      7,
+										Block: &[]Directive{
+											Directive{
+												Directive: "if",
+												Args:      []string{"!-f", "$request_filename"},
+												Line:      8,
+												Block: &[]Directive{
+													Directive{
+														Directive: "rewrite",
+														Args:      []string{"^", "/index.php", "last"},
+														Line:      9,
+													},
+												},
+											},
+											Directive{
+												Directive: "if",
+												Args:      []string{"$http_user_agent", "~", "MSIE"},
+												Line:      11,
+												Block: &[]Directive{
+													Directive{
+														Directive: "rewrite",
+														Args:      []string{"^(.*)$", "/msie/$1", "break"},
+														Line:      12,
+													},
+												},
+											},
+											Directive{
+												Directive: "if",
+												Args:      []string{"$request_method", "=", "POST"},
+												Line:      14,
+												Block: &[]Directive{
+													Directive{
+														Directive: "return",
+														Args:      []string{"405"},
+														Line:      15,
+													},
+												},
+											},
+											Directive{
+												Directive: "if",
+												Args:      []string{"$args", "~", "debug"},
+												Line:      17,
+												Block: &[]Directive{
+													Directive{
+														Directive: "rewrite",
+														Args:      []string{"^", "/debug", "last"},
+														Line:      18,
+													},
+												},
+											},
+											Directive{
+												Directive: "location",
+												Args:      []string{"/nested"},
+												Line:      20,
+												Block: &[]Directive{
+													Directive{
+														Directive: "if",
+														Args:      []string{"$arg_x"},
+														Line:      21,
+														Block: &[]Directive{
+															Directive{
+																Directive: "add_header",
+																Args:      []string{"X-Arg", "$arg_x"},
+																Line:      22,
+															},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"quoted-escapes", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "quoted-escapes", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"json", "escape=json", `{"time":"$time_iso8601",`, `"request":"$request",`, `"ua":"$http_user_agent"}`},
+								Line:      3,
+							},
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"tabs", `$remote_addr\t$status\t"$request"`},
+								Line:      6,
+							},
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"mixed", `$remote_addr - "$remote_user" '$status'`},
+								Line:      7,
+							},
+							Directive{
+								Directive: "log_format",
+								Args:      []string{"literal-tab", "$host\t$uri"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"Content-Security-Policy", `default-src 'self'; script-src 'self' "https://cdn.example.com"`},
+								Line:      9,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"X-Path", "C:\\\\dir\\\\$uri"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"X-Trailing", "ends with a backslash \\\\"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"X-Escaped-Quote", `it's "quoted" \\'`},
+								Line:      12,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"X-Braces", "${host}{ok}"},
+								Line:      13,
+							},
+							Directive{
+								Directive: "add_header",
+								Args:      []string{"X-Multi", "a\nb  c"},
+								Line:      14,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"geoip2", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "geoip2", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "geoip2",
+								Args:      []string{"/etc/maxmind/GeoLite2-Country.mmdb"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "auto_reload",
+										Args:      []string{"5m"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "$geoip2_metadata_country_build",
+										Args:      []string{"metadata", "build_epoch"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "$geoip2_data_country_code",
+										Args:      []string{"default=US", "source=$remote_addr", "country", "iso_code"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "$geoip2_data_country_name",
+										Args:      []string{"country", "names", "en"},
+										Line:      7,
+									},
+								},
+							},
+							Directive{
+								Directive: "geoip2",
+								Args:      []string{"/etc/maxmind/GeoLite2-City.mmdb"},
+								Line:      9,
+								Block: &[]Directive{
+									Directive{
+										Directive: "$geoip2_data_city_name",
+										Args:      []string{"city", "names", "en"},
+										Line:      10,
+									},
+								},
+							},
+							Directive{
+								Directive: "geoip2_proxy",
+								Args:      []string{"203.0.113.0/24"},
+								Line:      12,
+							},
+							Directive{
+								Directive: "geoip2_proxy_recursive",
+								Args:      []string{"on"},
+								Line:      13,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      14,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "add_header",
+										Args:      []string{"X-Country", "$geoip2_data_country_code"},
+										Line:      16,
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      19,
+						Block: &[]Directive{
+							Directive{
+								Directive: "geoip2",
+								Args:      []string{"/etc/maxmind/GeoLite2-Country.mmdb"},
+								Line:      20,
+								Block: &[]Directive{
+									Directive{
+										Directive: "$geoip2_data_country_code",
+										Args:      []string{"country", "iso_code"},
+										Line:      21,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      23,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"12345"},
+										Line:      24,
+									},
+									Directive{
+										Directive: "return",
+										Args:      []string{"$geoip2_data_country_code"},
+										Line:      25,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"includes-globbed", "-skeleton-only", ParseOptions{SkeletonOnly: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "include",
+						Args:      []string{"http.conf"},
+						Line:      2,
+						Includes:  &[]int{1},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "http.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "include",
+								Args:      []string{"servers/*.conf"},
+								Line:      2,
+								Includes:  &[]int{2, 3},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "servers", "server1.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{},
+								Line:      2,
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"locations/*.conf"},
+								Line:      3,
+								Includes:  &[]int{4, 5},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "servers", "server2.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "server",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "listen",
+								Args:      []string{},
+								Line:      2,
+							},
+							Directive{
+								Directive: "include",
+								Args:      []string{"locations/*.conf"},
+								Line:      3,
+								Includes:  &[]int{4, 5},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "locations", "location1.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "location",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "return",
+								Args:      []string{},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "includes-globbed", "locations", "location2.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "location",
+						Args:      []string{},
+						Line:      1,
+						Block: &[]Directive{
+							Directive{
+								Directive: "return",
+								Args:      []string{},
+								Line:      2,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"empty", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "empty", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"whitespace-only", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "whitespace-only", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"comments-only", "", ParseOptions{}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "comments-only", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{},
+			},
+		},
+	}},
+	parseFixture{"comments-only", "-with-comments", ParseOptions{ParseComments: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "comments-only", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "#",
+						Args:      []string{},
+						Line:      1,
+						Comment:   pStr(" nothing to see here"),
+					},
+					Directive{
+						Directive: "#",
+						Args:      []string{},
+						Line:      3,
+						Comment:   pStr(" indented comment"),
+					},
+					Directive{
+						Directive: "#",
+						Args:      []string{},
+						Line:      4,
+						Comment:   pStr("no trailing newline"),
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"stream-njs", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "stream-njs", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "js_path",
+								Args:      []string{"/etc/nginx/njs/"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "js_import",
+								Args:      []string{"main.js"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "js_import",
+								Args:      []string{"tcp", "from", "stream/tcp.js"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "js_preload_object",
+								Args:      []string{"allowed", "from", "allowed.json"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "js_shared_dict_zone",
+								Args:      []string{"zone=sessions:1m", "timeout=60s", "evict"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "js_set",
+								Args:      []string{"$preread_server_name", "tcp.server_name"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "js_var",
+								Args:      []string{"$client_hello"},
+								Line:      9,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      10,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"12345"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "js_var",
+										Args:      []string{"$proto", "tcp"},
+										Line:      12,
+									},
+									Directive{
+										Directive: "js_set",
+										Args:      []string{"$upstream_name", "main.upstream", "nocache"},
+										Line:      13,
+									},
+									Directive{
+										Directive: "js_preread",
+										Args:      []string{"main.preread"},
+										Line:      14,
+									},
+									Directive{
+										Directive: "js_access",
+										Args:      []string{"main.access"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "js_filter",
+										Args:      []string{"tcp.filter"},
+										Line:      16,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"$upstream_name"},
+										Line:      17,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"upstream-servers", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			PayloadError{
+				File: filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`directive "server" is not terminated by ";" in %s:12`,
+					filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+				),
+				Line: pInt(12),
+			},
+			PayloadError{
+				File: filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+				Error: fmt.Sprintf(
+					`directive "server" has no opening "{" in %s:16`,
+					filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+				),
+				Line: pInt(16),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+				Status: "failed",
+				Errors: []ConfigError{
+					ConfigError{
+						Error: fmt.Sprintf(
+							`directive "server" is not terminated by ";" in %s:12`,
+							filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+						),
+						Line: pInt(12),
+					},
+					ConfigError{
+						Error: fmt.Sprintf(
+							`directive "server" has no opening "{" in %s:16`,
+							filepath.Join("testdata", "upstream-servers", "nginx.conf"),
+						),
+						Line: pInt(16),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "zone",
+										Args:      []string{"backend", "64k"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.1:80", "weight=5"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.2:80", "max_fails=3", "fail_timeout=30s"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.3:80", "backup"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.4:80", "down"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"unix:/var/run/backend.sock"},
+										Line:      9,
+									},
+								},
+							},
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"broken"},
+								Line:      11,
+								Block:     &[]Directive{},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      17,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      18,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      19,
+										Block: &[]Directive{
+											Directive{
+												Directive: "proxy_pass",
+												Args:      []string{"http://backend"},
+												Line:      20,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      24,
+						Block: &[]Directive{
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"dns"},
+								Line:      25,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.53:53", "weight=2", "max_conns=100"},
+										Line:      26,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.54:53", "backup"},
+										Line:      27,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      29,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"53", "udp"},
+										Line:      30,
+									},
+									Directive{
+										Directive: "proxy_pass",
+										Args:      []string{"dns"},
+										Line:      31,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"upstream-server-params", "", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid parameter "wieght=3" in "server" directive of upstream "backend" (did you mean "weight="?) in %s:10`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(10),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "weight=0" in "server" directive of upstream "backend" in %s:11`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "max_fails=x" in "server" directive of upstream "backend" in %s:11`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "fail_timeout=10q" in "server" directive of upstream "backend" in %s:11`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid port in upstream "10.0.0.5:http" in "server" directive of upstream "backend" in %s:12`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(12),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid address ":80" in "server" directive of upstream "backend" in %s:13`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(13),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`no port in upstream "10.0.0.54" in "server" directive of upstream "dns" in %s:19`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(19),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid parameter "backup=1" in "server" directive of upstream "dns" (did you mean "backup"?) in %s:19`,
+					filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				),
+				Line: pInt(19),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid parameter "wieght=3" in "server" directive of upstream "backend" (did you mean "weight="?) in %s:10`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(10),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "weight=0" in "server" directive of upstream "backend" in %s:11`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "max_fails=x" in "server" directive of upstream "backend" in %s:11`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "fail_timeout=10q" in "server" directive of upstream "backend" in %s:11`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid port in upstream "10.0.0.5:http" in "server" directive of upstream "backend" in %s:12`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(12),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid address ":80" in "server" directive of upstream "backend" in %s:13`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(13),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`no port in upstream "10.0.0.54" in "server" directive of upstream "dns" in %s:19`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(19),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid parameter "backup=1" in "server" directive of upstream "dns" (did you mean "backup"?) in %s:19`,
+							filepath.Join("testdata", "upstream-server-params", "nginx.conf"),
+						),
+						Line: pInt(19),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"backend"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "zone",
+										Args:      []string{"backend", "64k"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.1:80", "weight=5", "max_fails=3", "fail_timeout=30s"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"app.internal", "max_conns=100", "slow_start=1m", "resolve"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"[::1]:8080", "backup"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"unix:/var/run/app.sock", "down"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.2:80", "route=a"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.3:80", "wieght=3"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.4:80", "weight=0", "max_fails=x", "fail_timeout=10q"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.5:http"},
+										Line:      12,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{":80"},
+										Line:      13,
+									},
+								},
+							},
+						},
+					},
+					Directive{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      16,
+						Block: &[]Directive{
+							Directive{
+								Directive: "upstream",
+								Args:      []string{"dns"},
+								Line:      17,
+								Block: &[]Directive{
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.53:53", "weight=2"},
+										Line:      18,
+									},
+									Directive{
+										Directive: "server",
+										Args:      []string{"10.0.0.54", "backup=1"},
+										Line:      19,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"nginx-versions", "-1.18", ParseOptions{NginxVersion: "1.18.0"}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"keepalive_time" directive was added in nginx 1.19.10 in %s:3`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(3),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"quic" parameter of "listen" directive was added in nginx 1.25.0 in %s:6`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(6),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2" directive was added in nginx 1.25.1 in %s:8`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http3" directive was added in nginx 1.25.0 in %s:9`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(9),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"quic_retry" directive was added in nginx 1.25.0 in %s:10`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(10),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"ssl_reject_handshake" directive was added in nginx 1.19.4 in %s:11`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"keepalive_time" directive was added in nginx 1.19.10 in %s:3`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(3),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"quic" parameter of "listen" directive was added in nginx 1.25.0 in %s:6`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(6),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2" directive was added in nginx 1.25.1 in %s:8`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http3" directive was added in nginx 1.25.0 in %s:9`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(9),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"quic_retry" directive was added in nginx 1.25.0 in %s:10`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(10),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"ssl_reject_handshake" directive was added in nginx 1.19.4 in %s:11`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "keepalive_time",
+								Args:      []string{"1h"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "ssl", "http2"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "quic", "reuseport"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "ssl",
+										Args:      []string{"on"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "http2",
+										Args:      []string{"on"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "http3",
+										Args:      []string{"on"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "quic_retry",
+										Args:      []string{"on"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "ssl_reject_handshake",
+										Args:      []string{"off"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      12,
+										Block: &[]Directive{
+											Directive{
+												Directive: "http2_push",
+												Args:      []string{"/style.css"},
+												Line:      13,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"nginx-versions", "-1.25", ParseOptions{NginxVersion: "1.25"}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2" directive was added in nginx 1.25.1 in %s:8`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2" directive was added in nginx 1.25.1 in %s:8`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "keepalive_time",
+								Args:      []string{"1h"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "ssl", "http2"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "quic", "reuseport"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "ssl",
+										Args:      []string{"on"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "http2",
+										Args:      []string{"on"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "http3",
+										Args:      []string{"on"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "quic_retry",
+										Args:      []string{"on"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "ssl_reject_handshake",
+										Args:      []string{"off"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      12,
+										Block: &[]Directive{
+											Directive{
+												Directive: "http2_push",
+												Args:      []string{"/style.css"},
+												Line:      13,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"nginx-versions", "-1.27", ParseOptions{NginxVersion: "1.27.2"}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2" parameter of "listen" directive is deprecated since nginx 1.25.1, use the "http2" directive instead in %s:5`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(5),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"ssl" directive was removed in nginx 1.25.1 in %s:7`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(7),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"http2_push" directive was removed in nginx 1.25.1 in %s:13`,
+					filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				),
+				Line: pInt(13),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2" parameter of "listen" directive is deprecated since nginx 1.25.1, use the "http2" directive instead in %s:5`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(5),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"ssl" directive was removed in nginx 1.25.1 in %s:7`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(7),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"http2_push" directive was removed in nginx 1.25.1 in %s:13`,
+							filepath.Join("testdata", "nginx-versions", "nginx.conf"),
+						),
+						Line: pInt(13),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "keepalive_time",
+								Args:      []string{"1h"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      4,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "ssl", "http2"},
+										Line:      5,
+									},
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "quic", "reuseport"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "ssl",
+										Args:      []string{"on"},
+										Line:      7,
+									},
+									Directive{
+										Directive: "http2",
+										Args:      []string{"on"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "http3",
+										Args:      []string{"on"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "quic_retry",
+										Args:      []string{"on"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "ssl_reject_handshake",
+										Args:      []string{"off"},
+										Line:      11,
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/"},
+										Line:      12,
+										Block: &[]Directive{
+											Directive{
+												Directive: "http2_push",
+												Args:      []string{"/style.css"},
+												Line:      13,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"ssl-dynamic-certs", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "ssl-dynamic-certs", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "map",
+								Args:      []string{"$ssl_server_name", "$cert_name"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "default",
+										Args:      []string{"default"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "~^(?<domain>[^.]+)\\.example\\.com$",
+										Args:      []string{"$domain"},
+										Line:      5,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      7,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"443", "ssl"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "server_name",
+										Args:      []string{"*.example.com"},
+										Line:      9,
+									},
+									Directive{
+										Directive: "ssl_certificate",
+										Args:      []string{"/etc/nginx/certs/$cert_name.crt"},
+										Line:      10,
+									},
+									Directive{
+										Directive: "ssl_certificate_key",
+										Args:      []string{"/etc/nginx/certs/$cert_name.key"},
+										Line:      11,
+									},
+								},
+							},
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      13,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"8443", "ssl"},
+										Line:      14,
+									},
+									Directive{
+										Directive: "ssl_certificate",
+										Args:      []string{"$ssl_server_name.crt"},
+										Line:      15,
+									},
+									Directive{
+										Directive: "ssl_certificate_key",
+										Args:      []string{"data:$cert_key_pem"},
+										Line:      16,
+									},
+									Directive{
+										Directive: "ssl_password_file",
+										Args:      []string{"/etc/nginx/certs/passwords"},
+										Line:      17,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"error-page", "", ParseOptions{ValidateArgumentFormats: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Warnings: []PayloadWarning{
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`value "40" must be between 300 and 599 in "error_page" directive in %s:8`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(8),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "abc" in "error_page" directive in %s:9`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(9),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "=xyz" in "error_page" directive in %s:9`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(9),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`invalid value "499" in "error_page" directive in %s:10`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(10),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`"error_page" directive must have a status code in %s:11`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(11),
+			},
+			PayloadWarning{
+				File: filepath.Join("testdata", "error-page", "nginx.conf"),
+				Warning: fmt.Sprintf(
+					`missing URI after "500" in "error_page" directive in %s:12`,
+					filepath.Join("testdata", "error-page", "nginx.conf"),
+				),
+				Line: pInt(12),
+			},
+		},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "error-page", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Warnings: []ConfigWarning{
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`value "40" must be between 300 and 599 in "error_page" directive in %s:8`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(8),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "abc" in "error_page" directive in %s:9`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(9),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "=xyz" in "error_page" directive in %s:9`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(9),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`invalid value "499" in "error_page" directive in %s:10`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(10),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`"error_page" directive must have a status code in %s:11`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(11),
+					},
+					ConfigWarning{
+						Warning: fmt.Sprintf(
+							`missing URI after "500" in "error_page" directive in %s:12`,
+							filepath.Join("testdata", "error-page", "nginx.conf"),
+						),
+						Line: pInt(12),
+					},
+				},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"404", "/404.html"},
+								Line:      3,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"500", "502", "503", "504", "/50x.html"},
+								Line:      4,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"404", "=200", "/empty.gif"},
+								Line:      5,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"404", "=", "@fallback"},
+								Line:      6,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"403", "http://example.com/forbidden.html"},
+								Line:      7,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"40", "/40x.html"},
+								Line:      8,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"abc", "=xyz", "/foo"},
+								Line:      9,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"499", "/499.html"},
+								Line:      10,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"=200", "/empty.gif"},
+								Line:      11,
+							},
+							Directive{
+								Directive: "error_page",
+								Args:      []string{"404", "500"},
+								Line:      12,
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"map-geo-params", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "map-geo-params", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "map",
+								Args:      []string{"$http_host", "$backend"},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "hostnames",
+										Args:      []string{},
+										Line:      4,
+									},
+									Directive{
+										Directive: "volatile",
+										Args:      []string{},
+										Line:      5,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"backend_default"},
+										Line:      6,
+									},
+									Directive{
+										Directive: "include",
+										Args:      []string{"hosts.map"},
+										Line:      7,
+										Includes:  &[]int{1},
+									},
+									Directive{
+										Directive: "example.com",
+										Args:      []string{"backend_a"},
+										Line:      8,
+									},
+									Directive{
+										Directive: "*.example.org",
+										Args:      []string{"backend_b"},
+										Line:      9,
+									},
+								},
+							},
+							Directive{
+								Directive: "geo",
+								Args:      []string{"$remote_addr", "$region"},
+								Line:      11,
+								Block: &[]Directive{
+									Directive{
+										Directive: "ranges",
+										Args:      []string{},
+										Line:      12,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"unknown"},
+										Line:      13,
+									},
+									Directive{
+										Directive: "10.0.0.0-10.255.255.255",
+										Args:      []string{"internal"},
+										Line:      14,
+									},
+									Directive{
+										Directive: "192.168.1.0-192.168.1.255",
+										Args:      []string{"office"},
+										Line:      15,
+									},
+								},
+							},
+							Directive{
+								Directive: "geo",
+								Args:      []string{"$trusted"},
+								Line:      17,
+								Block: &[]Directive{
+									Directive{
+										Directive: "proxy_recursive",
+										Args:      []string{},
+										Line:      18,
+									},
+									Directive{
+										Directive: "proxy",
+										Args:      []string{"10.0.0.1"},
+										Line:      19,
+									},
+									Directive{
+										Directive: "default",
+										Args:      []string{"0"},
+										Line:      20,
+									},
+									Directive{
+										Directive: "delete",
+										Args:      []string{"127.0.0.0/16"},
+										Line:      21,
+									},
+									Directive{
+										Directive: "127.0.0.1",
+										Args:      []string{"1"},
+										Line:      22,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Config{
+				File:   filepath.Join("testdata", "map-geo-params", "hosts.map"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "www.example.net",
+						Args:      []string{"backend_c"},
+						Line:      1,
+					},
+					Directive{
+						Directive: ".example.io",
+						Args:      []string{"backend_d"},
+						Line:      2,
+					},
+				},
+			},
+		},
+	}},
+	parseFixture{"if-return-oneliners", "", ParseOptions{ErrorOnUnknownDirectives: true}, Payload{
+		Status: "ok",
+		Errors: []PayloadError{},
+		Config: []Config{
+			Config{
+				File:   filepath.Join("testdata", "if-return-oneliners", "nginx.conf"),
+				Status: "ok",
+				Errors: []ConfigError{},
+				Parsed: []Directive{
+					Directive{
+						Directive: "events",
+						Args:      []string{},
+						Line:      1,
+						Block:     &[]Directive{},
+					},
+					Directive{
+						Directive: "http",
+						Args:      []string{},
+						Line:      2,
+						Block: &[]Directive{
+							Directive{
+								Directive: "server",
+								Args:      []string{},
+								Line:      3,
+								Block: &[]Directive{
+									Directive{
+										Directive: "listen",
+										Args:      []string{"80"},
+										Line:      4,
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$http_user_agent", "~*", "bad bot"},
+										Line:      5,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"403"},
+												Line:      5,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$request_method", "=", "POST"},
+										Line:      6,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"405"},
+												Line:      6,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$scheme", "=", "http"},
+										Line:      7,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"301", "https://$host$request_uri"},
+												Line:      7,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"-f", "$request_filename"},
+										Line:      8,
+										Block: &[]Directive{
+											Directive{
+												Directive: "break",
+												Args:      []string{},
+												Line:      8,
+											},
+										},
+									},
+									Directive{
+										Directive: "if",
+										Args:      []string{"$args", "~", "(^|&)debug=1"},
+										Line:      9,
+										Block: &[]Directive{
+											Directive{
+												Directive: "set",
+												Args:      []string{"$debug", "1"},
+												Line:      9,
+											},
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "debug"},
+												Line:      9,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/gone"},
+										Line:      10,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"410"},
+												Line:      11,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/text"},
+										Line:      13,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"200", "hello world"},
+												Line:      14,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/redirect"},
+										Line:      16,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"301", "$scheme://example.com$request_uri"},
+												Line:      17,
+											},
+										},
+									},
+									Directive{
+										Directive: "location",
+										Args:      []string{"/url"},
+										Line:      19,
+										Block: &[]Directive{
+											Directive{
+												Directive: "return",
+												Args:      []string{"https://example.com/"},
+												Line:      20,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}},
+}
+
+func TestParse(t *testing.T) {
+	for _, fixture := range parseFixtures {
+		t.Run(fixture.name+fixture.suffix, func(t *testing.T) {
+			path := filepath.Join("testdata", fixture.name, "nginx.conf")
+			payload, err := Parse(path, &fixture.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b1, _ := json.Marshal(fixture.expected)
+			b2, _ := json.Marshal(payload)
+			if string(b1) != string(b2) {
+				t.Fatalf("expected: %s\nbut got: %s", b1, b2)
+			}
+		})
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	// parsing the in-memory copy of a fixture should match parsing it on disk
+	for _, name := range []string{"includes-regular", "includes-globbed", "simple"} {
+		t.Run(name, func(t *testing.T) {
+			files := map[string][]byte{}
+			dir := filepath.Join("testdata", name)
+			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				files[path], err = ioutil.ReadFile(path)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "nginx.conf")
+			expected, err := Parse(path, &ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// nil options are the same as the default options
+			for _, options := range []*ParseOptions{&ParseOptions{}, nil} {
+				payload, err := ParseFiles(files, path, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b1, _ := json.Marshal(expected)
+				b2, _ := json.Marshal(payload)
+				if string(b1) != string(b2) {
+					t.Fatalf("expected: %s\nbut got: %s", b1, b2)
+				}
+			}
+		})
+	}
+
+	t.Run("missing-include", func(t *testing.T) {
+		files := map[string][]byte{
+			"nginx.conf": []byte("events {}\nhttp {\n    include missing.conf;\n}\n"),
+		}
+		payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload.Errors) != 1 {
+			t.Fatalf("expected 1 error but got %v", payload.Errors)
+		}
+		expected := "open missing.conf: " + noSuchFileErrMsg() + " in nginx.conf:3"
+		if payload.Errors[0].Error != expected {
+			t.Fatalf("expected error %q but got %q", expected, payload.Errors[0].Error)
+		}
+	})
+
+	t.Run("missing-entry", func(t *testing.T) {
+		if _, err := ParseFiles(map[string][]byte{}, "nginx.conf", &ParseOptions{}); err == nil {
+			t.Fatal("expected an error for a missing entry file")
+		}
+	})
+}
+
+func TestParseSnippet(t *testing.T) {
+	t.Run("context", func(t *testing.T) {
+		snippet := "listen 80;\nlocation / {\n    return 200 ok;\n}\n"
+		parsed, errs := ParseSnippet(snippet, []string{"http", "server"}, &ParseOptions{})
+		if len(errs) != 0 {
+			t.Fatalf("expected no errors but got %v", errs)
+		}
+		expected := []Directive{
+			Directive{Directive: "listen", Line: 1, Args: []string{"80"}},
+			Directive{Directive: "location", Line: 2, Args: []string{"/"}, Block: &[]Directive{
+				Directive{Directive: "return", Line: 3, Args: []string{"200", "ok"}},
+			}},
+		}
+		if !blocksEqual(parsed, expected) {
+			t.Fatalf("expected: %v\nbut got: %v", expected, parsed)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		snippet := "listen 80;\nroot;\nindex index.html;\n"
+		parsed, errs := ParseSnippet(snippet, []string{"http"}, nil)
+		expected := []string{
+			`"listen" directive is not allowed here in nginx.conf:1`,
+			`invalid number of arguments in "root" directive in nginx.conf:2`,
+		}
+		if len(errs) != len(expected) {
+			t.Fatalf("expected %d errors but got %v", len(expected), errs)
+		}
+		for i, err := range errs {
+			if err.Error() != expected[i] {
+				t.Fatalf("expected error %q but got %q", expected[i], err.Error())
+			}
+		}
+		if len(parsed) != 1 || parsed[0].Directive != "index" {
+			t.Fatalf("expected only the index directive but got %v", parsed)
+		}
+	})
+
+	t.Run("stop-parsing-on-error", func(t *testing.T) {
+		parsed, errs := ParseSnippet("events {\n", nil, &ParseOptions{StopParsingOnError: true})
+		if parsed != nil || len(errs) != 1 {
+			t.Fatalf("expected a single error but got %v and %v", parsed, errs)
+		}
+	})
+}
+
+func TestParseLuaBlocksByDefault(t *testing.T) {
+	// without RawLuaBlocks, Lua code is parsed like any other block
+	parsed, errs := ParseSnippet("content_by_lua_block {\n    ngx.exit(200);\n}\n", []string{"http", "server", "location"}, &ParseOptions{})
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors but got %v", errs)
+	}
+	expected := []Directive{
+		Directive{Directive: "content_by_lua_block", Line: 1, Args: []string{}, Block: &[]Directive{
+			Directive{Directive: "ngx.exit(200)", Line: 2, Args: []string{}},
+		}},
+	}
+	if !blocksEqual(parsed, expected) {
+		t.Fatalf("expected: %v\nbut got: %v", expected, parsed)
+	}
+}
+
+func TestParseLuaBlockHandler(t *testing.T) {
+	var bodies []string
+	options := ParseOptions{
+		LuaBlockHandler: func(name string, body string) (Directive, error) {
+			bodies = append(bodies, body)
+			return Directive{Directive: name, Args: []string{strings.TrimSpace(body)}}, nil
+		},
+	}
+	parsed, errs := ParseSnippet("content_by_lua_block {\n    ngx.say(\"}\") -- }\n}\n", []string{"http", "server", "location"}, &options)
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors but got %v", errs)
+	}
+	expected := []Directive{
+		Directive{Directive: "content_by_lua_block", Line: 1, Args: []string{`ngx.say("}") -- }`}},
+	}
+	if !blocksEqual(parsed, expected) {
+		t.Fatalf("expected: %v\nbut got: %v", expected, parsed)
+	}
+	if len(bodies) != 1 || bodies[0] != "\n    ngx.say(\"}\") -- }\n" {
+		t.Fatalf("unexpected Lua block bodies: %q", bodies)
+	}
+
+	options.LuaBlockHandler = func(name string, body string) (Directive, error) {
+		return Directive{}, errors.New("bad lua")
+	}
+	parsed, errs = ParseSnippet("init_by_lua_block { x = 1 }\nindex index.html;\n", []string{"http"}, &options)
+	if len(errs) != 1 || errs[0].Error() != "bad lua in nginx.conf:1" {
+		t.Fatalf("expected a handler error but got %v", errs)
+	}
+	if len(parsed) != 1 || parsed[0].Directive != "index" {
+		t.Fatalf("expected only the index directive but got %v", parsed)
+	}
+}
+
+func TestParseRetainTokens(t *testing.T) {
+	dirname := filepath.Join("testdata", "includes-regular")
+	payload, err := Parse(filepath.Join(dirname, "nginx.conf"), &ParseOptions{RetainTokens: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range payload.Config {
+		f, err := os.Open(config.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := Tokenize(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config.Tokens, expected) {
+			t.Fatalf("expected tokens of %s: %v\nbut got: %v", config.File, expected, config.Tokens)
+		}
+	}
+
+	// tokens after a parse error are kept too
+	path := filepath.Join("testdata", "unterminated-directive", "nginx.conf")
+	payload, err = Parse(path, &ParseOptions{RetainTokens: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Status != "failed" || len(payload.Config[0].Tokens) == 0 {
+		t.Fatalf("expected a failed parse with tokens but got %s with %v", payload.Status, payload.Config[0].Tokens)
+	}
+
+	payload, err = Parse(filepath.Join(dirname, "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range payload.Config {
+		if config.Tokens != nil {
+			t.Fatalf("expected no tokens without RetainTokens but got %v", config.Tokens)
+		}
+	}
+}
+
+func TestParseOnDirective(t *testing.T) {
+	var seen []string
+	options := ParseOptions{
+		ParseComments: true,
+		OnDirective: func(ctx []string, d Directive) {
+			seen = append(seen, fmt.Sprintf("%s:%d %s", strings.Join(ctx, ">"), d.Line, d.Directive))
+		},
+	}
+	path := filepath.Join("testdata", "with-comments", "nginx.conf")
+	payload, err := Parse(path, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Status != "ok" {
+		t.Fatalf("expected a successful parse but got %v", payload.Errors)
+	}
+
+	// the block directives come after the directives inside of them
+
+	expected := []string{
+		"events:2 worker_connections",
+		":1 events",
+		"http>server:7 listen",
+		"http>server:8 server_name",
+		"http>location:11 return",
+		"http>server:9 location",
+		"http:6 server",
+		":5 http",
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Fatalf("expected: %q\nbut got: %q", expected, seen)
+	}
+}
+
+func TestParseInvalidNginxVersion(t *testing.T) {
+	path := filepath.Join("testdata", "simple", "nginx.conf")
+	for _, version := range []string{"1.x", "v1.25", "1..2", "1.-1"} {
+		_, err := Parse(path, &ParseOptions{NginxVersion: version})
+		if expected := fmt.Sprintf("invalid nginx version %q", version); err == nil || err.Error() != expected {
+			t.Fatalf("expected error %q but got %v", expected, err)
+		}
+	}
+}
+
+func TestParseTabWidth(t *testing.T) {
+	path := filepath.Join("testdata", "tab-indented", "nginx.conf")
+
+	// the columns of worker_connections, server, listen, and the end of listen
+	tests := []struct {
+		tabWidth int
+		columns  []int
+	}{
+		{0, []int{2, 2, 3, 24}},
+		{1, []int{2, 2, 3, 24}},
+		{4, []int{5, 5, 9, 31}},
+		{8, []int{9, 9, 17, 39}},
+	}
+	for _, test := range tests {
+		payload, err := Parse(path, &ParseOptions{RetainPositions: true, TabWidth: test.tabWidth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := payload.Config[0].Parsed
+		worker := (*parsed[0].Block)[0]
+		server := (*parsed[1].Block)[0]
+		listen := (*server.Block)[0]
+		columns := []int{worker.Column, server.Column, listen.Column, listen.EndColumn}
+		if !reflect.DeepEqual(columns, test.columns) {
+			t.Fatalf("tab width %d: expected columns %v but got %v", test.tabWidth, test.columns, columns)
+		}
+	}
+}
+
+func TestParseValidateArgumentFormatsWithWrongArgs(t *testing.T) {
+	// analyze doesn't check the number of args in unknown contexts or when
+	// told not to, so the validators can see any number of them
+	tests := []struct {
+		config  string
+		options ParseOptions
+	}{
+		{"foo { set_real_ip_from; real_ip_header; }", ParseOptions{}},
+		{"http { set_real_ip_from; }", ParseOptions{SkipDirectiveArgsCheck: true}},
+		{"foo { limit_conn z; limit_req; }", ParseOptions{}},
+		{"foo { error_page; error_page 404; }", ParseOptions{}},
+		{"worker_cpu_affinity;", ParseOptions{SkipDirectiveArgsCheck: true}},
+		{"stream { server { proxy_pass; } }", ParseOptions{SkipDirectiveArgsCheck: true}},
+		{"stream { upstream u { server; } }", ParseOptions{SkipDirectiveArgsCheck: true}},
+		{"http { upstream u { server; } }", ParseOptions{SkipDirectiveArgsCheck: true}},
+	}
+	for _, test := range tests {
+		options := test.options
+		options.ValidateArgumentFormats = true
+		if _, err := parseReader(strings.NewReader(test.config), "nginx.conf", &options); err != nil {
+			t.Fatalf("%s: %v", test.config, err)
+		}
 	}
 }
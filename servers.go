@@ -0,0 +1,333 @@
+package crossplane
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo describes a server block and the addresses and names that it
+// serves.
+type ServerInfo struct {
+	File        string
+	Line        int
+	Listens     []string
+	ServerNames []string
+	Directive   *Directive
+}
+
+// Servers returns every server block in the payload, in the order that they
+// appear, along with the first argument of each of its listen directives and
+// the arguments of its server_name directives. Servers in http, stream, and
+// mail blocks are all included, but the non-block server directives inside
+// upstream blocks are not. The Directive fields point into the payload's
+// configs, so changes made through them are reflected in the payload.
+func (p Payload) Servers() []ServerInfo {
+	var servers []ServerInfo
+	for _, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if d.Directive != "server" || d.Block == nil {
+				return true
+			}
+			server := ServerInfo{
+				File:      config.File,
+				Line:      d.Line,
+				Directive: d,
+			}
+			for _, stmt := range *d.Block {
+				switch stmt.Directive {
+				case "listen":
+					if len(stmt.Args) > 0 {
+						server.Listens = append(server.Listens, stmt.Args[0])
+					}
+				case "server_name":
+					server.ServerNames = append(server.ServerNames, stmt.Args...)
+				}
+			}
+			servers = append(servers, server)
+			return false
+		})
+	}
+	return servers
+}
+
+// ListenConflict describes two or more servers that listen on the same
+// address and can't be told apart by nginx, which makes all but one of them
+// unreachable for the conflicting requests.
+type ListenConflict struct {
+	// The top-level block that the servers are in, which is "http",
+	// "stream", or "mail".
+	Context string
+
+	// The normalized address, like "*:80" for "listen 80".
+	Address string
+
+	// True if the listens are for UDP, which is when they have the udp or
+	// quic parameter.
+	UDP bool
+
+	// The server name that's shared by the servers, which is empty if
+	// the servers have no server_name or if Default is true.
+	ServerName string
+
+	// True if more than one of the servers is the default_server for the
+	// address.
+	Default bool
+
+	// The conflicting listen directives, in the order that they appear.
+	Listens []ListenLocation
+}
+
+// ListenLocation is the file and line of a listen directive.
+type ListenLocation struct {
+	File string
+	Line int
+}
+
+// DuplicateListens finds servers in the same http, stream, or mail block that
+// listen on the same address and either share a server name, both have no
+// server_name and no default_server, or are both the default_server. TCP and
+// UDP listens never conflict with each other, and a server that listens on
+// the same address more than once is only counted once. The conflicts are
+// sorted by context, address, and then name.
+func (p Payload) DuplicateListens() []ListenConflict {
+	type key struct {
+		ctx  string
+		addr string
+		udp  bool
+	}
+	type listener struct {
+		loc        ListenLocation
+		names      []string
+		dfltServer bool
+	}
+
+	// the top-level context of each included file is the one that it was
+	// first included into, and files are parsed in the order that they're
+	// first included, so each config's includers are looked at before it is
+	top := map[int]string{}
+	byKey := map[key][]listener{}
+	for i, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			outer := top[i]
+			if outer == "" && len(ctx) > 0 {
+				outer = ctx[0]
+			}
+			if d.Includes != nil {
+				for _, j := range *d.Includes {
+					if _, ok := top[j]; !ok {
+						top[j] = outer
+					}
+				}
+			}
+			if d.Directive != "server" || d.Block == nil {
+				return true
+			}
+
+			var names []string
+			for _, stmt := range *d.Block {
+				if stmt.Directive == "server_name" {
+					names = append(names, stmt.Args...)
+				}
+			}
+			seen := map[key]int{}
+			for _, stmt := range *d.Block {
+				if stmt.Directive != "listen" || len(stmt.Args) == 0 {
+					continue
+				}
+				params := stmt.Args[1:]
+				k := key{
+					ctx:  outer,
+					addr: normalizeListen(stmt.Args[0]),
+					udp:  contains(params, "udp") || contains(params, "quic"),
+				}
+				dflt := contains(params, "default_server") || contains(params, "default")
+				if n, ok := seen[k]; ok {
+					byKey[k][n].dfltServer = byKey[k][n].dfltServer || dflt
+					continue
+				}
+				seen[k] = len(byKey[k])
+				byKey[k] = append(byKey[k], listener{
+					loc:        ListenLocation{File: config.File, Line: stmt.Line},
+					names:      names,
+					dfltServer: dflt,
+				})
+			}
+			return false
+		})
+	}
+
+	var conflicts []ListenConflict
+	for k, listeners := range byKey {
+		var dflts []ListenLocation
+		byName := map[string][]ListenLocation{}
+		for _, l := range listeners {
+			if l.dfltServer {
+				dflts = append(dflts, l.loc)
+			}
+			if len(l.names) == 0 || (len(l.names) == 1 && l.names[0] == "") {
+				// a nameless default server is explicitly the catch-all
+				if !l.dfltServer {
+					byName[""] = append(byName[""], l.loc)
+				}
+				continue
+			}
+			seen := map[string]bool{}
+			for _, name := range l.names {
+				if !seen[name] {
+					seen[name] = true
+					byName[name] = append(byName[name], l.loc)
+				}
+			}
+		}
+		if len(dflts) > 1 {
+			conflicts = append(conflicts, ListenConflict{Context: k.ctx, Address: k.addr, UDP: k.udp, Default: true, Listens: dflts})
+		}
+		for name, locs := range byName {
+			if len(locs) > 1 {
+				conflicts = append(conflicts, ListenConflict{Context: k.ctx, Address: k.addr, UDP: k.udp, ServerName: name, Listens: locs})
+			}
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if a.Context != b.Context {
+			return a.Context < b.Context
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		if a.UDP != b.UDP {
+			return !a.UDP
+		}
+		if a.Default != b.Default {
+			return a.Default
+		}
+		return a.ServerName < b.ServerName
+	})
+	return conflicts
+}
+
+// normalizeListen makes equivalent listen addresses compare equal, so that
+// "80", "*:80", and "0.0.0.0:80" are all "*:80", and "127.0.0.1" is
+// "127.0.0.1:80".
+func normalizeListen(addr string) string {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return addr
+	case strings.Trim(addr, "0123456789") == "":
+		addr = "*:" + addr
+	case strings.HasSuffix(addr, "]") || !strings.Contains(addr, ":"):
+		addr += ":80"
+	}
+	if strings.HasPrefix(addr, "0.0.0.0:") {
+		return "*:" + strings.TrimPrefix(addr, "0.0.0.0:")
+	}
+	return addr
+}
+
+// ListenSpec is the address and parameters of a listen directive.
+type ListenSpec struct {
+	// The host or IP address, which is "*" when only a port is given and
+	// empty for unix sockets. IPv6 addresses don't have brackets.
+	Address string
+
+	// The port, which is "80" when only an address is given and empty for
+	// unix sockets.
+	Port string
+
+	// The path of the socket for addresses like "unix:/var/run/nginx.sock".
+	UnixSocket string
+
+	SSL           bool
+	HTTP2         bool
+	HTTP3         bool // the quic parameter
+	DefaultServer bool // the default_server parameter, or its old name default
+	ProxyProtocol bool
+	Reuseport     bool
+	Backlog       int // 0 if the backlog parameter isn't set
+}
+
+// parameters of listen that ListenSpec doesn't keep, which are either flags
+// or end with "=" to take a value
+var otherListenParams = []string{
+	"accept_filter=", "bind", "deferred", "fastopen=", "ipv6only=",
+	"multipath", "rcvbuf=", "setfib=", "so_keepalive=", "sndbuf=", "udp",
+}
+
+// ParseListen reads the address and parameters of a listen directive. It
+// returns an error if the directive isn't a listen directive or if nginx
+// wouldn't accept its arguments, like when the port isn't a number or a
+// parameter is unknown.
+func ParseListen(d Directive) (ListenSpec, error) {
+	var spec ListenSpec
+	if d.Directive != "listen" || len(d.Args) == 0 {
+		return spec, fmt.Errorf(`invalid "%s" directive, expected listen with an address`, d.Directive)
+	}
+
+	addr := d.Args[0]
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		spec.UnixSocket = strings.TrimPrefix(addr, "unix:")
+		if spec.UnixSocket == "" {
+			return spec, fmt.Errorf(`no path in the unix domain socket "%s" in "listen" directive`, addr)
+		}
+	case strings.Trim(addr, "0123456789") == "":
+		spec.Address, spec.Port = "*", addr
+	case strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]"):
+		spec.Address, spec.Port = addr[1:len(addr)-1], "80"
+	case strings.Count(addr, ":") == 1 || strings.HasPrefix(addr, "["):
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" {
+			return spec, fmt.Errorf(`invalid address "%s" in "listen" directive`, addr)
+		}
+		spec.Address, spec.Port = host, port
+	default:
+		spec.Address, spec.Port = addr, "80"
+	}
+	if spec.Port != "" {
+		if n, err := strconv.Atoi(spec.Port); err != nil || n < 1 || n > 65535 {
+			return spec, fmt.Errorf(`invalid port in "%s" of the "listen" directive`, addr)
+		}
+	}
+
+	for _, param := range d.Args[1:] {
+		switch param {
+		case "ssl":
+			spec.SSL = true
+		case "http2":
+			spec.HTTP2 = true
+		case "quic":
+			spec.HTTP3 = true
+		case "default_server", "default":
+			spec.DefaultServer = true
+		case "proxy_protocol":
+			spec.ProxyProtocol = true
+		case "reuseport":
+			spec.Reuseport = true
+		default:
+			if strings.HasPrefix(param, "backlog=") {
+				n, err := strconv.Atoi(strings.TrimPrefix(param, "backlog="))
+				if err != nil || n <= 0 {
+					return spec, fmt.Errorf(`invalid backlog "%s" in "listen" directive`, param)
+				}
+				spec.Backlog = n
+			} else if !isListenParam(param) {
+				return spec, fmt.Errorf(`invalid parameter "%s" in "listen" directive`, param)
+			}
+		}
+	}
+	return spec, nil
+}
+
+func isListenParam(param string) bool {
+	for _, known := range otherListenParams {
+		if param == known || (strings.HasSuffix(known, "=") && strings.HasPrefix(param, known)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type serversFixture struct {
+	name     string
+	expected []ServerInfo
+}
+
+var serversFixtures = []serversFixture{
+	serversFixture{"simple", []ServerInfo{
+		ServerInfo{
+			File:        filepath.Join("testdata", "simple", "nginx.conf"),
+			Line:        6,
+			Listens:     []string{"127.0.0.1:8080"},
+			ServerNames: []string{"default_server"},
+		},
+	}},
+	serversFixture{"includes-regular", []ServerInfo{
+		ServerInfo{
+			File:        filepath.Join("testdata", "includes-regular", "conf.d", "server.conf"),
+			Line:        1,
+			Listens:     []string{"127.0.0.1:8080"},
+			ServerNames: []string{"default_server"},
+		},
+	}},
+	serversFixture{"stream-map", []ServerInfo{
+		ServerInfo{
+			File:    filepath.Join("testdata", "stream-map", "nginx.conf"),
+			Line:    31,
+			Listens: []string{"443"},
+		},
+	}},
+	serversFixture{"stream-ssl-preread", []ServerInfo{
+		ServerInfo{
+			File:    filepath.Join("testdata", "stream-ssl-preread", "nginx.conf"),
+			Line:    26,
+			Listens: []string{"443"},
+		},
+	}},
+}
+
+func TestServers(t *testing.T) {
+	for _, fixture := range serversFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			path := filepath.Join("testdata", fixture.name, "nginx.conf")
+			payload, err := Parse(path, &ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			servers := payload.Servers()
+			for i := range servers {
+				if servers[i].Directive == nil || servers[i].Directive.Directive != "server" {
+					t.Fatalf("expected server directive but got %v", servers[i].Directive)
+				}
+				servers[i].Directive = nil
+			}
+			if !reflect.DeepEqual(servers, fixture.expected) {
+				t.Fatalf("expected: %#v\nbut got: %#v", fixture.expected, servers)
+			}
+		})
+	}
+}
+
+func TestDuplicateListens(t *testing.T) {
+	path := filepath.Join("testdata", "duplicate-listens", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ListenConflict{
+		ListenConflict{
+			Context: "http",
+			Address: "*:80",
+			Default: true,
+			Listens: []ListenLocation{
+				ListenLocation{File: path, Line: 12},
+				ListenLocation{File: path, Line: 15},
+			},
+		},
+		ListenConflict{
+			Context:    "http",
+			Address:    "*:80",
+			ServerName: "www.example.com",
+			Listens: []ListenLocation{
+				ListenLocation{File: path, Line: 4},
+				ListenLocation{File: path, Line: 8},
+			},
+		},
+		ListenConflict{
+			Context: "http",
+			Address: "*:8080",
+			Listens: []ListenLocation{
+				ListenLocation{File: path, Line: 19},
+				ListenLocation{File: path, Line: 22},
+			},
+		},
+		ListenConflict{
+			Context:    "http",
+			Address:    "127.0.0.1:80",
+			ServerName: "example.com",
+			Listens: []ListenLocation{
+				ListenLocation{File: path, Line: 25},
+				ListenLocation{File: path, Line: 29},
+			},
+		},
+	}
+	if conflicts := payload.DuplicateListens(); !reflect.DeepEqual(conflicts, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, conflicts)
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected ListenSpec
+	}{
+		{[]string{"80"}, ListenSpec{Address: "*", Port: "80"}},
+		{[]string{"*:8080", "default_server"}, ListenSpec{Address: "*", Port: "8080", DefaultServer: true}},
+		{[]string{"127.0.0.1"}, ListenSpec{Address: "127.0.0.1", Port: "80"}},
+		{[]string{"localhost:443", "ssl", "http2"}, ListenSpec{Address: "localhost", Port: "443", SSL: true, HTTP2: true}},
+		{[]string{"[::]:443", "quic", "reuseport"}, ListenSpec{Address: "::", Port: "443", HTTP3: true, Reuseport: true}},
+		{[]string{"[::1]", "default"}, ListenSpec{Address: "::1", Port: "80", DefaultServer: true}},
+		{[]string{"unix:/var/run/nginx.sock", "proxy_protocol"}, ListenSpec{UnixSocket: "/var/run/nginx.sock", ProxyProtocol: true}},
+		{[]string{"8443", "ssl", "backlog=511", "so_keepalive=on", "ipv6only=on", "deferred"}, ListenSpec{Address: "*", Port: "8443", SSL: true, Backlog: 511}},
+	}
+	for _, test := range tests {
+		spec, err := ParseListen(Directive{Directive: "listen", Args: test.args})
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+		if !reflect.DeepEqual(spec, test.expected) {
+			t.Fatalf("%v: expected: %+v\nbut got: %+v", test.args, test.expected, spec)
+		}
+	}
+
+	invalid := []struct {
+		directive string
+		args      []string
+		err       string
+	}{
+		{"server_name", []string{"80"}, `invalid "server_name" directive, expected listen with an address`},
+		{"listen", []string{}, `invalid "listen" directive, expected listen with an address`},
+		{"listen", []string{"unix:"}, `no path in the unix domain socket "unix:" in "listen" directive`},
+		{"listen", []string{"127.0.0.1:http"}, `invalid port in "127.0.0.1:http" of the "listen" directive`},
+		{"listen", []string{"70000"}, `invalid port in "70000" of the "listen" directive`},
+		{"listen", []string{":80"}, `invalid address ":80" in "listen" directive`},
+		{"listen", []string{"80", "backlog=0"}, `invalid backlog "backlog=0" in "listen" directive`},
+		{"listen", []string{"80", "sll"}, `invalid parameter "sll" in "listen" directive`},
+	}
+	for _, test := range invalid {
+		_, err := ParseListen(Directive{Directive: test.directive, Args: test.args})
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%s %v: expected error %q but got %v", test.directive, test.args, test.err, err)
+		}
+	}
+}
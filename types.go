@@ -1,9 +1,17 @@
 package crossplane
 
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
 type Payload struct {
-	Status string         `json:"status"`
-	Errors []PayloadError `json:"errors"`
-	Config []Config       `json:"config"`
+	Status   string           `json:"status"`
+	Errors   []PayloadError   `json:"errors"`
+	Warnings []PayloadWarning `json:"warnings,omitempty"`
+	Config   []Config         `json:"config"`
 }
 
 type PayloadError struct {
@@ -13,11 +21,24 @@ type PayloadError struct {
 	Callback interface{} `json:"callback,omitempty"`
 }
 
+// PayloadWarning is a problem that was found while parsing, but that
+// doesn't make the parse fail.
+type PayloadWarning struct {
+	File    string `json:"file"`
+	Line    *int   `json:"line"`
+	Warning string `json:"warning"`
+}
+
 type Config struct {
-	File   string        `json:"file"`
-	Status string        `json:"status"`
-	Errors []ConfigError `json:"errors"`
-	Parsed []Directive   `json:"parsed"`
+	File     string          `json:"file"`
+	Status   string          `json:"status"`
+	Errors   []ConfigError   `json:"errors"`
+	Warnings []ConfigWarning `json:"warnings,omitempty"`
+	Parsed   []Directive     `json:"parsed"`
+
+	// The tokens that the config was parsed from, if the RetainTokens parse
+	// option was set.
+	Tokens []Token `json:"tokens,omitempty"`
 }
 
 type ConfigError struct {
@@ -25,6 +46,11 @@ type ConfigError struct {
 	Error string `json:"error"`
 }
 
+type ConfigWarning struct {
+	Line    *int   `json:"line"`
+	Warning string `json:"warning"`
+}
+
 type Directive struct {
 	Directive string       `json:"directive"`
 	Line      int          `json:"line"`
@@ -32,6 +58,14 @@ type Directive struct {
 	Includes  *[]int       `json:"includes,omitempty"`
 	Block     *[]Directive `json:"block,omitempty"`
 	Comment   *string      `json:"comment,omitempty"`
+	Raw       *string      `json:"raw,omitempty"`
+
+	// Where the directive starts and ends, if the RetainPositions parse
+	// option was set. The end is the directive's ";", the "}" that closes
+	// its block, or the last character of a comment.
+	Column    int `json:"column,omitempty"`
+	EndLine   int `json:"end_line,omitempty"`
+	EndColumn int `json:"end_column,omitempty"`
 }
 
 // IsBlock returns true if this is a block directive.
@@ -49,9 +83,335 @@ func (d Directive) IsComment() bool {
 	return d.Directive == "#" && d.Comment != nil
 }
 
+// Equal returns true if the two directives and everything in their blocks are
+// the same, ignoring line numbers and raw text.
+func (d Directive) Equal(other Directive) bool {
+	if d.Directive != other.Directive ||
+		len(d.Args) != len(other.Args) ||
+		(d.Includes == nil) != (other.Includes == nil) ||
+		(d.Includes != nil && len(*d.Includes) != len(*other.Includes)) ||
+		(d.Block == nil) != (other.Block == nil) ||
+		(d.Block != nil && !blocksEqual(*d.Block, *other.Block)) ||
+		(d.Comment == nil) != (other.Comment == nil) ||
+		(d.Comment != nil && *d.Comment != *other.Comment) {
+		return false
+	}
+	for i := range d.Args {
+		if d.Args[i] != other.Args[i] {
+			return false
+		}
+	}
+	if d.Includes != nil {
+		for i := range *d.Includes {
+			if (*d.Includes)[i] != (*other.Includes)[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Equal returns true if the two configs have the same file, status, errors,
+// and directives. Line numbers of directives are ignored.
+func (c Config) Equal(other Config) bool {
+	if c.File != other.File || c.Status != other.Status || len(c.Errors) != len(other.Errors) {
+		return false
+	}
+	for i := range c.Errors {
+		e1, e2 := c.Errors[i], other.Errors[i]
+		if e1.Error != e2.Error || lineLess(e1.Line, e2.Line) || lineLess(e2.Line, e1.Line) {
+			return false
+		}
+	}
+	return blocksEqual(c.Parsed, other.Parsed)
+}
+
+// AppendChild adds a directive to the end of this directive's block. If this
+// directive isn't a block yet, it becomes one.
+func (d *Directive) AppendChild(child Directive) {
+	if d.Block == nil {
+		d.Block = &[]Directive{}
+	}
+	*d.Block = append(*d.Block, child)
+}
+
+// InsertChildBefore inserts a directive into this directive's block so that
+// it ends up at the given index. Indexes that are out of range are clamped
+// to the start or end of the block. If this directive isn't a block yet, it
+// becomes one.
+func (d *Directive) InsertChildBefore(index int, child Directive) {
+	if d.Block == nil {
+		d.Block = &[]Directive{}
+	}
+	*d.Block = insertDirective(*d.Block, clampIndex(index, len(*d.Block)), child)
+}
+
+// RemoveChildren removes the directives in this directive's block for which
+// pred returns true, and returns the number of directives that were removed.
+func (d *Directive) RemoveChildren(pred func(Directive) bool) int {
+	if d.Block == nil {
+		return 0
+	}
+	block, n := removeDirectives(*d.Block, pred)
+	*d.Block = block
+	return n
+}
+
+// AppendDirective adds a directive to the end of the config.
+func (c *Config) AppendDirective(d Directive) {
+	c.Parsed = append(c.Parsed, d)
+}
+
+// InsertDirectiveBefore inserts a directive into the config so that it ends
+// up at the given index. Indexes that are out of range are clamped to the
+// start or end of the config.
+func (c *Config) InsertDirectiveBefore(index int, d Directive) {
+	c.Parsed = insertDirective(c.Parsed, clampIndex(index, len(c.Parsed)), d)
+}
+
+// RemoveDirectives removes the top-level directives in the config for which
+// pred returns true, and returns the number of directives that were removed.
+func (c *Config) RemoveDirectives(pred func(Directive) bool) int {
+	var n int
+	c.Parsed, n = removeDirectives(c.Parsed, pred)
+	return n
+}
+
+// Renumber sets the line numbers of the config's directives to the lines
+// that Build writes them on, which keeps line-based logic working after the
+// config has been edited. Comments that Build writes on the same line as the
+// directive before them stay attached to it, and the line of a comment that's
+// written after a block's closing brace is the block's line, since that's how
+// Build knows to write it there. Lines are counted as if the config were built
+// without a header.
+func (c *Config) Renumber() {
+	line := 0
+	renumberBlock(c.Parsed, &line, 0)
+}
+
+func renumberBlock(block []Directive, line *int, lastLine int) {
+	newLastLine := *line
+	for i := range block {
+		stmt := &block[i]
+
+		// Build writes comments from the same line as the last directive
+		// after it, so they share its new line too
+		if stmt.IsComment() && stmt.Line == lastLine {
+			stmt.Line = newLastLine
+			continue
+		}
+
+		*line++
+		oldLine := stmt.Line
+		stmt.Line = *line
+		*line += argNewlines(*stmt)
+		if stmt.Block != nil {
+			renumberBlock(*stmt.Block, line, oldLine)
+			*line++ // for the closing brace
+		}
+		lastLine, newLastLine = oldLine, stmt.Line
+	}
+}
+
+// argNewlines returns the number of newlines in a directive's args, which is
+// how many more lines than one Build writes the directive on. Args with
+// newlines are things like a quoted multi-line log_format or the code of a
+// Lua block that was parsed with RawLuaBlocks.
+func argNewlines(d Directive) int {
+	n := 0
+	for _, arg := range d.Args {
+		n += strings.Count(arg, "\n")
+	}
+	return n
+}
+
 // Combined returns a new Payload that is the same except that the inluding
 // logic is performed on its configs. This means that the resulting Payload
 // will always have 0 or 1 configs in its Config field.
 func (p Payload) Combined() (*Payload, error) {
 	return combineConfigs(p)
 }
+
+// CombineOptions changes how a Payload's configs are combined.
+type CombineOptions struct {
+	// If true, return a map from the line numbers of the combined config to
+	// the files and lines that its directives came from. The combined
+	// config is renumbered as if by Renumber, so that its line numbers are
+	// the lines that Build writes its directives on.
+	SourceMap bool
+}
+
+// SourceLocation is where a directive in a combined config came from.
+type SourceLocation struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// CombinedWithOptions is like Combined, but can also return a source map
+// for the combined config. The map is nil unless the SourceMap option is
+// set. When Build writes a comment on the same line as a directive, the line
+// maps to the directive, and so do the other lines of a directive whose args
+// have newlines in them.
+func (p Payload) CombinedWithOptions(options *CombineOptions) (*Payload, map[int]SourceLocation, error) {
+	if options == nil {
+		options = &CombineOptions{}
+	}
+	combined, err := combineConfigs(p)
+	if err != nil || !options.SourceMap || len(combined.Config) < 1 {
+		return combined, nil, err
+	}
+
+	// the directives of the combined config come in the same order as they
+	// do when walking the original configs and following their includes
+	sources := sourceLocations(p, p.Config[0].File, p.Config[0].Parsed, nil)
+	config := &combined.Config[0]
+	config.Renumber()
+
+	// every line that a directive with multi-line args is written on maps
+	// to where the directive starts
+	sourceMap := map[int]SourceLocation{}
+	i := 0
+	config.Walk(func(ctx []string, d *Directive) bool {
+		for line := d.Line; line <= d.Line+argNewlines(*d); line++ {
+			if _, ok := sourceMap[line]; !ok {
+				sourceMap[line] = sources[i]
+			}
+		}
+		i++
+		return true
+	})
+	return combined, sourceMap, nil
+}
+
+// CombineByPath is like Combined, except that the configs that each include
+// directive includes are found by matching its argument against the File of
+// each config, instead of using its Includes indexes. This makes it possible
+// to combine a payload that wasn't made by Parse. Relative paths are joined to
+// the directory of the first config, which is how Parse and nginx find them,
+// and patterns with wildcards include every config they match in order of
+// their file names. It's an error for an include without wildcards to not
+// match any of the configs.
+func CombineByPath(p Payload) (*Payload, error) {
+	if len(p.Config) < 1 {
+		return p.Combined()
+	}
+
+	indexes := map[string]int{}
+	configs := make([]Config, len(p.Config))
+	for i, config := range p.Config {
+		indexes[filepath.Clean(config.File)] = i
+		config.Parsed = copyBlock(config.Parsed)
+		configs[i] = config
+	}
+
+	dir := filepath.Dir(p.Config[0].File)
+	for i := range configs {
+		if err := includeByPath(configs[i].File, configs[i].Parsed, dir, indexes); err != nil {
+			return nil, err
+		}
+	}
+	p.Config = configs
+	return p.Combined()
+}
+
+// includeByPath sets the Includes of each include directive in the block to
+// the indexes of the configs whose files match its argument.
+func includeByPath(file string, block []Directive, dir string, indexes map[string]int) error {
+	for i := range block {
+		d := &block[i]
+		if d.Block != nil {
+			if err := includeByPath(file, *d.Block, dir, indexes); err != nil {
+				return err
+			}
+		}
+		if d.Directive != "include" || len(d.Args) != 1 {
+			continue
+		}
+
+		pattern := filepath.FromSlash(strings.Replace(d.Args[0], `\`, "/", -1))
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		var fnames []string
+		if hasMagic.MatchString(pattern) {
+			for fname := range indexes {
+				if matched, err := filepath.Match(pattern, fname); err != nil {
+					return err
+				} else if matched {
+					fnames = append(fnames, fname)
+				}
+			}
+			sort.Strings(fnames)
+		} else if _, ok := indexes[pattern]; ok {
+			fnames = []string{pattern}
+		} else {
+			return ParseError{
+				what: fmt.Sprintf(`no config for included file "%s"`, d.Args[0]),
+				file: &file,
+				line: &d.Line,
+			}
+		}
+
+		includes := []int{}
+		for _, fname := range fnames {
+			includes = append(includes, indexes[fname])
+		}
+		d.Includes = &includes
+	}
+	return nil
+}
+
+// InlineInclude replaces an include directive in one of the Payload's configs
+// with copies of the directives from the configs that it includes, leaving
+// the rest of the Payload as it is. The include directive must point into
+// the config at configIndex. Include directives inside of the inlined
+// directives aren't inlined themselves.
+func (p *Payload) InlineInclude(configIndex int, includeDirective *Directive) error {
+	if configIndex < 0 || configIndex >= len(p.Config) {
+		return fmt.Errorf("no config with index: %d", configIndex)
+	}
+	if !includeDirective.IsInclude() {
+		return fmt.Errorf("%q directive is not an include with parsed configs", includeDirective.Directive)
+	}
+
+	config := &p.Config[configIndex]
+	block, i, ok := findDirective(&config.Parsed, includeDirective)
+	if !ok {
+		return fmt.Errorf("include directive is not in config with index: %d", configIndex)
+	}
+
+	inlined := []Directive{}
+	for _, idx := range *includeDirective.Includes {
+		if idx < 0 || idx >= len(p.Config) {
+			return ParseError{
+				what: fmt.Sprintf("include config with index: %d", idx),
+				file: &config.File,
+				line: &includeDirective.Line,
+			}
+		}
+		inlined = append(inlined, copyBlock(p.Config[idx].Parsed)...)
+	}
+
+	rest := append(inlined, (*block)[i+1:]...)
+	*block = append((*block)[:i], rest...)
+	return nil
+}
+
+// SortErrors sorts the Payload's errors by file and then by line, and sorts
+// the errors of each of its configs by line. Errors without a line number
+// come before errors that have one.
+func (p *Payload) SortErrors() {
+	sort.SliceStable(p.Errors, func(i, j int) bool {
+		if p.Errors[i].File != p.Errors[j].File {
+			return p.Errors[i].File < p.Errors[j].File
+		}
+		return lineLess(p.Errors[i].Line, p.Errors[j].Line)
+	})
+	for _, config := range p.Config {
+		errs := config.Errors
+		sort.SliceStable(errs, func(i, j int) bool {
+			return lineLess(errs[i].Line, errs[j].Line)
+		})
+	}
+}
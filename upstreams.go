@@ -0,0 +1,189 @@
+package crossplane
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// UndefinedUpstream is a reference to an upstream that isn't defined
+// anywhere in the payload.
+type UndefinedUpstream struct {
+	File      string
+	Line      int
+	Directive string
+	Upstream  string
+}
+
+// directives that pass requests to an address or to an upstream group
+var upstreamPassDirectives = []string{
+	"fastcgi_pass", "grpc_pass", "memcached_pass", "proxy_pass", "scgi_pass", "uwsgi_pass",
+}
+
+// UndefinedUpstreams finds the proxy_pass, fastcgi_pass, grpc_pass,
+// memcached_pass, scgi_pass, and uwsgi_pass directives that refer to an
+// upstream that isn't defined by any upstream block in the payload. Targets
+// that contain variables, ports, or IP addresses are ignored, and so are
+// hostnames with dots in them and "localhost", since nginx resolves those
+// instead of looking for an upstream. Upstreams in http and stream blocks
+// are treated as one set of names, because included files don't know which
+// of the two they're in.
+func (p Payload) UndefinedUpstreams() []UndefinedUpstream {
+	defined := map[string]bool{}
+	for _, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if d.Directive == "upstream" && d.Block != nil && len(d.Args) > 0 {
+				defined[d.Args[0]] = true
+			}
+			return true
+		})
+	}
+
+	var undefined []UndefinedUpstream
+	for _, config := range p.Config {
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if !contains(upstreamPassDirectives, d.Directive) || len(d.Args) == 0 {
+				return true
+			}
+			if name, ok := upstreamName(d.Args[0]); ok && !defined[name] {
+				undefined = append(undefined, UndefinedUpstream{
+					File:      config.File,
+					Line:      d.Line,
+					Directive: d.Directive,
+					Upstream:  name,
+				})
+			}
+			return true
+		})
+	}
+	return undefined
+}
+
+// upstreamName returns the name of the upstream that a pass directive's
+// target refers to, or false if the target is an address that nginx would
+// use or resolve itself, like "http://127.0.0.1:8080" or "unix:/tmp/sock".
+func upstreamName(target string) (string, bool) {
+	if strings.Contains(target, "$") || strings.HasPrefix(target, "unix:") {
+		return "", false
+	}
+	if i := strings.Index(target, "://"); i != -1 {
+		target = target[i+3:]
+	}
+	if i := strings.IndexAny(target, "/?"); i != -1 {
+		target = target[:i]
+	}
+	if target == "" || target == "localhost" || strings.ContainsAny(target, ".:[") || net.ParseIP(target) != nil {
+		return "", false
+	}
+	return target, true
+}
+
+// ProxyPassSpec is the parts of a proxy_pass directive's target.
+type ProxyPassSpec struct {
+	// "http" or "https", or empty in stream, where proxy_pass doesn't take
+	// a scheme. A scheme that's set by a variable is kept as it is.
+	Scheme string
+
+	// The host, IP address, or upstream name, without the port. IPv6
+	// addresses don't have brackets. It's empty for unix sockets and if
+	// the host is set by a variable.
+	Host string
+
+	// The port, which is empty if it isn't given.
+	Port string
+
+	// The path of the socket for targets like "unix:/tmp/backend.sock" or
+	// "http://unix:/tmp/backend.sock:/uri".
+	UnixSocket string
+
+	// True if the target has a URI after the host, even if it's just "/".
+	// With a URI, nginx replaces the part of the request URI that matched
+	// the location with it. Without one, the request URI is passed as it
+	// is.
+	HasURI bool
+	URI    string
+
+	// True if the target uses variables, in which case nginx works out
+	// where to send each request when it's handled and passes the URI
+	// as it's given instead of replacing part of the request URI.
+	HasVariables bool
+}
+
+// ParseProxyPass reads the target of a proxy_pass directive in the given
+// context, like []string{"http", "server", "location"}, which decides
+// whether it's an http or stream proxy_pass. It returns an error if the
+// directive isn't proxy_pass or if nginx wouldn't accept its target, like
+// when an http target has no scheme, a stream target has one, or a target
+// has a URI inside of an "if" or "limit_except" block. Since the context
+// doesn't say how a location was given, a URI in a regex or named location
+// isn't caught.
+func ParseProxyPass(d Directive, ctx []string) (ProxyPassSpec, error) {
+	var spec ProxyPassSpec
+	if d.Directive != "proxy_pass" || len(d.Args) != 1 {
+		return spec, fmt.Errorf(`invalid "%s" directive, expected proxy_pass with a URL`, d.Directive)
+	}
+	target := d.Args[0]
+	spec.HasVariables = strings.Contains(target, "$")
+	stream := len(ctx) > 0 && ctx[0] == "stream"
+
+	rest := target
+	if i := strings.Index(rest, "://"); i >= 0 {
+		if stream {
+			return spec, fmt.Errorf(`URL with a scheme "%s" is not allowed in stream "proxy_pass" directive`, target)
+		}
+		spec.Scheme, rest = rest[:i], rest[i+3:]
+		if !strings.Contains(spec.Scheme, "$") {
+			spec.Scheme = strings.ToLower(spec.Scheme)
+		}
+	}
+	if !stream && spec.Scheme != "http" && spec.Scheme != "https" && !spec.HasVariables {
+		return spec, fmt.Errorf(`invalid URL prefix in "%s" of the "proxy_pass" directive`, target)
+	}
+
+	var host string
+	if strings.HasPrefix(rest, "unix:") {
+		// in http, a ":" ends the socket's path and starts the URI
+		spec.UnixSocket = strings.TrimPrefix(rest, "unix:")
+		if i := strings.Index(spec.UnixSocket, ":"); i >= 0 && !stream {
+			spec.UnixSocket, rest = spec.UnixSocket[:i], spec.UnixSocket[i+1:]
+		} else {
+			rest = ""
+		}
+		if spec.UnixSocket == "" {
+			return spec, fmt.Errorf(`no path in the unix domain socket "%s" in "proxy_pass" directive`, target)
+		}
+	} else {
+		host = rest
+		rest = ""
+		if i := strings.Index(host, "/"); i >= 0 && !stream {
+			host, rest = host[:i], host[i:]
+		}
+	}
+
+	if rest != "" {
+		if len(ctx) > 0 && (ctx[len(ctx)-1] == "if" || ctx[len(ctx)-1] == "limit_except") {
+			return spec, fmt.Errorf(`"proxy_pass" cannot have URI part inside "%s" block`, ctx[len(ctx)-1])
+		}
+		spec.HasURI, spec.URI = true, rest
+	}
+
+	if spec.UnixSocket != "" || strings.Contains(host, "$") {
+		return spec, nil
+	}
+	if strings.Count(host, ":") == 1 || (strings.HasPrefix(host, "[") && !strings.HasSuffix(host, "]")) {
+		h, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return spec, fmt.Errorf(`invalid address "%s" in "proxy_pass" directive`, target)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return spec, fmt.Errorf(`invalid port in "%s" of the "proxy_pass" directive`, target)
+		}
+		host, spec.Port = h, port
+	}
+	spec.Host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if spec.Host == "" {
+		return spec, fmt.Errorf(`no host in "%s" of the "proxy_pass" directive`, target)
+	}
+	return spec, nil
+}
@@ -0,0 +1,82 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUndefinedUpstreams(t *testing.T) {
+	path := filepath.Join("testdata", "undefined-upstreams", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []UndefinedUpstream{
+		UndefinedUpstream{File: path, Line: 11, Directive: "proxy_pass", Upstream: "missing"},
+		UndefinedUpstream{File: path, Line: 23, Directive: "fastcgi_pass", Upstream: "php"},
+		UndefinedUpstream{File: path, Line: 46, Directive: "proxy_pass", Upstream: "tcp_backend"},
+	}
+	if undefined := payload.UndefinedUpstreams(); !reflect.DeepEqual(undefined, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, undefined)
+	}
+}
+
+func TestParseProxyPass(t *testing.T) {
+	http := []string{"http", "server", "location"}
+	stream := []string{"stream", "server"}
+	tests := []struct {
+		target   string
+		ctx      []string
+		expected ProxyPassSpec
+	}{
+		{"http://backend", http, ProxyPassSpec{Scheme: "http", Host: "backend"}},
+		{"http://backend/", http, ProxyPassSpec{Scheme: "http", Host: "backend", HasURI: true, URI: "/"}},
+		{"HTTPS://127.0.0.1:8443/prefix", http, ProxyPassSpec{Scheme: "https", Host: "127.0.0.1", Port: "8443", HasURI: true, URI: "/prefix"}},
+		{"http://[::1]:8080", http, ProxyPassSpec{Scheme: "http", Host: "::1", Port: "8080"}},
+		{"http://[::1]/", http, ProxyPassSpec{Scheme: "http", Host: "::1", HasURI: true, URI: "/"}},
+		{"http://unix:/tmp/backend.sock", http, ProxyPassSpec{Scheme: "http", UnixSocket: "/tmp/backend.sock"}},
+		{"http://unix:/tmp/backend.sock:/uri/", http, ProxyPassSpec{Scheme: "http", UnixSocket: "/tmp/backend.sock", HasURI: true, URI: "/uri/"}},
+		{"http://$upstream", http, ProxyPassSpec{Scheme: "http", HasVariables: true}},
+		{"http://backend$request_uri", http, ProxyPassSpec{Scheme: "http", HasVariables: true}},
+		{"$scheme://backend/api", http, ProxyPassSpec{Scheme: "$scheme", Host: "backend", HasURI: true, URI: "/api", HasVariables: true}},
+		{"$target", http, ProxyPassSpec{HasVariables: true}},
+		{"http://backend", []string{"http", "location", "if"}, ProxyPassSpec{Scheme: "http", Host: "backend"}},
+		{"backend", stream, ProxyPassSpec{Host: "backend"}},
+		{"10.0.0.1:12345", stream, ProxyPassSpec{Host: "10.0.0.1", Port: "12345"}},
+		{"unix:/tmp/stream.sock", stream, ProxyPassSpec{UnixSocket: "/tmp/stream.sock"}},
+	}
+	for _, test := range tests {
+		spec, err := ParseProxyPass(Directive{Directive: "proxy_pass", Args: []string{test.target}}, test.ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", test.target, err)
+		}
+		if !reflect.DeepEqual(spec, test.expected) {
+			t.Fatalf("%s: expected: %+v\nbut got: %+v", test.target, test.expected, spec)
+		}
+	}
+
+	invalid := []struct {
+		directive string
+		args      []string
+		ctx       []string
+		err       string
+	}{
+		{"fastcgi_pass", []string{"backend"}, http, `invalid "fastcgi_pass" directive, expected proxy_pass with a URL`},
+		{"proxy_pass", []string{}, http, `invalid "proxy_pass" directive, expected proxy_pass with a URL`},
+		{"proxy_pass", []string{"backend"}, http, `invalid URL prefix in "backend" of the "proxy_pass" directive`},
+		{"proxy_pass", []string{"ftp://backend"}, http, `invalid URL prefix in "ftp://backend" of the "proxy_pass" directive`},
+		{"proxy_pass", []string{"http://backend:http"}, http, `invalid port in "http://backend:http" of the "proxy_pass" directive`},
+		{"proxy_pass", []string{"http:///uri"}, http, `no host in "http:///uri" of the "proxy_pass" directive`},
+		{"proxy_pass", []string{"http://unix:"}, http, `no path in the unix domain socket "http://unix:" in "proxy_pass" directive`},
+		{"proxy_pass", []string{"http://backend/"}, []string{"http", "location", "if"}, `"proxy_pass" cannot have URI part inside "if" block`},
+		{"proxy_pass", []string{"http://backend/"}, []string{"http", "location", "limit_except"}, `"proxy_pass" cannot have URI part inside "limit_except" block`},
+		{"proxy_pass", []string{"http://backend"}, stream, `URL with a scheme "http://backend" is not allowed in stream "proxy_pass" directive`},
+	}
+	for _, test := range invalid {
+		_, err := ParseProxyPass(Directive{Directive: test.directive, Args: test.args}, test.ctx)
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%s %v: expected error %q but got %v", test.directive, test.args, test.err, err)
+		}
+	}
+}
@@ -20,10 +20,23 @@ func contains(xs []string, x string) bool {
 	return false
 }
 
+// isSpace returns true if every rune in s is whitespace, which is always the
+// case for the empty string. It's called for every char that's lexed, so it
+// checks single bytes without decoding them first.
 func isSpace(s string) bool {
-	return len(strings.TrimSpace(s)) == 0
+	if len(s) == 1 {
+		return asciiSpace[s[0]]
+	}
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
 }
 
+var asciiSpace = [256]bool{'\t': true, '\n': true, '\v': true, '\f': true, '\r': true, ' ': true}
+
 func repr(s string) string {
 	q := fmt.Sprintf("%q", s)
 	for _, char := range s {
@@ -37,11 +50,144 @@ func repr(s string) string {
 	return q
 }
 
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// lineLess orders optional line numbers, putting missing lines first.
+func lineLess(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	return *a < *b
+}
+
 func validFlag(s string) bool {
 	l := strings.ToLower(s)
 	return l == "on" || l == "off"
 }
 
+// copyDirective returns a deep copy of a directive.
+func copyDirective(d Directive) Directive {
+	d.Args = append([]string{}, d.Args...)
+	if d.Includes != nil {
+		includes := append([]int{}, *d.Includes...)
+		d.Includes = &includes
+	}
+	if d.Block != nil {
+		block := copyBlock(*d.Block)
+		d.Block = &block
+	}
+	if d.Comment != nil {
+		comment := *d.Comment
+		d.Comment = &comment
+	}
+	if d.Raw != nil {
+		raw := *d.Raw
+		d.Raw = &raw
+	}
+	return d
+}
+
+// copyBlock returns a deep copy of a block of directives.
+func copyBlock(block []Directive) []Directive {
+	copied := make([]Directive, 0, len(block))
+	for _, d := range block {
+		copied = append(copied, copyDirective(d))
+	}
+	return copied
+}
+
+// findDirective searches the block and the blocks inside of it for the
+// directive that target points to, and returns the block that holds it along
+// with its index in that block.
+func findDirective(block *[]Directive, target *Directive) (*[]Directive, int, bool) {
+	for i := range *block {
+		d := &(*block)[i]
+		if d == target {
+			return block, i, true
+		}
+		if d.Block != nil {
+			if inner, j, ok := findDirective(d.Block, target); ok {
+				return inner, j, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// blocksEqual returns true if the two blocks hold equal directives.
+func blocksEqual(b1, b2 []Directive) bool {
+	if len(b1) != len(b2) {
+		return false
+	}
+	for i := range b1 {
+		if !b1[i].Equal(b2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// insertDirective inserts a directive into a block at the given index.
+func insertDirective(block []Directive, i int, stmt Directive) []Directive {
+	block = append(block, Directive{})
+	copy(block[i+1:], block[i:])
+	block[i] = stmt
+	return block
+}
+
+// removeDirectives removes the directives in a block that match pred and
+// returns the resulting block and the number of directives that were removed.
+func removeDirectives(block []Directive, pred func(Directive) bool) ([]Directive, int) {
+	kept := block[:0]
+	for _, d := range block {
+		if !pred(d) {
+			kept = append(kept, d)
+		}
+	}
+	return kept, len(block) - len(kept)
+}
+
+// clampIndex restricts an index to the range [0, n].
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
 // prepareIfArgs removes parentheses from an `if` directive's arguments.
 func prepareIfArgs(d Directive) Directive {
 	e := len(d.Args) - 1
@@ -84,6 +230,7 @@ func combineConfigs(old Payload) (*Payload, error) {
 
 	for _, config := range old.Config {
 		combined.Errors = append(combined.Errors, config.Errors...)
+		combined.Warnings = append(combined.Warnings, config.Warnings...)
 		if config.Status == "failed" {
 			combined.Status = "failed"
 		}
@@ -97,12 +244,32 @@ func combineConfigs(old Payload) (*Payload, error) {
 	}
 
 	return &Payload{
-		Status: status,
-		Errors: errors,
-		Config: []Config{combined},
+		Status:   status,
+		Errors:   errors,
+		Warnings: old.Warnings,
+		Config:   []Config{combined},
 	}, nil
 }
 
+// sourceLocations returns where each directive that combineConfigs makes
+// from a block came from, in the order that Walk visits them. The includes
+// must have already been checked by combineConfigs.
+func sourceLocations(old Payload, file string, block []Directive, sources []SourceLocation) []SourceLocation {
+	for _, dir := range block {
+		if dir.IsInclude() {
+			for _, idx := range *dir.Includes {
+				sources = sourceLocations(old, old.Config[idx].File, old.Config[idx].Parsed, sources)
+			}
+			continue
+		}
+		sources = append(sources, SourceLocation{File: file, Line: dir.Line})
+		if dir.IsBlock() {
+			sources = sourceLocations(old, file, *dir.Block, sources)
+		}
+	}
+	return sources
+}
+
 func performIncludes(old Payload, fromfile string, block []Directive) chan included {
 	c := make(chan included)
 	go func() {
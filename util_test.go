@@ -1,7 +1,12 @@
 package crossplane
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -74,4 +79,321 @@ func TestPayload(t *testing.T) {
 			t.Fatalf("expected: %s\nbut got: %s", b1, b2)
 		}
 	})
+	t.Run("combine-by-path", func(t *testing.T) {
+		payload, err := Parse(filepath.Join("testdata", "includes-globbed", "nginx.conf"), &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := payload.Combined()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// forget which configs were included, like in a hand-built payload
+		for _, config := range payload.Config {
+			config.Walk(func(ctx []string, d *Directive) bool {
+				d.Includes = nil
+				return true
+			})
+		}
+		combined, err := CombineByPath(*payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b1, _ := json.Marshal(*expected)
+		b2, _ := json.Marshal(*combined)
+		if string(b1) != string(b2) {
+			t.Fatalf("expected: %s\nbut got: %s", b1, b2)
+		}
+		if payload.Config[0].Parsed[1].Includes != nil {
+			t.Fatal("expected the payload to be unchanged")
+		}
+
+		// includes written with backslashes are relative to the main config
+		hand := Payload{Config: []Config{
+			Config{File: filepath.Join("conf", "nginx.conf"), Parsed: []Directive{
+				Directive{Directive: "include", Args: []string{`sites\a.conf`}, Line: 1},
+			}},
+			Config{File: filepath.Join("conf", "sites", "a.conf"), Parsed: []Directive{
+				Directive{Directive: "user", Args: []string{"nginx"}, Line: 1},
+			}},
+		}}
+		combined, err = CombineByPath(hand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed := combined.Config[0].Parsed; len(parsed) != 1 || parsed[0].Directive != "user" {
+			t.Fatalf("expected the included directive but got %v", parsed)
+		}
+
+		hand.Config = hand.Config[:1]
+		_, err = CombineByPath(hand)
+		expectedErr := fmt.Sprintf(`no config for included file "sites\a.conf" in %s:1`, filepath.Join("conf", "nginx.conf"))
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected error %q but got %v", expectedErr, err)
+		}
+	})
+	t.Run("combine-source-map", func(t *testing.T) {
+		payload, err := Parse(filepath.Join("testdata", "includes-globbed", "nginx.conf"), &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		combined, sourceMap, err := payload.CombinedWithOptions(&CombineOptions{SourceMap: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join("testdata", "includes-globbed")
+		main := filepath.Join(dir, "nginx.conf")
+		http := filepath.Join(dir, "http.conf")
+		server1 := filepath.Join(dir, "servers", "server1.conf")
+		server2 := filepath.Join(dir, "servers", "server2.conf")
+		location1 := filepath.Join(dir, "locations", "location1.conf")
+		location2 := filepath.Join(dir, "locations", "location2.conf")
+		expected := map[int]SourceLocation{
+			1:  SourceLocation{File: main, Line: 1},
+			3:  SourceLocation{File: http, Line: 1},
+			4:  SourceLocation{File: server1, Line: 1},
+			5:  SourceLocation{File: server1, Line: 2},
+			6:  SourceLocation{File: location1, Line: 1},
+			7:  SourceLocation{File: location1, Line: 2},
+			9:  SourceLocation{File: location2, Line: 1},
+			10: SourceLocation{File: location2, Line: 2},
+			13: SourceLocation{File: server2, Line: 1},
+			14: SourceLocation{File: server2, Line: 2},
+			15: SourceLocation{File: location1, Line: 1},
+			16: SourceLocation{File: location1, Line: 2},
+			18: SourceLocation{File: location2, Line: 1},
+			19: SourceLocation{File: location2, Line: 2},
+		}
+		if !reflect.DeepEqual(sourceMap, expected) {
+			t.Fatalf("expected: %v\nbut got: %v", expected, sourceMap)
+		}
+
+		// the keys are the lines that the combined config is built on
+		var b strings.Builder
+		if err := Build(&b, combined.Config[0], &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(b.String(), "\n"); lines[12] != "    server {" || lines[13] != "        listen 8081;" {
+			t.Fatalf("expected line 14 to be listen 8081 but got:\n%s", b.String())
+		}
+
+		if _, sourceMap, _ := payload.CombinedWithOptions(nil); sourceMap != nil {
+			t.Fatal("expected no source map without the SourceMap option")
+		}
+	})
+	t.Run("combine-source-map-multi-line-args", func(t *testing.T) {
+		dir := filepath.Join("testdata", "includes-multi-line-args")
+		main := filepath.Join(dir, "nginx.conf")
+		payload, err := Parse(main, &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sourceMap, err := payload.CombinedWithOptions(&CombineOptions{SourceMap: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// both lines of the log_format map to where it starts
+		log := filepath.Join(dir, "log.conf")
+		expected := map[int]SourceLocation{
+			1: SourceLocation{File: main, Line: 1},
+			3: SourceLocation{File: main, Line: 2},
+			4: SourceLocation{File: log, Line: 1},
+			5: SourceLocation{File: log, Line: 1},
+			6: SourceLocation{File: log, Line: 3},
+			7: SourceLocation{File: main, Line: 4},
+		}
+		if !reflect.DeepEqual(sourceMap, expected) {
+			t.Fatalf("expected: %v\nbut got: %v", expected, sourceMap)
+		}
+	})
+
+	t.Run("inline-include", func(t *testing.T) {
+		payload, err := Parse(filepath.Join("testdata", "includes-regular", "nginx.conf"), &ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		include := &(*payload.Config[0].Parsed[1].Block)[0]
+		if err := payload.InlineInclude(0, include); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := Build(&buf, payload.Config[0], &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.Join([]string{
+			"events {",
+			"}",
+			"http {",
+			"    server {",
+			"        listen 127.0.0.1:8080;",
+			"        server_name default_server;",
+			"        include foo.conf;",
+			"        include bar.conf;",
+			"    }",
+			"}",
+		}, "\n")
+		if buf.String() != expected {
+			t.Fatalf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+		}
+		if len(payload.Config) != 3 || len(payload.Config[1].Parsed) != 1 {
+			t.Fatalf("expected the other configs to be unchanged but got %v", payload.Config)
+		}
+
+		// the inlined directives are copies, so they can be changed freely
+		(*payload.Config[0].Parsed[1].Block)[0].Args = append((*payload.Config[0].Parsed[1].Block)[0].Args, "x")
+		if len(payload.Config[1].Parsed[0].Args) != 0 {
+			t.Fatalf("expected the included config to be unchanged but got %v", payload.Config[1].Parsed[0])
+		}
+
+		if err := payload.InlineInclude(0, include); err == nil {
+			t.Fatal("expected an error for an include that's no longer in the config")
+		}
+		if err := payload.InlineInclude(5, include); err == nil {
+			t.Fatal("expected an error for a config index that's out of range")
+		}
+	})
+	t.Run("sort-errors", func(t *testing.T) {
+		payload := Payload{
+			Errors: []PayloadError{
+				PayloadError{File: "b.conf", Line: pInt(2), Error: "b2"},
+				PayloadError{File: "a.conf", Line: pInt(7), Error: "a7"},
+				PayloadError{File: "b.conf", Line: pInt(1), Error: "b1"},
+				PayloadError{File: "a.conf", Error: "a"},
+			},
+			Config: []Config{
+				Config{
+					File: "b.conf",
+					Errors: []ConfigError{
+						ConfigError{Line: pInt(2), Error: "b2"},
+						ConfigError{Line: pInt(1), Error: "b1"},
+					},
+				},
+			},
+		}
+		payload.SortErrors()
+		var got []string
+		for _, e := range payload.Errors {
+			got = append(got, e.Error)
+		}
+		for _, e := range payload.Config[0].Errors {
+			got = append(got, e.Error)
+		}
+		expected := "a a7 b1 b2 b1 b2"
+		if strings.Join(got, " ") != expected {
+			t.Fatalf("expected: %q\nbut got: %q", expected, strings.Join(got, " "))
+		}
+	})
+	t.Run("edit-block", func(t *testing.T) {
+		server := Directive{Directive: "server", Args: []string{}}
+		server.AppendChild(Directive{Directive: "listen", Args: []string{"80"}})
+		server.AppendChild(Directive{Directive: "root", Args: []string{"/srv"}})
+		server.InsertChildBefore(1, Directive{Directive: "server_name", Args: []string{"example.com"}})
+		server.InsertChildBefore(-1, Directive{Directive: "#", Args: []string{}, Comment: pStr(" first")})
+		server.InsertChildBefore(10, Directive{Directive: "index", Args: []string{"index.html"}})
+
+		var names []string
+		for _, d := range *server.Block {
+			names = append(names, d.Directive)
+		}
+		if got := strings.Join(names, " "); got != "# listen server_name root index" {
+			t.Fatalf("unexpected block: %q", got)
+		}
+
+		n := server.RemoveChildren(func(d Directive) bool { return d.IsComment() || d.Directive == "root" })
+		if n != 2 || len(*server.Block) != 3 {
+			t.Fatalf("expected 2 removed and 3 left but got %d removed and %d left", n, len(*server.Block))
+		}
+
+		config := Config{}
+		config.AppendDirective(Directive{Directive: "http", Args: []string{}, Block: &[]Directive{}})
+		config.InsertDirectiveBefore(0, Directive{Directive: "user", Args: []string{"nginx"}})
+		if len(config.Parsed) != 2 || config.Parsed[0].Directive != "user" {
+			t.Fatalf("unexpected config: %v", config.Parsed)
+		}
+		if n := config.RemoveDirectives(func(d Directive) bool { return d.IsBlock() }); n != 1 {
+			t.Fatalf("expected 1 removed but got %d", n)
+		}
+	})
+
+	t.Run("renumber", func(t *testing.T) {
+		input := "events { # events\n    worker_connections 1024;\n}\nhttp {\n\n    server {\n        listen 80; # listen\n        # comment\n        location / {\n            return 200;\n        }\n    }\n}\n"
+		parsed, errs := ParseSnippet(input, nil, &ParseOptions{ParseComments: true})
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		server := &(*parsed[1].Block)[0]
+		server.InsertChildBefore(1, Directive{Directive: "server_name", Args: []string{"example.com"}})
+		server.AppendChild(Directive{Directive: "root", Args: []string{"/srv"}})
+		config := Config{Parsed: parsed}
+
+		var before bytes.Buffer
+		if err := Build(&before, config, &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		config.Renumber()
+		var after bytes.Buffer
+		if err := Build(&after, config, &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if before.String() != after.String() {
+			t.Fatalf("expected renumbering to not change the built config:\n%s\nbut got:\n%s", before.String(), after.String())
+		}
+
+		// the new line numbers should match the lines in the built config
+		reparsed, errs := ParseSnippet(after.String(), nil, &ParseOptions{ParseComments: true})
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		lines := func(block []Directive) []int {
+			var lines []int
+			walkBlock(block, []string{}, func(ctx []string, d *Directive) bool {
+				lines = append(lines, d.Line)
+				return true
+			})
+			return lines
+		}
+		if got, expected := lines(config.Parsed), lines(reparsed); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected lines %v but got %v", expected, got)
+		}
+	})
+
+	t.Run("renumber-multi-line-args", func(t *testing.T) {
+		// args with newlines, like a log_format or Lua code, take up more
+		// than one line when they're built
+		input := "http { log_format main '$a\n        $b'; init_by_lua_block { x = 1\n y = 2 } access_log off; } events {}"
+		options := &ParseOptions{RawLuaBlocks: true}
+		parsed, errs := ParseSnippet(input, nil, options)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		config := Config{Parsed: parsed}
+		config.Renumber()
+
+		var built bytes.Buffer
+		if err := Build(&built, config, &BuildOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		reparsed, errs := ParseSnippet(built.String(), nil, options)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		if !reflect.DeepEqual(reparsed, config.Parsed) {
+			t.Fatalf("expected the new line numbers to match the built config:\n%s\nbut got: %v", built.String(), config.Parsed)
+		}
+		if http := *config.Parsed[0].Block; http[2].Line != 6 || config.Parsed[1].Line != 8 {
+			t.Fatalf("expected access_log on line 6 and events on line 8 but got %v", config.Parsed)
+		}
+	})
+}
+
+func TestIsSpace(t *testing.T) {
+	for _, s := range []string{"", " ", "\t", "\n", "\r", "\u0085", "\u00a0", "\u2003", "a", "\\ ", "\\\n", "\x85", "{", "é"} {
+		if expected := strings.TrimSpace(s) == ""; isSpace(s) != expected {
+			t.Fatalf("expected isSpace(%q) to be %v", s, expected)
+		}
+	}
 }
@@ -0,0 +1,464 @@
+package crossplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// argValidator checks the format of a directive's arguments in the context of
+// the block it's in after analyze has checked how many there are, and returns a
+// description of each problem. The parent is the block directive that the
+// directive is in, or nil if it's at the top level of its file.
+type argValidator func(stmt Directive, ctx blockCtx, parent *Directive) []string
+
+// This dict maps directives to functions that validate the format of their
+// arguments. Problems are reported as warnings when the ValidateArgumentFormats
+// parse option is set.
+var argValidators = map[string]argValidator{
+	"dav_ext_methods":     validateDavExtMethods,
+	"dav_methods":         validateDavMethods,
+	"error_page":          validateErrorPage,
+	"limit_conn":          validateLimitConn,
+	"limit_req":           validateLimitReq,
+	"proxy_pass":          validateStreamProxyPass,
+	"real_ip_header":      validateRealIPHeader,
+	"server":              validateUpstreamServer,
+	"set_real_ip_from":    validateRealIPFrom,
+	"worker_cpu_affinity": validateCPUAffinity,
+}
+
+// validateArgs returns the problems with the format of the directive's
+// arguments, or nil if it has none or there's no validator for it.
+func validateArgs(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if masks, _ := lookupDirective(stmt.Directive, ctx); argsUnchecked(masks, ctx) {
+		return nil
+	}
+	if validate, ok := argValidators[stmt.Directive]; ok {
+		return validate(stmt, ctx, parent)
+	}
+	return nil
+}
+
+// Validate checks a directive the way Parse does when it reads one in the
+// given context, like []string{"http", "server", "location"}, without
+// parsing a config. The directive is treated as a block directive if its
+// Block isn't nil. Only the directive itself is checked, not the directives
+// in its block. The options that change how directives are analyzed, like
+// ErrorOnUnknownDirectives and SkipDirectiveContextCheck, are respected,
+// but the problems that ValidateArgumentFormats finds are warnings when
+// parsing, so they aren't returned. If options is nil, the default options
+// are used. The returned error has the directive's line if it has one.
+func (d Directive) Validate(ctx []string, options *ParseOptions) error {
+	if options == nil {
+		options = &ParseOptions{}
+	}
+	if d.IsComment() {
+		return nil
+	}
+
+	blockContext := blockCtx{}
+	for _, name := range ctx {
+		blockContext = enterBlockCtx(Directive{Directive: name}, blockContext)
+	}
+	term := ";"
+	if d.Block != nil {
+		term = "{"
+	}
+
+	err := analyze("", d, term, blockContext, options)
+	if perr, ok := err.(ParseError); ok {
+		err = ParseError{what: perr.what}
+		if d.Line > 0 {
+			err = ParseError{what: perr.what, line: &d.Line}
+		}
+	}
+	return err
+}
+
+// set_real_ip_from takes an address, a CIDR, "unix:", or a hostname
+func validateRealIPFrom(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	// the number of args is only checked in contexts that analyze knows
+	if len(stmt.Args) != 1 {
+		return nil
+	}
+	addr := stmt.Args[0]
+	if addr == "unix:" {
+		return nil
+	}
+
+	if strings.Contains(addr, "/") {
+		ip, ipnet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return []string{fmt.Sprintf(`invalid CIDR "%s" in "%s" directive`, addr, stmt.Directive)}
+		}
+		if !ip.Equal(ipnet.IP) {
+			return []string{fmt.Sprintf(`low address bits of %s are meaningless in "%s" directive`, addr, stmt.Directive)}
+		}
+		return nil
+	}
+
+	// anything that isn't made up of only digits and dots (or hex digits and
+	// colons) is a hostname that nginx resolves when it loads the config
+	if strings.Trim(addr, "0123456789.") == "" || strings.Contains(addr, ":") {
+		if net.ParseIP(addr) == nil {
+			return []string{fmt.Sprintf(`invalid address "%s" in "%s" directive`, addr, stmt.Directive)}
+		}
+	}
+	return nil
+}
+
+// real_ip_header takes "X-Real-IP", "X-Forwarded-For", "proxy_protocol", or
+// the name of any other request header, like "CF-Connecting-IP"
+func validateRealIPHeader(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(stmt.Args) != 1 {
+		return nil
+	}
+	header := stmt.Args[0]
+	if header == "" || strings.IndexFunc(header, func(r rune) bool { return !isHeaderChar(r) }) != -1 {
+		return []string{fmt.Sprintf(`invalid header name "%s" in "%s" directive`, header, stmt.Directive)}
+	}
+	return nil
+}
+
+// isHeaderChar returns true for the chars allowed in HTTP header names,
+// which are the "tchar" chars from RFC 7230
+func isHeaderChar(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// dav_methods takes "off" or any of the methods that the dav module handles
+func validateDavMethods(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	return validateMethods(stmt, []string{"PUT", "DELETE", "MKCOL", "COPY", "MOVE"})
+}
+
+// dav_ext_methods takes "off" or any of the methods that the dav_ext module
+// handles
+func validateDavExtMethods(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	return validateMethods(stmt, []string{"PROPFIND", "OPTIONS", "LOCK", "UNLOCK"})
+}
+
+func validateMethods(stmt Directive, methods []string) []string {
+	var problems []string
+	for _, arg := range stmt.Args {
+		if (arg == "off" && len(stmt.Args) == 1) || contains(methods, arg) {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf(`invalid value "%s" in "%s" directive`, arg, stmt.Directive))
+	}
+	return problems
+}
+
+// the operators that compare a variable in an "if" condition
+var ifOperators = []string{"=", "!=", "~", "~*", "!~", "!~*"}
+
+// the file tests that an "if" condition can use, with or without a "!"
+var ifFileTests = []string{"-f", "-d", "-e", "-x"}
+
+// ifInLocationAdvice returns what to use instead of an "if" directive in a
+// location, or false if its block only has directives that are safe there.
+func ifInLocationAdvice(stmt Directive) (string, bool) {
+	if len(stmt.Args) > 0 && contains(ifFileTests, strings.TrimPrefix(stmt.Args[0], "!")) {
+		return `use "try_files" to check for files instead`, true
+	}
+	for _, d := range *stmt.Block {
+		last := len(d.Args) > 0 && d.Args[len(d.Args)-1] == "last"
+		if !d.IsComment() && d.Directive != "return" && !(d.Directive == "rewrite" && last) {
+			return `use "map" to set variables instead, or only use "return" or "rewrite ... last" inside of it`, true
+		}
+	}
+	return "", false
+}
+
+// ValidateIfCondition checks that the arguments of an "if" directive, with
+// their parentheses removed, are a condition that nginx accepts: a variable
+// on its own, a variable compared to a string with "=" or "!=", a variable
+// matched against a regex with "~", "~*", "!~", or "!~*", or a file test
+// like "-f $path" or "!-d $path".
+func ValidateIfCondition(args []string) error {
+	if len(args) == 0 {
+		return errors.New(`missing "if" condition`)
+	}
+	cond := strings.Join(args, " ")
+
+	if len(args[0]) > 1 && args[0][0] == '$' {
+		switch len(args) {
+		case 1:
+			return nil
+		case 3:
+			if !contains(ifOperators, args[1]) {
+				return fmt.Errorf(`unexpected "%s" in "if" condition`, args[1])
+			}
+			return nil
+		default:
+			return fmt.Errorf(`invalid "if" condition "%s"`, cond)
+		}
+	}
+
+	if contains(ifFileTests, strings.TrimPrefix(args[0], "!")) {
+		if len(args) != 2 {
+			return fmt.Errorf(`invalid "if" condition "%s"`, cond)
+		}
+		return nil
+	}
+
+	return fmt.Errorf(`invalid "if" condition "%s", it must start with a variable or a file test`, cond)
+}
+
+// the parameters that limit_req takes, with "=" if they take a value
+var limitReqParams = []string{"zone=", "burst=", "delay=", "nodelay"}
+
+// limit_req takes "zone=name" and optionally "burst=number" and either
+// "nodelay" or "delay=number"
+func validateLimitReq(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	var problems []string
+	hasZone := false
+	for _, arg := range stmt.Args {
+		param, value := arg, ""
+		if i := strings.Index(arg, "="); i != -1 {
+			param, value = arg[:i+1], arg[i+1:]
+		}
+		switch param {
+		case "zone=":
+			hasZone = true
+			if value == "" {
+				problems = append(problems, fmt.Sprintf(`invalid zone name "%s" in "%s" directive`, arg, stmt.Directive))
+			}
+		case "burst=", "delay=":
+			if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+				name := strings.TrimSuffix(param, "=")
+				problems = append(problems, fmt.Sprintf(`invalid %s value "%s" in "%s" directive`, name, value, stmt.Directive))
+			}
+		case "nodelay":
+		default:
+			problems = append(problems, invalidParam(arg, param, fmt.Sprintf(`"%s" directive`, stmt.Directive), limitReqParams))
+		}
+	}
+	if !hasZone {
+		problems = append(problems, fmt.Sprintf(`"%s" directive must have "zone" parameter`, stmt.Directive))
+	}
+	return problems
+}
+
+// limit_conn takes a zone name and the number of connections to allow
+func validateLimitConn(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(stmt.Args) != 2 {
+		return nil
+	}
+	number := stmt.Args[1]
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return []string{fmt.Sprintf(`invalid number of connections "%s" in "%s" directive`, number, stmt.Directive)}
+	}
+	if n > 65535 {
+		return []string{fmt.Sprintf(`connection limit must be less than 65536 in "%s" directive`, stmt.Directive)}
+	}
+	return nil
+}
+
+// proxy_pass in a stream server takes an upstream name, "host:port", or a
+// unix socket, but not a URL with a scheme like it does in http
+func validateStreamProxyPass(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(ctx) == 0 || ctx[0] != "stream" || len(stmt.Args) != 1 {
+		return nil
+	}
+	addr := stmt.Args[0]
+	if strings.Contains(addr, "$") {
+		return nil
+	}
+	if strings.Contains(addr, "://") {
+		return []string{fmt.Sprintf(`URL with a scheme "%s" is not allowed in stream "%s" directive`, addr, stmt.Directive)}
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		if addr == "unix:" {
+			return []string{fmt.Sprintf(`no path in the unix domain socket "%s" in "%s" directive`, addr, stmt.Directive)}
+		}
+		return nil
+	}
+
+	// without a port it's the name of an upstream block
+	if !strings.Contains(addr, ":") {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return []string{fmt.Sprintf(`invalid address "%s" in "%s" directive`, addr, stmt.Directive)}
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return []string{fmt.Sprintf(`invalid port in "%s" of the "%s" directive`, addr, stmt.Directive)}
+	}
+	return nil
+}
+
+// worker_cpu_affinity takes a binary CPU mask for each worker process, or
+// "auto" followed by at most one mask that limits which CPUs can be used
+func validateCPUAffinity(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(stmt.Args) == 0 {
+		return nil
+	}
+	masks := stmt.Args
+	if masks[0] == "auto" {
+		if len(masks) > 2 {
+			return []string{fmt.Sprintf(`invalid number of arguments in "%s" directive`, stmt.Directive)}
+		}
+		masks = masks[1:]
+	}
+
+	var problems []string
+	for _, mask := range masks {
+		if strings.Trim(mask, "01 ") != "" {
+			problems = append(problems, fmt.Sprintf(`invalid mask "%s" in "%s" directive`, mask, stmt.Directive))
+		}
+	}
+	return problems
+}
+
+// the parameters of a server in an upstream block, including the ones that
+// are only in nginx+
+var upstreamServerParams = []string{
+	"backup", "down", "drain", "fail_timeout=", "max_conns=", "max_fails=",
+	"resolve", "route=", "service=", "slow_start=", "weight=",
+}
+
+// server in an upstream block takes an address and parameters that change how
+// requests are balanced between the servers
+func validateUpstreamServer(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(ctx) == 0 || ctx[len(ctx)-1] != "upstream" || len(stmt.Args) == 0 {
+		return nil
+	}
+	where := fmt.Sprintf(`"%s" directive`, stmt.Directive)
+	if parent != nil && parent.Directive == "upstream" && len(parent.Args) > 0 {
+		where += fmt.Sprintf(` of upstream "%s"`, parent.Args[0])
+	}
+
+	var problems []string
+	if what := checkUpstreamAddr(stmt.Args[0], ctx[0] == "stream"); what != "" {
+		problems = append(problems, fmt.Sprintf(`%s "%s" in %s`, what, stmt.Args[0], where))
+	}
+
+	for _, arg := range stmt.Args[1:] {
+		param, value := arg, ""
+		if i := strings.Index(arg, "="); i >= 0 {
+			param, value = arg[:i+1], arg[i+1:]
+		}
+		valid := true
+		switch param {
+		case "backup", "down", "drain", "resolve":
+		case "weight=":
+			n, err := strconv.Atoi(value)
+			valid = err == nil && n > 0
+		case "max_conns=", "max_fails=":
+			n, err := strconv.Atoi(value)
+			valid = err == nil && n >= 0
+		case "fail_timeout=", "slow_start=":
+			_, err := parseDuration(value)
+			valid = err == nil
+		case "route=", "service=":
+			valid = value != ""
+		default:
+			problems = append(problems, invalidParam(arg, param, where, upstreamServerParams))
+			continue
+		}
+		if !valid {
+			problems = append(problems, fmt.Sprintf(`invalid value "%s" in %s`, arg, where))
+		}
+	}
+	return problems
+}
+
+// checkUpstreamAddr describes what's wrong with the address of a server in an
+// upstream block, or returns "" if nothing is. Servers in stream upstreams
+// need a port, since there's no default one.
+func checkUpstreamAddr(addr string, needPort bool) string {
+	if strings.HasPrefix(addr, "$") {
+		return ""
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		if addr == "unix:" {
+			return "no path in the unix domain socket"
+		}
+		return ""
+	}
+
+	host, port := addr, ""
+	if strings.Count(addr, ":") == 1 || (strings.HasPrefix(addr, "[") && !strings.HasSuffix(addr, "]")) {
+		var err error
+		if host, port, err = net.SplitHostPort(addr); err != nil {
+			return "invalid address"
+		}
+	}
+	if host == "" || host == "[]" {
+		return "invalid address"
+	}
+	if port == "" {
+		if needPort {
+			return "no port in upstream"
+		}
+		return ""
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "invalid port in upstream"
+	}
+	return ""
+}
+
+// error_page takes status codes from 300 to 599, optionally "=" or "=code"
+// to change the response's code, and then the URI or named location to show.
+// nginx doesn't accept ranges of codes, so each one has to be listed.
+func validateErrorPage(stmt Directive, ctx blockCtx, parent *Directive) []string {
+	if len(stmt.Args) < 2 {
+		return nil
+	}
+	last := len(stmt.Args) - 1
+	codes, uri := stmt.Args[:last], stmt.Args[last]
+
+	override := ""
+	if i := len(codes) - 1; i >= 0 && strings.HasPrefix(codes[i], "=") {
+		codes, override = codes[:i], codes[i]
+	}
+
+	var problems []string
+	if len(codes) == 0 {
+		problems = append(problems, fmt.Sprintf(`"%s" directive must have a status code`, stmt.Directive))
+	}
+	for _, code := range codes {
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 0 || n == 499 {
+			problems = append(problems, fmt.Sprintf(`invalid value "%s" in "%s" directive`, code, stmt.Directive))
+		} else if n < 300 || n > 599 {
+			problems = append(problems, fmt.Sprintf(`value "%s" must be between 300 and 599 in "%s" directive`, code, stmt.Directive))
+		}
+	}
+	if len(override) > 1 {
+		if n, err := strconv.Atoi(override[1:]); err != nil || n < 0 {
+			problems = append(problems, fmt.Sprintf(`invalid value "%s" in "%s" directive`, override, stmt.Directive))
+		}
+	}
+
+	// a code or "=code" at the end means that the URI was left out
+	if _, err := strconv.Atoi(strings.TrimPrefix(uri, "=")); err == nil || uri == "=" {
+		problems = append(problems, fmt.Sprintf(`missing URI after "%s" in "%s" directive`, uri, stmt.Directive))
+	}
+	return problems
+}
+
+// invalidParam describes an unknown parameter, suggesting the known parameter
+// with the closest name if it looks like a typo, like "burts=" for "burst=".
+// The parameter is said to be in where, like `"limit_req" directive`.
+func invalidParam(arg, param, where string, known []string) string {
+	what := fmt.Sprintf(`invalid parameter "%s" in %s`, arg, where)
+	best, bestDist := "", 3
+	for _, k := range known {
+		dist := levenshtein(strings.TrimSuffix(param, "="), strings.TrimSuffix(k, "="))
+		if dist < bestDist {
+			best, bestDist = k, dist
+		}
+	}
+	if best != "" {
+		what += fmt.Sprintf(` (did you mean "%s"?)`, best)
+	}
+	return what
+}
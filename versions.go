@@ -0,0 +1,101 @@
+package crossplane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// directiveVersion is the nginx version that a directive was added in and
+// the version that it was removed in, either of which can be empty.
+type directiveVersion struct {
+	added   string
+	removed string
+}
+
+// This dict maps directives that nginx has added or removed in recent
+// releases to the versions that it happened in, taken from the changelog.
+// Directives that have been in nginx for longer aren't in it.
+var directiveVersions = map[string]directiveVersion{
+	"auth_delay":                      directiveVersion{added: "1.17.10"},
+	"http2":                           directiveVersion{added: "1.25.1"},
+	"http2_max_concurrent_pushes":     directiveVersion{removed: "1.25.1"},
+	"http2_push":                      directiveVersion{removed: "1.25.1"},
+	"http2_push_preload":              directiveVersion{removed: "1.25.1"},
+	"http3":                           directiveVersion{added: "1.25.0"},
+	"http3_hq":                        directiveVersion{added: "1.25.0"},
+	"http3_max_concurrent_streams":    directiveVersion{added: "1.25.0"},
+	"http3_stream_buffer_size":        directiveVersion{added: "1.25.0"},
+	"keepalive_time":                  directiveVersion{added: "1.19.10"},
+	"proxy_half_close":                directiveVersion{added: "1.21.4"},
+	"quic_active_connection_id_limit": directiveVersion{added: "1.25.0"},
+	"quic_bpf":                        directiveVersion{added: "1.25.0"},
+	"quic_gso":                        directiveVersion{added: "1.25.0"},
+	"quic_host_key":                   directiveVersion{added: "1.25.0"},
+	"quic_retry":                      directiveVersion{added: "1.25.0"},
+	"spdy_chunk_size":                 directiveVersion{removed: "1.9.5"},
+	"spdy_headers_comp":               directiveVersion{removed: "1.9.5"},
+	"ssl":                             directiveVersion{removed: "1.25.1"},
+	"ssl_conf_command":                directiveVersion{added: "1.19.4"},
+	"ssl_early_data":                  directiveVersion{added: "1.15.3"},
+	"ssl_ocsp":                        directiveVersion{added: "1.19.0"},
+	"ssl_reject_handshake":            directiveVersion{added: "1.19.4"},
+}
+
+// parseVersion reads a version like "1.25" or "1.25.3" into its numbers.
+func parseVersion(v string) ([]int, error) {
+	parts := strings.Split(v, ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid nginx version %q", v)
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
+
+// versionBefore returns true if version a comes before version b, treating
+// missing numbers as zeros so that "1.25" is the same as "1.25.0".
+func versionBefore(a, b []int) bool {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// checkVersion describes why a directive can't be used in the given version
+// of nginx, or returns "" if it can be or its history isn't known.
+func checkVersion(stmt Directive, version []int) string {
+	if v, ok := directiveVersions[stmt.Directive]; ok {
+		if added, _ := parseVersion(v.added); v.added != "" && versionBefore(version, added) {
+			return fmt.Sprintf(`"%s" directive was added in nginx %s`, stmt.Directive, v.added)
+		}
+		if removed, _ := parseVersion(v.removed); v.removed != "" && !versionBefore(version, removed) {
+			return fmt.Sprintf(`"%s" directive was removed in nginx %s`, stmt.Directive, v.removed)
+		}
+	}
+
+	// the HTTP/2 and HTTP/3 parameters of listen have their own history
+	if stmt.Directive == "listen" && len(stmt.Args) > 0 {
+		for _, arg := range stmt.Args[1:] {
+			if arg == "quic" && versionBefore(version, []int{1, 25, 0}) {
+				return `"quic" parameter of "listen" directive was added in nginx 1.25.0`
+			}
+			if arg == "http2" && !versionBefore(version, []int{1, 25, 1}) {
+				return `"http2" parameter of "listen" directive is deprecated since nginx 1.25.1, use the "http2" directive instead`
+			}
+		}
+	}
+	return ""
+}
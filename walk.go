@@ -0,0 +1,305 @@
+package crossplane
+
+import (
+	"strconv"
+	"strings"
+)
+
+// WalkFunc is the type of the function called by Walk for each directive.
+// The ctx argument holds the names of the block directives enclosing d,
+// starting with the outermost one. If the function returns false, Walk
+// doesn't visit the directives inside of d's block.
+type WalkFunc func(ctx []string, d *Directive) bool
+
+// Walk calls fn for each directive in the config in the order that they
+// appear, visiting a block directive before the directives inside of it.
+// Context paths are relative to the config's file, so directives in a file
+// that was included from an http block won't have "http" in their paths.
+func (c Config) Walk(fn WalkFunc) {
+	walkBlock(c.Parsed, []string{}, fn)
+}
+
+func walkBlock(block []Directive, ctx []string, fn WalkFunc) {
+	for i := range block {
+		d := &block[i]
+		if !fn(ctx, d) || d.Block == nil {
+			continue
+		}
+		inner := make([]string, len(ctx), len(ctx)+1)
+		copy(inner, ctx)
+		walkBlock(*d.Block, append(inner, d.Directive), fn)
+	}
+}
+
+// ContextOf returns the names of the block directives enclosing the target
+// directive, like []string{"http", "server", "location"}. The target must
+// point to a directive in this config's tree. If it doesn't, ContextOf
+// returns false.
+func (c Config) ContextOf(target *Directive) ([]string, bool) {
+	var found []string
+	c.Walk(func(ctx []string, d *Directive) bool {
+		if d == target {
+			found = ctx
+		}
+		return found == nil
+	})
+	return found, found != nil
+}
+
+// FlatDirective is a directive without its block, along with the names of
+// the block directives that enclose it.
+type FlatDirective struct {
+	Path      []string
+	Directive string
+	Args      []string
+	Line      int
+}
+
+// Flatten returns every directive in the config in the order that they
+// appear, with each block directive coming before the directives inside of
+// it. Comments are left out. Like Walk, paths are relative to the config's
+// file.
+func (c Config) Flatten() []FlatDirective {
+	flat := []FlatDirective{}
+	c.Walk(func(ctx []string, d *Directive) bool {
+		if !d.IsComment() {
+			flat = append(flat, FlatDirective{
+				Path:      append([]string{}, ctx...),
+				Directive: d.Directive,
+				Args:      append([]string{}, d.Args...),
+				Line:      d.Line,
+			})
+		}
+		return true
+	})
+	return flat
+}
+
+// Tabulate returns a row for every directive in the payload's configs, for
+// writing out as a table in docs. Each row holds the directive's context,
+// name, args, file, and line number. Contexts are joined with " > " and args
+// are quoted the way that Build would write them.
+func (p Payload) Tabulate() [][]string {
+	rows := [][]string{}
+	for _, config := range p.Config {
+		for _, d := range config.Flatten() {
+			args := make([]string, len(d.Args))
+			for i, arg := range d.Args {
+				args[i] = enquote(arg)
+			}
+			rows = append(rows, []string{
+				strings.Join(d.Path, " > "),
+				d.Directive,
+				strings.Join(args, " "),
+				config.File,
+				strconv.Itoa(d.Line),
+			})
+		}
+	}
+	return rows
+}
+
+// DirectiveCounts returns the number of times that each directive is used in
+// the payload's configs. Comments aren't counted, and neither are the
+// entries of blocks like map, geo, and types, since they're keys rather than
+// directives. That includes the entries in files that are only included
+// into those blocks, like mime.types.
+func (p Payload) DirectiveCounts() map[string]int {
+	counts := map[string]int{}
+	p.countDirectives(func(path []string, directive string) {
+		counts[directive]++
+	})
+	return counts
+}
+
+// DirectiveCountsByContext is like DirectiveCounts, but counts directives
+// separately for each context that they're in. Contexts are written like
+// they are by Tabulate, like "http > server", and the top level of a config
+// is "". Like with Walk, contexts are relative to each config's file.
+func (p Payload) DirectiveCountsByContext() map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	p.countDirectives(func(path []string, directive string) {
+		ctx := strings.Join(path, " > ")
+		if counts[ctx] == nil {
+			counts[ctx] = map[string]int{}
+		}
+		counts[ctx][directive]++
+	})
+	return counts
+}
+
+func (p Payload) countDirectives(count func(path []string, directive string)) {
+	entries := p.entryFiles()
+	for i, config := range p.Config {
+		if entries[i] {
+			continue
+		}
+		for _, d := range config.Flatten() {
+			if !inContainer(d.Path) {
+				count(d.Path, d.Directive)
+			}
+		}
+	}
+}
+
+// entryFiles returns the indexes of the configs that are only included into
+// blocks like map and types, so that everything in them is an entry. Files
+// are parsed in the order that they're first included, so each config's
+// includers are looked at before it is.
+func (p Payload) entryFiles() map[int]bool {
+	inside, outside := map[int]bool{}, map[int]bool{}
+	for i, config := range p.Config {
+		entries := inside[i] && !outside[i]
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if d.Includes == nil {
+				return true
+			}
+			for _, j := range *d.Includes {
+				if entries || inContainer(ctx) {
+					inside[j] = true
+				} else {
+					outside[j] = true
+				}
+			}
+			return true
+		})
+	}
+
+	files := map[int]bool{}
+	for i := range inside {
+		files[i] = !outside[i]
+	}
+	return files
+}
+
+// inContainer returns true if a context is anywhere inside of a block whose
+// contents are key/value entries, like "map" or "types". Unlike with
+// isContainerCtx, the context can be relative to an included file.
+func inContainer(ctx []string) bool {
+	for _, names := range containerBlocks {
+		for _, name := range ctx {
+			if contains(names, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DirectiveAt returns the innermost directive that covers a line and column
+// in the config's file, along with the names of the block directives that
+// enclose it, like []string{"http", "server"}. Line and column numbers start
+// at 1, and columns are counted in runes. The config has to be parsed with
+// the RetainPositions option, since directives without positions never
+// cover anything. If no directive covers the position, DirectiveAt returns
+// false.
+func (c Config) DirectiveAt(line, column int) (*Directive, []string, bool) {
+	var found *Directive
+	var path []string
+	c.Walk(func(ctx []string, d *Directive) bool {
+		if !d.covers(line, column) {
+			return false
+		}
+		found, path = d, ctx
+		return true
+	})
+	return found, path, found != nil
+}
+
+// covers returns true if the directive starts at or before a position and
+// ends at or after it.
+func (d Directive) covers(line, column int) bool {
+	if d.Column == 0 || d.EndLine == 0 {
+		return false
+	}
+	afterStart := line > d.Line || (line == d.Line && column >= d.Column)
+	beforeEnd := line < d.EndLine || (line == d.EndLine && column <= d.EndColumn)
+	return afterStart && beforeEnd
+}
+
+// Tree returns an outline of the config for debugging, with one directive
+// per line, each block's directives indented under it by two spaces, and
+// the args of each directive in brackets, like:
+//
+//	http
+//	  server
+//	    listen [127.0.0.1:8080]
+//	    location [/]
+//	      return [200, "foo bar baz"]
+//
+// Args are quoted if they're empty or have spaces, commas, brackets, or
+// quotes in them, so that it's clear where each one starts and ends.
+// Comments are written with their "#". The outline can't be parsed; use
+// Build to write a config that nginx can read.
+func (c Config) Tree() string {
+	lines := []string{}
+	c.Walk(func(ctx []string, d *Directive) bool {
+		line := strings.Repeat("  ", len(ctx)) + d.Directive
+		if d.IsComment() {
+			line += *d.Comment
+		} else if len(d.Args) > 0 {
+			args := make([]string, len(d.Args))
+			for i, arg := range d.Args {
+				args[i] = arg
+				if arg == "" || strings.ContainsAny(arg, " \t\n,[]\"") {
+					args[i] = strconv.Quote(arg)
+				}
+			}
+			line += " [" + strings.Join(args, ", ") + "]"
+		}
+		lines = append(lines, line)
+		return true
+	})
+	return strings.Join(lines, "\n")
+}
+
+// Marker is a comment that marks a place in a config, like the start or end
+// of a block of directives that's managed by a templating tool.
+type Marker struct {
+	// The comment's text, without its "#" or the whitespace after it.
+	Text string
+	Line int
+
+	// The names of the block directives enclosing the marker, like the ctx
+	// of a WalkFunc.
+	Context []string
+
+	// The block that the marker is in and its index in that block, so that
+	// the directives between two markers in the same block are
+	// (*Block)[start.Index+1 : end.Index].
+	Block *[]Directive
+	Index int
+}
+
+// Markers returns the comments in the config whose text starts with prefix,
+// ignoring the whitespace after the "#", in the order that they appear. The
+// config has to be parsed with ParseComments for it to have any. Comments
+// that come after a directive on the same line are left out, since they
+// belong to that directive rather than marking a place in the config. The
+// Block fields point into the config.
+func (c *Config) Markers(prefix string) []Marker {
+	markers := []Marker{}
+	findMarkers(&c.Parsed, []string{}, 0, prefix, &markers)
+	return markers
+}
+
+// findMarkers adds the markers in a block, where lastLine is the line of the
+// block's directive so that a comment after its "{" isn't a marker.
+func findMarkers(block *[]Directive, ctx []string, lastLine int, prefix string, markers *[]Marker) {
+	for i := range *block {
+		d := &(*block)[i]
+		if d.IsComment() && d.Line != lastLine {
+			if text := strings.TrimLeft(*d.Comment, " \t"); strings.HasPrefix(text, prefix) {
+				*markers = append(*markers, Marker{Text: text, Line: d.Line, Context: ctx, Block: block, Index: i})
+			}
+		}
+		if d.Block != nil {
+			inner := make([]string, len(ctx), len(ctx)+1)
+			copy(inner, ctx)
+			findMarkers(d.Block, append(inner, d.Directive), d.Line, prefix, markers)
+		}
+		if !d.IsComment() {
+			lastLine = d.Line
+		}
+	}
+}
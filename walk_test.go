@@ -0,0 +1,281 @@
+package crossplane
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "simple", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	t.Run("order", func(t *testing.T) {
+		var visited []string
+		config.Walk(func(ctx []string, d *Directive) bool {
+			visited = append(visited, strings.Join(append(ctx, d.Directive), ">"))
+			return true
+		})
+		expected := []string{
+			"events",
+			"events>worker_connections",
+			"http",
+			"http>server",
+			"http>server>listen",
+			"http>server>server_name",
+			"http>server>location",
+			"http>server>location>return",
+		}
+		if strings.Join(visited, " ") != strings.Join(expected, " ") {
+			t.Fatalf("expected: %v\nbut got: %v", expected, visited)
+		}
+	})
+
+	t.Run("context-of", func(t *testing.T) {
+		var ret *Directive
+		config.Walk(func(ctx []string, d *Directive) bool {
+			if d.Directive == "return" {
+				ret = d
+			}
+			return true
+		})
+		ctx, ok := config.ContextOf(ret)
+		if !ok || strings.Join(ctx, ">") != "http>server>location" {
+			t.Fatalf("unexpected context: %v, %v", ctx, ok)
+		}
+		if _, ok := config.ContextOf(&Directive{Directive: "return"}); ok {
+			t.Fatal("expected directive outside of the config to not be found")
+		}
+	})
+	t.Run("flatten", func(t *testing.T) {
+		expected := []FlatDirective{
+			FlatDirective{Path: []string{}, Directive: "events", Args: []string{}, Line: 1},
+			FlatDirective{Path: []string{"events"}, Directive: "worker_connections", Args: []string{"1024"}, Line: 2},
+			FlatDirective{Path: []string{}, Directive: "http", Args: []string{}, Line: 5},
+			FlatDirective{Path: []string{"http"}, Directive: "server", Args: []string{}, Line: 6},
+			FlatDirective{Path: []string{"http", "server"}, Directive: "listen", Args: []string{"127.0.0.1:8080"}, Line: 7},
+			FlatDirective{Path: []string{"http", "server"}, Directive: "server_name", Args: []string{"default_server"}, Line: 8},
+			FlatDirective{Path: []string{"http", "server"}, Directive: "location", Args: []string{"/"}, Line: 9},
+			FlatDirective{Path: []string{"http", "server", "location"}, Directive: "return", Args: []string{"200", "foo bar baz"}, Line: 10},
+		}
+		if flat := config.Flatten(); !reflect.DeepEqual(flat, expected) {
+			t.Fatalf("expected: %v\nbut got: %v", expected, flat)
+		}
+	})
+}
+
+func TestTabulate(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "simple", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join("testdata", "simple", "nginx.conf")
+	expected := [][]string{
+		[]string{"", "events", "", file, "1"},
+		[]string{"events", "worker_connections", "1024", file, "2"},
+		[]string{"", "http", "", file, "5"},
+		[]string{"http", "server", "", file, "6"},
+		[]string{"http > server", "listen", "127.0.0.1:8080", file, "7"},
+		[]string{"http > server", "server_name", "default_server", file, "8"},
+		[]string{"http > server", "location", "/", file, "9"},
+		[]string{"http > server > location", "return", `200 "foo bar baz"`, file, "10"},
+	}
+	if rows := payload.Tabulate(); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("expected: %q\nbut got: %q", expected, rows)
+	}
+}
+
+func TestDirectiveAt(t *testing.T) {
+	path := filepath.Join("testdata", "with-comments", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{ParseComments: true, RetainPositions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	tests := []struct {
+		line, column int
+		directive    string
+		context      []string
+		found        bool
+	}{
+		{1, 1, "events", []string{}, true},
+		{2, 10, "worker_connections", []string{"events"}, true},
+		{3, 1, "events", []string{}, true},
+		{3, 2, "", nil, false},
+		{4, 3, "#", []string{}, true},
+		{7, 5, "server", []string{"http"}, true},
+		{7, 36, "listen", []string{"http", "server"}, true},
+		{7, 40, "#", []string{"http", "server"}, true},
+		{11, 37, "return", []string{"http", "server", "location"}, true},
+		{11, 38, "location", []string{"http", "server"}, true},
+		{14, 1, "http", []string{}, true},
+		{15, 1, "", nil, false},
+	}
+	for _, test := range tests {
+		d, context, found := config.DirectiveAt(test.line, test.column)
+		if found != test.found {
+			t.Fatalf("%d:%d: expected found to be %v", test.line, test.column, test.found)
+		}
+		if !found {
+			continue
+		}
+		if d.Directive != test.directive || !reflect.DeepEqual(context, test.context) {
+			t.Fatalf("%d:%d: expected %s in %v but got %s in %v", test.line, test.column, test.directive, test.context, d.Directive, context)
+		}
+	}
+
+	// the directive points into the config
+	d, _, _ := config.DirectiveAt(11, 20)
+	if d != &(*(*(*config.Parsed[2].Block)[0].Block)[3].Block)[2] {
+		t.Fatal("expected the directive to point into the config")
+	}
+
+	// positions are only known if they're retained
+	payload, err = Parse(path, &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := payload.Config[0].DirectiveAt(2, 10); found {
+		t.Fatal("expected no directive without retained positions")
+	}
+}
+
+func TestTree(t *testing.T) {
+	path := filepath.Join("testdata", "with-comments", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{ParseComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"events",
+		"  worker_connections [1024]",
+		"#comment",
+		"http",
+		"  server",
+		"    listen [127.0.0.1:8080]",
+		"    #listen",
+		"    server_name [default_server]",
+		"    location [/]",
+		"      ## this is brace",
+		"      # location /",
+		`      return [200, "foo bar baz"]`,
+	}, "\n")
+	if tree := payload.Config[0].Tree(); tree != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s", expected, tree)
+	}
+
+	config := Config{Parsed: []Directive{
+		Directive{Directive: "set", Args: []string{"$a", "", "x,y"}},
+		Directive{Directive: "daemon", Args: []string{"off"}},
+	}}
+	if tree := config.Tree(); tree != `set [$a, "", "x,y"]`+"\ndaemon [off]" {
+		t.Fatalf("expected args to be quoted but got:\n%s", tree)
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	path := filepath.Join("testdata", "markers", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{ParseComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := payload.Config[0]
+
+	type marker struct {
+		text    string
+		line    int
+		context []string
+	}
+	expected := []marker{
+		{"BEGIN managed events", 1, []string{}},
+		{"BEGIN managed upstreams", 7, []string{"http"}},
+		{"BEGINNING of the server's locations", 14, []string{"http", "server"}},
+		{"BEGIN managed location", 16, []string{"http", "server", "location"}},
+	}
+	markers := config.Markers("BEGIN")
+	got := []marker{}
+	for _, m := range markers {
+		if d := (*m.Block)[m.Index]; !d.IsComment() || d.Line != m.Line {
+			t.Fatalf("expected the marker on line %d to point to its comment but got %v", m.Line, d)
+		}
+		got = append(got, marker{m.Text, m.Line, m.Context})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected: %#v\nbut got: %#v", expected, got)
+	}
+	if markers[0].Block != &config.Parsed {
+		t.Fatalf("expected the top-level marker to point into the config")
+	}
+
+	// replace what's between the managed upstreams markers
+	ends := config.Markers("END managed upstreams")
+	if len(ends) != 1 || ends[0].Block != markers[1].Block {
+		t.Fatalf("expected one end marker in the same block but got %v", ends)
+	}
+	block, start, end := markers[1].Block, markers[1].Index, ends[0].Index
+	managed := Directive{Directive: "upstream", Args: []string{"other"}, Block: &[]Directive{}}
+	*block = append((*block)[:start+1], append([]Directive{managed}, (*block)[end:]...)...)
+	if http := *config.Parsed[3].Block; http[1].Args[0] != "other" || *http[2].Comment != "END managed upstreams" {
+		t.Fatalf("expected the managed block to be replaced but got %v", http)
+	}
+
+	if markers := config.Markers("nothing"); len(markers) != 0 {
+		t.Fatalf("expected no markers but got %v", markers)
+	}
+}
+
+func TestDirectiveCounts(t *testing.T) {
+	payload, err := Parse(filepath.Join("testdata", "map-geo-params", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{
+		"events": 1,
+		"http":   1,
+		"map":    1,
+		"geo":    2,
+	}
+	if counts := payload.DirectiveCounts(); !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected: %v\nbut got: %v", expected, counts)
+	}
+
+	// entries in files included into types, map, and geo blocks aren't
+	// counted either
+	payload, err = Parse(filepath.Join("testdata", "container-includes", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]int{
+		"events": 1,
+		"http":   1,
+		"types":  1,
+		"map":    1,
+		"geo":    1,
+		"server": 1,
+		"listen": 1,
+		"return": 1,
+	}
+	if counts := payload.DirectiveCounts(); !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected: %v\nbut got: %v", expected, counts)
+	}
+
+	payload, err = Parse(filepath.Join("testdata", "with-comments", "nginx.conf"), &ParseOptions{ParseComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byContext := map[string]map[string]int{
+		"":                         map[string]int{"events": 1, "http": 1},
+		"events":                   map[string]int{"worker_connections": 1},
+		"http":                     map[string]int{"server": 1},
+		"http > server":            map[string]int{"listen": 1, "server_name": 1, "location": 1},
+		"http > server > location": map[string]int{"return": 1},
+	}
+	if counts := payload.DirectiveCountsByContext(); !reflect.DeepEqual(counts, byContext) {
+		t.Fatalf("expected: %v\nbut got: %v", byContext, counts)
+	}
+}